@@ -0,0 +1,376 @@
+// Package client is the Go client of the cache API. It wraps the gRPC CacheService with typed
+// errors, deadlines, retries and the request id and credentials metadata read by the server.
+package client
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/auth"
+	cacheapiv1 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v1"
+	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/requestid"
+	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/userid"
+	"github.com/ahmedalhulaibi/cache-api/internal/limit"
+)
+
+type Client struct {
+	conn    *grpc.ClientConn
+	service cacheapiv1.CacheServiceClient
+	options options
+	near    *nearCache
+}
+
+// New creates a client for the server at target, the connection is established on first use.
+func New(target string, opts ...Option) (*Client, error) {
+	o := newOptions(opts)
+	dialOptions := slices.Clone(o.dialOptions)
+	if len(dialOptions) == 0 {
+		dialOptions = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+
+	// calls continue the trace of their context through the global tracer provider and propagator
+	dialOptions = append(dialOptions, grpc.WithStatsHandler(otelgrpc.NewClientHandler()))
+
+	conn, err := grpc.NewClient(target, dialOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("cache client: %w", err)
+	}
+
+	return newClient(conn, cacheapiv1.NewCacheServiceClient(conn), o), nil
+}
+
+// NewFromConn creates a client on a connection owned by the caller, Close does not close it.
+func NewFromConn(conn grpc.ClientConnInterface, opts ...Option) *Client {
+	return newClient(nil, cacheapiv1.NewCacheServiceClient(conn), newOptions(opts))
+}
+
+func newClient(conn *grpc.ClientConn, service cacheapiv1.CacheServiceClient, o options) *Client {
+	c := &Client{
+		conn:    conn,
+		service: service,
+		options: o,
+	}
+	if o.nearCache != nil {
+		c.near = newNearCache(*o.nearCache, service, c.outgoing)
+	}
+	return c
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		timeout: DefaultTimeout,
+		retry:   DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func (c *Client) Close() error {
+	if c.near != nil {
+		c.near.close()
+	}
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+type requestIDKey struct{}
+type userIDKey struct{}
+
+// ContextWithRequestID sets the request id sent with calls made with ctx, a new one is generated otherwise.
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// ContextWithUserID sets the user id sent with calls made with ctx.
+//
+// Deprecated: servers derive the user id from the credentials of a call, use WithAPIKey.
+func ContextWithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+// outgoing adds the request id, user id and API key to the outgoing metadata unless it already has them.
+func (c *Client) outgoing(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+
+	if len(md.Get(requestid.ContextKey)) == 0 {
+		requestID, _ := ctx.Value(requestIDKey{}).(string)
+		if requestID == "" {
+			requestID = uuid.NewString()
+		}
+		md.Set(requestid.ContextKey, requestID)
+	}
+
+	if len(md.Get(userid.ContextKey)) == 0 {
+		userID, _ := ctx.Value(userIDKey{}).(string)
+		if userID == "" {
+			userID = c.options.userID
+		}
+		if userID != "" {
+			md.Set(userid.ContextKey, userID)
+		}
+	}
+
+	if c.options.apiKey != "" && len(md.Get(auth.APIKeyHeader)) == 0 {
+		md.Set(auth.APIKeyHeader, c.options.apiKey)
+	}
+
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// retryable reports whether err may succeed on a later attempt. An exceeded quota does not clear by
+// waiting, so it is only retried when the server says when to come back.
+func retryable(policy RetryPolicy, err error) bool {
+	st := status.Convert(err)
+	if !slices.Contains(policy.RetryableCodes, st.Code()) {
+		return false
+	}
+	var quotaFailure, retryInfo bool
+	for _, d := range st.Details() {
+		switch d.(type) {
+		case *errdetails.QuotaFailure:
+			quotaFailure = true
+		case *errdetails.RetryInfo:
+			retryInfo = true
+		}
+	}
+	return !quotaFailure || retryInfo
+}
+
+// invoke calls fn until it succeeds, fails with an error that is not retryable, or runs out of
+// attempts or time. Every attempt shares the deadline and request id of the call.
+func (c *Client) invoke(ctx context.Context, opts []CallOption, fn func(ctx context.Context, o *callOptions) error) error {
+	o := &callOptions{timeout: c.options.timeout}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	ctx = c.outgoing(ctx)
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+
+	policy := c.options.retry
+	backoff := policy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx, o)
+		if err == nil {
+			return nil
+		}
+		if attempt >= policy.MaxAttempts || !retryable(policy, err) {
+			return mapError(err)
+		}
+
+		delay := time.Duration(0)
+		if backoff > 0 {
+			delay = rand.N(backoff)
+		}
+		// a server that sheds load says when to come back
+		delay = max(delay, limit.RetryDelay(err))
+		select {
+		case <-ctx.Done():
+			return mapError(err)
+		case <-time.After(delay):
+		}
+		backoff = min(time.Duration(float64(backoff)*policy.Multiplier), policy.MaxBackoff)
+	}
+}
+
+// Get returns the value of a key or ErrNotFound.
+func (c *Client) Get(ctx context.Context, bucket, key string, opts ...CallOption) ([]byte, error) {
+	var generation uint64
+	if c.near != nil {
+		value, g, ok := c.near.get(bucket, key)
+		if ok {
+			return value, nil
+		}
+		generation = g
+	}
+
+	var resp *cacheapiv1.GetResponse
+	err := c.invoke(ctx, opts, func(ctx context.Context, o *callOptions) error {
+		var err error
+		resp, err = c.service.Get(ctx, &cacheapiv1.GetRequest{Bucket: bucket, Key: key})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Found {
+		return nil, ErrNotFound
+	}
+
+	value := []byte(resp.Value)
+	if c.near != nil {
+		c.near.put(bucket, key, value, generation)
+	}
+	return value, nil
+}
+
+// Set stores the value of a key. The v1 API carries values as strings, so value must be valid UTF-8.
+func (c *Client) Set(ctx context.Context, bucket, key string, value []byte, opts ...CallOption) error {
+	if c.near != nil {
+		defer c.near.invalidate(bucket, key)
+	}
+
+	return c.invoke(ctx, opts, func(ctx context.Context, o *callOptions) error {
+		req := &cacheapiv1.SetRequest{Bucket: bucket, Key: key, Value: string(value)}
+		if o.ttl > 0 || o.evictionPolicy != 0 {
+			req.Options = &cacheapiv1.Options{
+				TtlSeconds:     int64((o.ttl + time.Second - 1) / time.Second),
+				EvictionPolicy: cacheapiv1.EvictionPolicy(o.evictionPolicy),
+			}
+		}
+
+		_, err := c.service.Set(ctx, req)
+		return err
+	})
+}
+
+// Delete removes a key or returns ErrNotFound.
+func (c *Client) Delete(ctx context.Context, bucket, key string, opts ...CallOption) error {
+	if c.near != nil {
+		defer c.near.invalidate(bucket, key)
+	}
+
+	var resp *cacheapiv1.DeleteResponse
+	err := c.invoke(ctx, opts, func(ctx context.Context, o *callOptions) error {
+		var err error
+		resp, err = c.service.Delete(ctx, &cacheapiv1.DeleteRequest{Bucket: bucket, Key: key})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if !resp.Deleted {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListBuckets returns the buckets holding at least one key on the server.
+func (c *Client) ListBuckets(ctx context.Context, opts ...CallOption) ([]string, error) {
+	var resp *cacheapiv1.ListBucketsResponse
+	err := c.invoke(ctx, opts, func(ctx context.Context, o *callOptions) error {
+		var err error
+		resp, err = c.service.ListBuckets(ctx, &cacheapiv1.ListBucketsRequest{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Buckets, nil
+}
+
+// ListKeys returns the keys of a bucket starting with prefix, an empty prefix lists every key.
+func (c *Client) ListKeys(ctx context.Context, bucket, prefix string, opts ...CallOption) ([]string, error) {
+	var resp *cacheapiv1.ListKeysResponse
+	err := c.invoke(ctx, opts, func(ctx context.Context, o *callOptions) error {
+		var err error
+		resp, err = c.service.ListKeys(ctx, &cacheapiv1.ListKeysRequest{Bucket: bucket, Prefix: prefix})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Keys, nil
+}
+
+type Stats struct {
+	Hits, Misses, Evictions, Expired uint64
+	// DiskHits and DiskMisses count the gets that missed in memory and were looked up in the disk tier
+	DiskHits, DiskMisses uint64
+	// Bytes is the size of the values held in memory after compression, UncompressedBytes before it
+	Bytes, UncompressedBytes uint64
+	CompressionRatio         float64
+}
+
+func (c *Client) Stats(ctx context.Context, opts ...CallOption) (*Stats, error) {
+	var resp *cacheapiv1.GetStatsResponse
+	err := c.invoke(ctx, opts, func(ctx context.Context, o *callOptions) error {
+		var err error
+		resp, err = c.service.GetStats(ctx, &cacheapiv1.GetStatsRequest{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Stats{
+		Hits:              resp.Hits,
+		Misses:            resp.Misses,
+		Evictions:         resp.Evictions,
+		Expired:           resp.Expired,
+		DiskHits:          resp.DiskHits,
+		DiskMisses:        resp.DiskMisses,
+		Bytes:             resp.Bytes,
+		UncompressedBytes: resp.UncompressedBytes,
+		CompressionRatio:  resp.CompressionRatio,
+	}, nil
+}
+
+// QuotaUsage is the usage of the buckets owned by a principal and its limits, a zero limit is not enforced.
+type QuotaUsage struct {
+	Principal            string
+	Buckets, Keys        int
+	Bytes                uint64
+	MaxBuckets, MaxKeys  int
+	MaxBytes             uint64
+	MaxRequestsPerSecond float64
+}
+
+// QuotaUsage returns the quota usage of principal, or of every principal with limits or buckets
+// when it is empty. It needs the admin permission.
+func (c *Client) QuotaUsage(ctx context.Context, principal string, opts ...CallOption) ([]QuotaUsage, error) {
+	var resp *cacheapiv1.GetQuotaUsageResponse
+	err := c.invoke(ctx, opts, func(ctx context.Context, o *callOptions) error {
+		var err error
+		resp, err = c.service.GetQuotaUsage(ctx, &cacheapiv1.GetQuotaUsageRequest{Principal: principal})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	usages := make([]QuotaUsage, 0, len(resp.Usages))
+	for _, u := range resp.Usages {
+		usages = append(usages, QuotaUsage{
+			Principal:            u.Principal,
+			Buckets:              int(u.Buckets),
+			Keys:                 int(u.Keys),
+			Bytes:                u.Bytes,
+			MaxBuckets:           int(u.MaxBuckets),
+			MaxKeys:              int(u.MaxKeys),
+			MaxBytes:             u.MaxBytes,
+			MaxRequestsPerSecond: u.MaxRequestsPerSecond,
+		})
+	}
+	return usages, nil
+}
+
+// NearCacheStats returns the counters of the near cache, they are zero when it is disabled.
+func (c *Client) NearCacheStats() NearCacheStats {
+	if c.near == nil {
+		return NearCacheStats{}
+	}
+	return c.near.stats()
+}
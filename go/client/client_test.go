@@ -0,0 +1,369 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/auth"
+	"github.com/ahmedalhulaibi/cache-api/internal/cache"
+	cacheapiv1 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v1"
+	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/authn"
+)
+
+func newTestLogger() *loggy.Logger {
+	l := loggy.New(zap.NewNop().Sugar())
+	return &l
+}
+
+func startServer(t *testing.T, service cacheapiv1.CacheServiceServer, opts ...Option) *Client {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	cacheapiv1.RegisterCacheServiceServer(srv, service)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	c, err := New(lis.Addr().String(), opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// fakeService fails the first failures calls with code, or err when it is set, and records the
+// metadata of every call.
+type fakeService struct {
+	cacheapiv1.UnimplementedCacheServiceServer
+	code     codes.Code
+	err      error
+	failures int
+	delay    time.Duration
+
+	mu       sync.Mutex
+	calls    int
+	metadata []metadata.MD
+}
+
+func (f *fakeService) Get(ctx context.Context, r *cacheapiv1.GetRequest) (*cacheapiv1.GetResponse, error) {
+	f.mu.Lock()
+	f.calls++
+	calls := f.calls
+	md, _ := metadata.FromIncomingContext(ctx)
+	f.metadata = append(f.metadata, md)
+	f.mu.Unlock()
+
+	if f.delay > 0 {
+		select {
+		case <-time.After(f.delay):
+		case <-ctx.Done():
+		}
+	}
+	if calls <= f.failures && f.err != nil {
+		return nil, f.err
+	}
+	if calls <= f.failures {
+		return nil, status.Error(f.code, "injected")
+	}
+	return &cacheapiv1.GetResponse{Value: "value", Found: true}, nil
+}
+
+func TestSetGetStats(t *testing.T) {
+	c := startServer(t, cache.NewCacheService(newTestLogger(), cache.NewCache()))
+	ctx := context.Background()
+
+	_, err := c.Get(ctx, "bucket", "key")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, c.Set(ctx, "bucket", "key", []byte("value"), TTL(time.Hour), Eviction(EvictOldest)))
+	v, err := c.Get(ctx, "bucket", "key")
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), v)
+
+	_, err = c.Get(ctx, "bucket", "missing")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, c.Set(ctx, "bucket", "empty", []byte{}))
+	v, err = c.Get(ctx, "bucket", "empty")
+	require.NoError(t, err)
+	require.Empty(t, v)
+
+	buckets, err := c.ListBuckets(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"bucket"}, buckets)
+	keys, err := c.ListKeys(ctx, "bucket", "k")
+	require.NoError(t, err)
+	require.Equal(t, []string{"key"}, keys)
+
+	require.NoError(t, c.Delete(ctx, "bucket", "empty"))
+	require.ErrorIs(t, c.Delete(ctx, "bucket", "empty"), ErrNotFound)
+
+	stats, err := c.Stats(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), stats.Hits)
+	require.Equal(t, uint64(1), stats.Misses)
+}
+
+func TestRetries(t *testing.T) {
+	fake := &fakeService{code: codes.Unavailable, failures: 2}
+	c := startServer(t, fake, WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		Multiplier:     2,
+		RetryableCodes: []codes.Code{codes.Unavailable},
+	}))
+
+	v, err := c.Get(context.Background(), "bucket", "key")
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), v)
+	require.Equal(t, 3, fake.calls)
+
+	// every attempt carries the same request id
+	id := fake.metadata[0].Get("request_id")
+	require.Len(t, id, 1)
+	for _, md := range fake.metadata {
+		require.Equal(t, id, md.Get("request_id"))
+	}
+}
+
+func TestNoRetryForOtherCodes(t *testing.T) {
+	fake := &fakeService{code: codes.Aborted, failures: 1}
+	c := startServer(t, fake)
+
+	_, err := c.Get(context.Background(), "bucket", "key")
+	require.ErrorIs(t, err, ErrConflict)
+	require.Equal(t, codes.Aborted, status.Code(err))
+	require.Equal(t, 1, fake.calls)
+
+	fake = &fakeService{code: codes.NotFound, failures: 1}
+	c = startServer(t, fake)
+	_, err = c.Get(context.Background(), "bucket", "key")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestNoRetryForQuotaFailures(t *testing.T) {
+	policy := WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		Multiplier:     2,
+		RetryableCodes: []codes.Code{codes.ResourceExhausted},
+	})
+	exhausted := func(details ...protoadapt.MessageV1) error {
+		st, err := status.New(codes.ResourceExhausted, "injected").WithDetails(details...)
+		require.NoError(t, err)
+		return st.Err()
+	}
+	quotaFailure := &errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{{Subject: "user:alice", Description: "key quota of 1 exceeded"}}}
+
+	// an exceeded quota does not clear by waiting
+	fake := &fakeService{err: exhausted(quotaFailure), failures: 1}
+	c := startServer(t, fake, policy)
+	_, err := c.Get(context.Background(), "bucket", "key")
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.Equal(t, 1, fake.calls)
+
+	// unless the server says when to come back
+	fake = &fakeService{err: exhausted(quotaFailure, &errdetails.RetryInfo{RetryDelay: durationpb.New(time.Millisecond)}), failures: 1}
+	c = startServer(t, fake, policy)
+	_, err = c.Get(context.Background(), "bucket", "key")
+	require.NoError(t, err)
+	require.Equal(t, 2, fake.calls)
+
+	fake = &fakeService{code: codes.ResourceExhausted, failures: 1}
+	c = startServer(t, fake, policy)
+	_, err = c.Get(context.Background(), "bucket", "key")
+	require.NoError(t, err)
+	require.Equal(t, 2, fake.calls)
+}
+
+func TestDeadline(t *testing.T) {
+	fake := &fakeService{delay: time.Second}
+	c := startServer(t, fake, WithTimeout(time.Second))
+
+	start := time.Now()
+	_, err := c.Get(context.Background(), "bucket", "key", CallTimeout(20*time.Millisecond))
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+	require.False(t, errors.Is(err, ErrNotFound))
+}
+
+func TestMetadata(t *testing.T) {
+	fake := &fakeService{}
+	c := startServer(t, fake, WithUserID("default-user"), WithAPIKey("secret"))
+
+	ctx := ContextWithRequestID(context.Background(), "req-1")
+	_, err := c.Get(ctx, "bucket", "key")
+	require.NoError(t, err)
+	require.Equal(t, []string{"req-1"}, fake.metadata[0].Get("request_id"))
+	require.Equal(t, []string{"default-user"}, fake.metadata[0].Get("user_id"))
+	require.Equal(t, []string{"secret"}, fake.metadata[0].Get("x-api-key"))
+
+	_, err = c.Get(ContextWithUserID(ctx, "user-2"), "bucket", "key")
+	require.NoError(t, err)
+	require.Equal(t, []string{"user-2"}, fake.metadata[1].Get("user_id"))
+}
+
+func TestNearCache(t *testing.T) {
+	store := cache.NewCache()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	cacheapiv1.RegisterCacheServiceServer(srv, cache.NewCacheService(newTestLogger(), store))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	near, err := New(lis.Addr().String(), WithNearCache(NearCacheConfig{Capacity: 10, TTL: time.Minute}))
+	require.NoError(t, err)
+	t.Cleanup(func() { near.Close() })
+	other, err := New(lis.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { other.Close() })
+
+	ctx := context.Background()
+	require.NoError(t, other.Set(ctx, "bucket", "key", []byte("v1")))
+
+	// values are cached once the invalidation stream is connected
+	require.Eventually(t, func() bool {
+		_, err := near.Get(ctx, "bucket", "key")
+		require.NoError(t, err)
+		return near.NearCacheStats().Hits > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	before := store.Stats().Hits
+	v, err := near.Get(ctx, "bucket", "key")
+	require.NoError(t, err)
+	require.Equal(t, []byte("v1"), v)
+	require.Equal(t, before, store.Stats().Hits)
+
+	// changes made by other clients invalidate the local value
+	require.NoError(t, other.Set(ctx, "bucket", "key", []byte("v2")))
+	require.Eventually(t, func() bool {
+		v, err := near.Get(ctx, "bucket", "key")
+		return err == nil && string(v) == "v2"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, other.Delete(ctx, "bucket", "key"))
+	require.Eventually(t, func() bool {
+		_, err := near.Get(ctx, "bucket", "key")
+		return errors.Is(err, ErrNotFound)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stats := near.NearCacheStats()
+	require.GreaterOrEqual(t, stats.Invalidations, uint64(2))
+	require.Greater(t, stats.HitRatio(), 0.0)
+	require.Less(t, stats.HitRatio(), 1.0)
+}
+
+type apiKeyAuthenticator struct{}
+
+func (apiKeyAuthenticator) Authenticate(ctx context.Context, creds auth.Credentials) (*auth.Identity, error) {
+	if creds.APIKey != "secret" {
+		return nil, auth.ErrInvalidCredentials
+	}
+	return &auth.Identity{Subject: "alice", Method: auth.MethodAPIKey}, nil
+}
+
+func TestNearCacheAuthenticated(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(authn.AuthnUnaryServerInterceptor(newTestLogger(), apiKeyAuthenticator{})),
+		grpc.ChainStreamInterceptor(authn.AuthnStreamServerInterceptor(newTestLogger(), apiKeyAuthenticator{})),
+	)
+	cacheapiv1.RegisterCacheServiceServer(srv, cache.NewCacheService(newTestLogger(), cache.NewCache()))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	c, err := New(lis.Addr().String(), WithAPIKey("secret"), WithNearCache(NearCacheConfig{Capacity: 10}))
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "bucket", "key", []byte("value")))
+
+	// the invalidation stream is only accepted with the API key of the client
+	require.Eventually(t, func() bool {
+		_, err := c.Get(ctx, "bucket", "key")
+		require.NoError(t, err)
+		return c.NearCacheStats().Hits > 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNearCacheWatchError(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(authn.AuthnUnaryServerInterceptor(newTestLogger(), apiKeyAuthenticator{})),
+		grpc.ChainStreamInterceptor(authn.AuthnStreamServerInterceptor(newTestLogger(), apiKeyAuthenticator{})),
+	)
+	cacheapiv1.RegisterCacheServiceServer(srv, cache.NewCacheService(newTestLogger(), cache.NewCache()))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	errs := make(chan error, 100)
+	c, err := New(lis.Addr().String(), WithAPIKey("wrong"), WithNearCache(NearCacheConfig{
+		OnError: func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	}))
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+
+	select {
+	case err := <-errs:
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+	case <-time.After(5 * time.Second):
+		t.Fatal("the watch error was not reported")
+	}
+}
+
+func TestNearCacheBuckets(t *testing.T) {
+	store := cache.NewCache()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	cacheapiv1.RegisterCacheServiceServer(srv, cache.NewCacheService(newTestLogger(), store))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	c, err := New(lis.Addr().String(), WithNearCache(NearCacheConfig{Capacity: 10, Buckets: []string{"bucket1"}}))
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "bucket1", "key", []byte("value")))
+	require.NoError(t, c.Set(ctx, "bucket2", "key", []byte("value")))
+
+	require.Eventually(t, func() bool {
+		_, err := c.Get(ctx, "bucket1", "key")
+		require.NoError(t, err)
+		return c.NearCacheStats().Hits > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the values of other buckets are always read from the server
+	before := c.NearCacheStats()
+	for range 3 {
+		_, err := c.Get(ctx, "bucket2", "key")
+		require.NoError(t, err)
+	}
+	require.Equal(t, before, c.NearCacheStats())
+}
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrNotFound is returned when a key does not exist or has expired.
+	ErrNotFound = errors.New("cache: not found")
+	// ErrConflict is returned when a write conflicts with the current state of a key.
+	ErrConflict = errors.New("cache: conflict")
+)
+
+// mapError wraps gRPC errors with the matching typed error, the gRPC status remains available
+// through status.FromError.
+func mapError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	switch st.Code() {
+	case codes.NotFound:
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case codes.AlreadyExists, codes.Aborted:
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	default:
+		return err
+	}
+}
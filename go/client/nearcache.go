@@ -0,0 +1,227 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/cache"
+	cacheapiv1 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v1"
+)
+
+const (
+	minReconnectDelay = 100 * time.Millisecond
+	maxReconnectDelay = 5 * time.Second
+)
+
+// NearCacheConfig configures an in-process cache in front of the server.
+type NearCacheConfig struct {
+	// Capacity is the number of keys held per bucket, 255 when it is not set
+	Capacity int
+	// TTL bounds how long a value is served locally, 0 keeps it until it is invalidated or evicted
+	TTL time.Duration
+	// Buckets limits the near cache to these buckets, every bucket is cached when it is empty.
+	// Watching every bucket needs read on `*` when the server enforces an ACL.
+	Buckets []string
+	// OnError is called with the error of every failed attempt to watch the invalidations,
+	// values are served from the server until the stream is connected again
+	OnError func(error)
+}
+
+type NearCacheStats struct {
+	Hits, Misses, Invalidations uint64
+}
+
+// HitRatio is the share of gets served locally.
+func (s NearCacheStats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// nearCache holds values read from the server until the server reports that they changed.
+// Values are only served while the invalidation stream is connected, and the cache is emptied
+// every time the stream is (re)established since invalidations may have been missed.
+type nearCache struct {
+	store   cache.Store
+	ttl     time.Duration
+	buckets map[string]struct{}
+	onError func(error)
+
+	// mu orders inserts with invalidations, generation changes with every invalidation so that
+	// a value read from the server across an invalidation is not inserted
+	mu         sync.Mutex
+	generation uint64
+	connected  atomic.Bool
+
+	hits, misses, invalidations atomic.Uint64
+
+	// outgoing adds the credentials of the client to the invalidation stream
+	outgoing func(context.Context) context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func newNearCache(config NearCacheConfig, service cacheapiv1.CacheServiceClient, outgoing func(context.Context) context.Context) *nearCache {
+	if config.Capacity <= 0 {
+		config.Capacity = 255
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &nearCache{
+		store:    cache.NewCacheWithCapacity(config.Capacity),
+		ttl:      config.TTL,
+		onError:  config.OnError,
+		outgoing: outgoing,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	if len(config.Buckets) > 0 {
+		n.buckets = make(map[string]struct{}, len(config.Buckets))
+		for _, bucket := range config.Buckets {
+			n.buckets[bucket] = struct{}{}
+		}
+	}
+
+	go func() {
+		defer close(n.done)
+		n.run(ctx, service, config.Buckets)
+	}()
+	return n
+}
+
+func (n *nearCache) close() {
+	n.cancel()
+	<-n.done
+}
+
+// run follows the invalidation stream until ctx is done, reconnecting with backoff.
+func (n *nearCache) run(ctx context.Context, service cacheapiv1.CacheServiceClient, buckets []string) {
+	delay := minReconnectDelay
+	for {
+		connected, err := n.watch(ctx, service, buckets)
+		n.disconnect()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil && n.onError != nil {
+			n.onError(err)
+		}
+
+		// back off only while the server is unreachable
+		if connected {
+			delay = minReconnectDelay
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// watch applies invalidations until the stream ends, it reports whether it was connected and why it ended
+// unless the server closed it.
+func (n *nearCache) watch(ctx context.Context, service cacheapiv1.CacheServiceClient, buckets []string) (bool, error) {
+	stream, err := service.WatchInvalidations(n.outgoing(ctx), &cacheapiv1.WatchInvalidationsRequest{Buckets: buckets})
+	if err != nil {
+		return false, err
+	}
+	// the server sends headers once every later change is guaranteed to be streamed, there are
+	// none when the stream was refused and the error is returned by Recv
+	md, err := stream.Header()
+	if err != nil {
+		return false, err
+	}
+	if md == nil {
+		_, err := stream.Recv()
+		return false, err
+	}
+
+	n.invalidate("", "")
+	n.connected.Store(true)
+
+	for {
+		inv, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return true, nil
+		}
+		if err != nil {
+			return true, err
+		}
+		n.invalidations.Add(1)
+		n.invalidate(inv.Bucket, inv.Key)
+	}
+}
+
+func (n *nearCache) disconnect() {
+	n.connected.Store(false)
+	n.invalidate("", "")
+}
+
+// invalidate drops a key, a bucket when key is empty, or everything when bucket is empty too.
+func (n *nearCache) invalidate(bucket, key string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.generation++
+	if key == "" {
+		n.store.Flush(context.Background(), bucket)
+		return
+	}
+	n.store.Delete(context.Background(), bucket, key)
+}
+
+// get returns a local value, or the generation to pass to put once the value is read from the server.
+func (n *nearCache) get(bucket, key string) ([]byte, uint64, bool) {
+	if !n.caches(bucket) {
+		return nil, 0, false
+	}
+
+	n.mu.Lock()
+	generation := n.generation
+	n.mu.Unlock()
+
+	if n.connected.Load() {
+		if e, _ := n.store.Lookup(context.Background(), bucket, key); e != nil {
+			n.hits.Add(1)
+			return bytes.Clone(e.Value), generation, true
+		}
+	}
+	n.misses.Add(1)
+	return nil, generation, false
+}
+
+func (n *nearCache) put(bucket, key string, value []byte, generation uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if generation != n.generation || !n.connected.Load() || !n.caches(bucket) {
+		return
+	}
+	n.store.Set(context.Background(), bucket, key, bytes.Clone(value), cache.WithTTL(n.ttl), cache.WithEvictionPolicy(cache.EvictOldest))
+}
+
+// caches reports whether the values of bucket are held locally.
+func (n *nearCache) caches(bucket string) bool {
+	if n.buckets == nil {
+		return true
+	}
+	_, ok := n.buckets[bucket]
+	return ok
+}
+
+func (n *nearCache) stats() NearCacheStats {
+	return NearCacheStats{
+		Hits:          n.hits.Load(),
+		Misses:        n.misses.Load(),
+		Invalidations: n.invalidations.Load(),
+	}
+}
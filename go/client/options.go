@@ -0,0 +1,125 @@
+package client
+
+import (
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// RetryPolicy configures how failed calls are retried. Calls leave the cache in the same state when
+// they are retried, but a Delete whose first attempt removed the key before failing returns ErrNotFound.
+// A RESOURCE_EXHAUSTED error with a QuotaFailure detail is only retried when it also has a RetryInfo.
+// The delay before each retry is chosen at random up to a backoff that grows from InitialBackoff
+// by Multiplier up to MaxBackoff.
+type RetryPolicy struct {
+	// MaxAttempts includes the first attempt, 1 disables retries
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	RetryableCodes []codes.Code
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 50 * time.Millisecond,
+	MaxBackoff:     time.Second,
+	Multiplier:     2,
+	RetryableCodes: []codes.Code{codes.Unavailable, codes.ResourceExhausted},
+}
+
+const DefaultTimeout = 5 * time.Second
+
+type options struct {
+	dialOptions []grpc.DialOption
+	timeout     time.Duration
+	retry       RetryPolicy
+	userID      string
+	apiKey      string
+	nearCache   *NearCacheConfig
+}
+
+type Option func(*options)
+
+// WithDialOptions replaces the default dial options, which use an insecure connection.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) {
+		o.dialOptions = opts
+	}
+}
+
+// WithTimeout sets the default deadline of every call, including its retries, 0 disables it.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = policy
+	}
+}
+
+// WithAPIKey authenticates every call with a static API key, servers derive the user id of the
+// calls from it.
+func WithAPIKey(key string) Option {
+	return func(o *options) {
+		o.apiKey = key
+	}
+}
+
+// WithUserID sets the user id sent with calls whose context has none.
+//
+// Deprecated: servers derive the user id from the credentials of a call, use WithAPIKey.
+func WithUserID(userID string) Option {
+	return func(o *options) {
+		o.userID = userID
+	}
+}
+
+// WithNearCache serves repeated gets from an in-process cache that the server keeps up to date.
+func WithNearCache(config NearCacheConfig) Option {
+	return func(o *options) {
+		o.nearCache = &config
+	}
+}
+
+type EvictionPolicy int
+
+const (
+	EvictLRU EvictionPolicy = iota + 1
+	EvictMRU
+	EvictOldest
+	EvictNewest
+)
+
+type callOptions struct {
+	timeout        time.Duration
+	ttl            time.Duration
+	evictionPolicy EvictionPolicy
+}
+
+type CallOption func(*callOptions)
+
+// CallTimeout overrides the client timeout for a single call.
+func CallTimeout(timeout time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.timeout = timeout
+	}
+}
+
+// TTL expires a key set by the call, it is rounded up to whole seconds.
+func TTL(ttl time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.ttl = ttl
+	}
+}
+
+// Eviction selects the key evicted when a set finds its bucket at capacity.
+func Eviction(policy EvictionPolicy) CallOption {
+	return func(o *callOptions) {
+		o.evictionPolicy = policy
+	}
+}
@@ -1,9 +1,19 @@
 package main
 
 import (
+	"compress/gzip"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/cache"
+	"github.com/ahmedalhulaibi/cache-api/internal/replication"
+	"github.com/ahmedalhulaibi/cache-api/internal/tlsutil"
+	"github.com/ahmedalhulaibi/cache-api/internal/tracing"
 )
 
 type Config struct {
@@ -14,9 +24,124 @@ type Config struct {
 		GRPCAddr            string        `json:"grpc_addr" envconfig:"GRPC_ADDR" default:":8090" desc:"GRPC server listen address"`
 		Timeout             time.Duration `json:"timeout" envconfig:"TIMEOUT" default:"5s" desc:"Operation timeout"`
 		ShutdownTimeout     time.Duration `json:"shutdown_timeout" envconfig:"SHUTDOWN_TIMEOUT" default:"10s" desc:"Shutdown timeout"`
+		ShutdownDrainDelay  time.Duration `json:"shutdown_drain_delay" envconfig:"SHUTDOWN_DRAIN_DELAY" default:"5s" desc:"Time to report not ready before shutting down the servers"`
+		HealthCheckInterval time.Duration `json:"health_check_interval" envconfig:"HEALTH_CHECK_INTERVAL" default:"1s" desc:"Interval between readiness checks"`
 		InstanceID          string        `json:"instance_id" envconfig:"INSTANCE_ID" default:"" desc:"Instance ID"`
-		OpenCensusAgentHost string        `json:"oc_agent_host" envconfig:"OC_AGENT_HOST" default:"" desc:"OpenCensus agent host"`
 	} `json:"server" envconfig:"SERVER"`
+	Gateway struct {
+		CORSAllowedOrigins   []string      `json:"cors_allowed_origins" envconfig:"GATEWAY_CORS_ALLOWED_ORIGINS" default:"" desc:"Comma separated origins allowed to make cross-origin requests, * for any origin, empty to disable CORS"`
+		CORSAllowedMethods   []string      `json:"cors_allowed_methods" envconfig:"GATEWAY_CORS_ALLOWED_METHODS" default:"GET,POST,PUT,PATCH,DELETE" desc:"Comma separated methods allowed in cross-origin requests"`
+		CORSAllowedHeaders   []string      `json:"cors_allowed_headers" envconfig:"GATEWAY_CORS_ALLOWED_HEADERS" default:"Authorization,Content-Type,X-API-Key,X-Request-ID,traceparent,tracestate" desc:"Comma separated request headers allowed in cross-origin requests"`
+		CORSExposedHeaders   []string      `json:"cors_exposed_headers" envconfig:"GATEWAY_CORS_EXPOSED_HEADERS" default:"X-Request-ID,Retry-After" desc:"Comma separated response headers exposed to cross-origin callers"`
+		CORSAllowCredentials bool          `json:"cors_allow_credentials" envconfig:"GATEWAY_CORS_ALLOW_CREDENTIALS" default:"false" desc:"Allow credentials in cross-origin requests, not allowed with any origin"`
+		CORSMaxAge           time.Duration `json:"cors_max_age" envconfig:"GATEWAY_CORS_MAX_AGE" default:"10m" desc:"Time browsers cache the result of a preflight request"`
+		GzipEnabled          bool          `json:"gzip_enabled" envconfig:"GATEWAY_GZIP_ENABLED" default:"true" desc:"Compress the responses of clients that accept gzip"`
+		GzipLevel            int           `json:"gzip_level" envconfig:"GATEWAY_GZIP_LEVEL" default:"-1" desc:"Gzip compression level, from 1 to 9, -1 for the default level or -2 for Huffman only"`
+		GzipMinSize          int           `json:"gzip_min_size" envconfig:"GATEWAY_GZIP_MIN_SIZE" default:"1024" desc:"Response size in bytes below which responses are not compressed"`
+		MaxBodySize          int64         `json:"max_body_size" envconfig:"GATEWAY_MAX_BODY_SIZE" default:"4194304" desc:"Request body size in bytes above which requests are rejected, 0 for no limit"`
+		AccessLog            bool          `json:"access_log" envconfig:"GATEWAY_ACCESS_LOG" default:"true" desc:"Log every request"`
+		RedactedHeaders      []string      `json:"redacted_headers" envconfig:"GATEWAY_REDACTED_HEADERS" default:"Authorization,Cookie,Proxy-Authorization,X-API-Key" desc:"Comma separated request headers whose values are not logged"`
+	} `json:"gateway" envconfig:"GATEWAY"`
+	Tracing struct {
+		Exporter     string  `json:"exporter" envconfig:"TRACING_EXPORTER" default:"none" desc:"Span exporter: none, otlp, stdout or file"`
+		OTLPEndpoint string  `json:"otlp_endpoint" envconfig:"TRACING_OTLP_ENDPOINT" default:"localhost:4317" desc:"host:port of the OTLP/gRPC collector"`
+		OTLPInsecure bool    `json:"otlp_insecure" envconfig:"TRACING_OTLP_INSECURE" default:"false" desc:"Export to the collector without TLS"`
+		FilePath     string  `json:"file_path" envconfig:"TRACING_FILE_PATH" default:"traces.json" desc:"File the file exporter appends spans to"`
+		Sampler      string  `json:"sampler" envconfig:"TRACING_SAMPLER" default:"parentbased_always_on" desc:"Sampler: always_on, always_off, traceidratio, parentbased_always_on, parentbased_always_off or parentbased_traceidratio"`
+		SamplerRatio float64 `json:"sampler_ratio" envconfig:"TRACING_SAMPLER_RATIO" default:"1" desc:"Ratio of traces sampled by the traceidratio samplers"`
+	} `json:"tracing" envconfig:"TRACING"`
+	TLS struct {
+		Enabled        bool          `json:"enabled" envconfig:"TLS_ENABLED" default:"false" desc:"Serve GRPC and the gateway over TLS"`
+		CertPath       string        `json:"cert_path" envconfig:"TLS_CERT_PATH" default:"tls.crt" desc:"PEM certificate chain of the servers"`
+		KeyPath        string        `json:"key_path" envconfig:"TLS_KEY_PATH" default:"tls.key" desc:"PEM private key of the certificate"`
+		ClientCAPath   string        `json:"client_ca_path" envconfig:"TLS_CLIENT_CA_PATH" default:"" desc:"PEM bundle of the CAs that sign client certificates"`
+		ClientAuth     string        `json:"client_auth" envconfig:"TLS_CLIENT_AUTH" default:"none" desc:"Client certificate verification: none, optional or require"`
+		CAPath         string        `json:"ca_path" envconfig:"TLS_CA_PATH" default:"" desc:"PEM bundle of the CAs that sign the certificates of other instances, the system roots when empty"`
+		ReloadInterval time.Duration `json:"reload_interval" envconfig:"TLS_RELOAD_INTERVAL" default:"10s" desc:"Interval at which the certificate files are checked for changes"`
+	} `json:"tls" envconfig:"TLS"`
+	Auth struct {
+		APIKeysPath  string        `json:"api_keys_path" envconfig:"AUTH_API_KEYS_PATH" default:"" desc:"File with one user id and API key per line, empty to disable API keys"`
+		JWKSPath     string        `json:"jwks_path" envconfig:"AUTH_JWKS_PATH" default:"" desc:"JWKS file with the public keys that sign JWTs, empty to disable JWTs"`
+		JWTIssuer    string        `json:"jwt_issuer" envconfig:"AUTH_JWT_ISSUER" default:"" desc:"Required iss claim of JWTs, empty to accept any issuer"`
+		JWTAudience  string        `json:"jwt_audience" envconfig:"AUTH_JWT_AUDIENCE" default:"" desc:"Required aud claim of JWTs, empty to accept any audience"`
+		JWTUserClaim string        `json:"jwt_user_claim" envconfig:"AUTH_JWT_USER_CLAIM" default:"sub" desc:"JWT claim holding the user id"`
+		JWTLeeway    time.Duration `json:"jwt_leeway" envconfig:"AUTH_JWT_LEEWAY" default:"30s" desc:"Clock skew tolerated when checking the exp and nbf claims of JWTs"`
+		ClientCerts  bool          `json:"client_certs" envconfig:"AUTH_CLIENT_CERTS" default:"false" desc:"Verify callers by the common name or URI of their TLS client certificate"`
+		ACLPath      string        `json:"acl_path" envconfig:"AUTH_ACL_PATH" default:"" desc:"Access control list file, reloaded on SIGHUP, empty to allow every caller every operation"`
+	} `json:"auth" envconfig:"AUTH"`
+	Quotas struct {
+		Path string `json:"path" envconfig:"QUOTAS_PATH" default:"" desc:"Quota file with the limits of every principal, reloaded on SIGHUP, empty to disable quotas"`
+	} `json:"quotas" envconfig:"QUOTAS"`
+	RateLimit struct {
+		Global    float64            `json:"global" envconfig:"RATE_LIMIT_GLOBAL" default:"0" desc:"Requests per second allowed to the server, 0 for no limit"`
+		Methods   map[string]float64 `json:"methods" envconfig:"RATE_LIMIT_METHODS" default:"" desc:"Comma separated method:rps pairs, keyed by full method name or by method name for every service"`
+		PerCaller float64            `json:"per_caller" envconfig:"RATE_LIMIT_PER_CALLER" default:"0" desc:"Requests per second allowed to every caller, 0 for no limit"`
+	} `json:"rate_limit" envconfig:"RATE_LIMIT"`
+	LoadShedding struct {
+		Enabled          bool          `json:"enabled" envconfig:"LOAD_SHEDDING_ENABLED" default:"false" desc:"Shed requests over an adaptive limit on requests in flight"`
+		InitialLimit     int           `json:"initial_limit" envconfig:"LOAD_SHEDDING_INITIAL_LIMIT" default:"100" desc:"Requests in flight allowed on startup"`
+		MinLimit         int           `json:"min_limit" envconfig:"LOAD_SHEDDING_MIN_LIMIT" default:"10" desc:"Requests in flight the limit never drops below"`
+		MaxLimit         int           `json:"max_limit" envconfig:"LOAD_SHEDDING_MAX_LIMIT" default:"1000" desc:"Requests in flight the limit never grows above"`
+		LatencyThreshold time.Duration `json:"latency_threshold" envconfig:"LOAD_SHEDDING_LATENCY_THRESHOLD" default:"250ms" desc:"Latency above which a request decreases the limit"`
+		Backoff          float64       `json:"backoff" envconfig:"LOAD_SHEDDING_BACKOFF" default:"0.9" desc:"Factor the limit is multiplied by when a request is slow or times out"`
+		RetryAfter       time.Duration `json:"retry_after" envconfig:"LOAD_SHEDDING_RETRY_AFTER" default:"1s" desc:"Delay after which shed callers are told to retry"`
+	} `json:"load_shedding" envconfig:"LOAD_SHEDDING"`
+	Validation struct {
+		MaxKeyLength  int           `json:"max_key_length" envconfig:"VALIDATION_MAX_KEY_LENGTH" default:"250" desc:"Key length in bytes above which requests are rejected, 0 for no limit"`
+		MaxValueSize  int           `json:"max_value_size" envconfig:"VALIDATION_MAX_VALUE_SIZE" default:"1048576" desc:"Value size in bytes above which requests are rejected, 0 for no limit"`
+		MaxTTL        time.Duration `json:"max_ttl" envconfig:"VALIDATION_MAX_TTL" default:"0" desc:"TTL above which requests are rejected, 0 for no limit"`
+		BucketPattern string        `json:"bucket_pattern" envconfig:"VALIDATION_BUCKET_PATTERN" default:"^[A-Za-z0-9_.:-]{1,64}$" desc:"Pattern every bucket name must match, empty to accept any bucket"`
+	} `json:"validation" envconfig:"VALIDATION"`
+	Persistence struct {
+		AOFEnabled           bool   `json:"aof_enabled" envconfig:"AOF_ENABLED" default:"false" desc:"Enable the append-only operation log"`
+		AOFPath              string `json:"aof_path" envconfig:"AOF_PATH" default:"data/cache.aof" desc:"Append-only log file path"`
+		AOFFsync             string `json:"aof_fsync" envconfig:"AOF_FSYNC" default:"everysec" desc:"Append-only log fsync policy: always, everysec or never"`
+		AOFRewriteMinSize    int64  `json:"aof_rewrite_min_size" envconfig:"AOF_REWRITE_MIN_SIZE" default:"67108864" desc:"Append-only log size in bytes below which it is never rewritten"`
+		AOFRewritePercentage int    `json:"aof_rewrite_percentage" envconfig:"AOF_REWRITE_PERCENTAGE" default:"100" desc:"Append-only log growth since the last rewrite that triggers a rewrite, 0 disables rewriting"`
+	} `json:"persistence" envconfig:"PERSISTENCE"`
+	DiskTier struct {
+		Enabled     bool   `json:"enabled" envconfig:"DISK_TIER_ENABLED" default:"false" desc:"Spill keys evicted from memory to disk"`
+		Dir         string `json:"dir" envconfig:"DISK_TIER_DIR" default:"data/disk-tier" desc:"Directory of the disk tier segments, emptied on startup"`
+		MaxBytes    int64  `json:"max_bytes" envconfig:"DISK_TIER_MAX_BYTES" default:"1073741824" desc:"Disk tier size in bytes above which the oldest segment is dropped"`
+		SegmentSize int64  `json:"segment_size" envconfig:"DISK_TIER_SEGMENT_SIZE" default:"16777216" desc:"Disk tier segment size in bytes, at most a quarter of the max bytes"`
+	} `json:"disk_tier" envconfig:"DISK_TIER"`
+	Compression struct {
+		Enabled bool     `json:"enabled" envconfig:"COMPRESSION_ENABLED" default:"false" desc:"Compress stored values"`
+		Buckets []string `json:"buckets" envconfig:"COMPRESSION_BUCKETS" default:"" desc:"Comma separated buckets whose values are compressed, empty for every bucket"`
+		Codec   string   `json:"codec" envconfig:"COMPRESSION_CODEC" default:"gzip" desc:"Compression codec: gzip"`
+		MinSize int      `json:"min_size" envconfig:"COMPRESSION_MIN_SIZE" default:"1024" desc:"Value size in bytes below which values are stored raw"`
+	} `json:"compression" envconfig:"COMPRESSION"`
+	Encryption struct {
+		Enabled     bool     `json:"enabled" envconfig:"ENCRYPTION_ENABLED" default:"false" desc:"Encrypt stored values with AES-GCM"`
+		KeyringPath string   `json:"keyring_path" envconfig:"ENCRYPTION_KEYRING_PATH" default:"keyring" desc:"Keyring file with one id and base64 key per line, the last key is the newest"`
+		Buckets     []string `json:"buckets" envconfig:"ENCRYPTION_BUCKETS" default:"" desc:"Comma separated buckets whose values are encrypted, empty for every bucket"`
+	} `json:"encryption" envconfig:"ENCRYPTION"`
+	Replication struct {
+		Role              string        `json:"role" envconfig:"REPLICATION_ROLE" default:"" desc:"Replication role: primary, replica or empty to disable replication"`
+		PrimaryAddr       string        `json:"primary_addr" envconfig:"REPLICATION_PRIMARY_ADDR" default:"" desc:"GRPC address of the primary, required for replicas"`
+		BacklogSize       int           `json:"backlog_size" envconfig:"REPLICATION_BACKLOG_SIZE" default:"100000" desc:"Number of operations a primary retains for partial resync"`
+		HeartbeatInterval time.Duration `json:"heartbeat_interval" envconfig:"REPLICATION_HEARTBEAT_INTERVAL" default:"1s" desc:"Interval at which a primary reports its offset to replicas"`
+		APIKey            string        `json:"-" envconfig:"REPLICATION_API_KEY" default:"" desc:"API key a replica presents to a primary that requires authentication"`
+	} `json:"replication" envconfig:"REPLICATION"`
+	Cluster struct {
+		Enabled            bool          `json:"enabled" envconfig:"CLUSTER_ENABLED" default:"false" desc:"Shard keys across instances with a consistent-hash ring"`
+		SelfAddr           string        `json:"self_addr" envconfig:"CLUSTER_SELF_ADDR" default:"" desc:"GRPC address other members use to reach this instance, defaults to the hostname and GRPC port"`
+		Peers              []string      `json:"peers" envconfig:"CLUSTER_PEERS" default:"" desc:"Comma separated GRPC addresses of static members"`
+		DNSName            string        `json:"dns_name" envconfig:"CLUSTER_DNS_NAME" default:"" desc:"DNS name resolving to every member, members listen on the GRPC port"`
+		DNSRefreshInterval time.Duration `json:"dns_refresh_interval" envconfig:"CLUSTER_DNS_REFRESH_INTERVAL" default:"10s" desc:"Interval at which the DNS name is resolved"`
+		VirtualNodes       int           `json:"virtual_nodes" envconfig:"CLUSTER_VIRTUAL_NODES" default:"128" desc:"Virtual nodes per member on the ring"`
+		ShardBy            string        `json:"shard_by" envconfig:"CLUSTER_SHARD_BY" default:"key" desc:"Shard by key or by bucket"`
+	} `json:"cluster" envconfig:"CLUSTER"`
+	RESP struct {
+		Enabled       bool   `json:"enabled" envconfig:"RESP_ENABLED" default:"false" desc:"Serve the Redis protocol"`
+		Addr          string `json:"addr" envconfig:"RESP_ADDR" default:":6379" desc:"Redis protocol listen address"`
+		DefaultBucket string `json:"default_bucket" envconfig:"RESP_DEFAULT_BUCKET" default:"default" desc:"Bucket used until a client selects another one"`
+	} `json:"resp" envconfig:"RESP"`
+	Memcache struct {
+		Enabled bool   `json:"enabled" envconfig:"MEMCACHE_ENABLED" default:"false" desc:"Serve the memcached protocol"`
+		Addr    string `json:"addr" envconfig:"MEMCACHE_ADDR" default:":11211" desc:"Memcached protocol listen address"`
+		Bucket  string `json:"bucket" envconfig:"MEMCACHE_BUCKET" default:"default" desc:"Bucket served over the memcached protocol"`
+	} `json:"memcache" envconfig:"MEMCACHE"`
 }
 
 func parseConfig() (*Config, error) {
@@ -26,5 +151,101 @@ func parseConfig() (*Config, error) {
 		return nil, err
 	}
 
+	switch c.Replication.Role {
+	case "", replication.RolePrimary:
+	case replication.RoleReplica:
+		if c.Replication.PrimaryAddr == "" {
+			return nil, fmt.Errorf("REPLICATION_PRIMARY_ADDR is required for a replica")
+		}
+	default:
+		return nil, fmt.Errorf("unknown replication role %q", c.Replication.Role)
+	}
+
+	switch tlsutil.ClientAuth(c.TLS.ClientAuth) {
+	case tlsutil.ClientAuthNone:
+		if c.Auth.ClientCerts {
+			return nil, fmt.Errorf("AUTH_CLIENT_CERTS requires TLS_CLIENT_AUTH optional or require")
+		}
+	case tlsutil.ClientAuthOptional, tlsutil.ClientAuthRequire:
+		if c.TLS.ClientCAPath == "" {
+			return nil, fmt.Errorf("TLS_CLIENT_CA_PATH is required to verify client certificates")
+		}
+	default:
+		return nil, fmt.Errorf("unknown TLS_CLIENT_AUTH %q", c.TLS.ClientAuth)
+	}
+	if c.Auth.ClientCerts && !c.TLS.Enabled {
+		return nil, fmt.Errorf("AUTH_CLIENT_CERTS requires TLS_ENABLED")
+	}
+
+	if slices.Contains(c.Gateway.CORSAllowedOrigins, "*") && c.Gateway.CORSAllowCredentials {
+		return nil, fmt.Errorf("GATEWAY_CORS_ALLOW_CREDENTIALS cannot be used with any origin")
+	}
+	if _, err := gzip.NewWriterLevel(nil, c.Gateway.GzipLevel); c.Gateway.GzipEnabled && err != nil {
+		return nil, fmt.Errorf("invalid GATEWAY_GZIP_LEVEL: %w", err)
+	}
+
+	if ls := c.LoadShedding; ls.Enabled && (ls.MinLimit < 1 || ls.MaxLimit < ls.MinLimit || ls.Backoff <= 0 || ls.Backoff >= 1) {
+		return nil, fmt.Errorf("LOAD_SHEDDING_MIN_LIMIT must be positive, at most LOAD_SHEDDING_MAX_LIMIT, and LOAD_SHEDDING_BACKOFF between 0 and 1")
+	}
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout, tracing.ExporterFile:
+	default:
+		return nil, fmt.Errorf("unknown TRACING_EXPORTER %q", c.Tracing.Exporter)
+	}
+	if _, err := tracing.NewSampler(c.Tracing.Sampler, c.Tracing.SamplerRatio); err != nil {
+		return nil, fmt.Errorf("invalid TRACING_SAMPLER: %w", err)
+	}
+
+	if _, err := regexp.Compile(c.Validation.BucketPattern); err != nil {
+		return nil, fmt.Errorf("invalid VALIDATION_BUCKET_PATTERN: %w", err)
+	}
+
+	if c.Compression.Enabled {
+		if _, err := cache.CodecByName(c.Compression.Codec); err != nil {
+			return nil, err
+		}
+	}
+
+	if guards := c.guards(); len(guards) > 0 {
+		if c.RESP.Enabled {
+			return nil, fmt.Errorf("RESP_ENABLED cannot be used with %s", strings.Join(guards, ", "))
+		}
+		if c.Memcache.Enabled {
+			return nil, fmt.Errorf("MEMCACHE_ENABLED cannot be used with %s", strings.Join(guards, ", "))
+		}
+	}
+
 	return &c, nil
 }
+
+// guards returns the settings that protect or route the calls of the GRPC API and the gateway. The
+// Redis and memcached protocols are served straight from the store and would bypass them.
+func (c *Config) guards() []string {
+	var guards []string
+	if c.Auth.APIKeysPath != "" {
+		guards = append(guards, "AUTH_API_KEYS_PATH")
+	}
+	if c.Auth.JWKSPath != "" {
+		guards = append(guards, "AUTH_JWKS_PATH")
+	}
+	if c.Auth.ClientCerts {
+		guards = append(guards, "AUTH_CLIENT_CERTS")
+	}
+	if c.Auth.ACLPath != "" {
+		guards = append(guards, "AUTH_ACL_PATH")
+	}
+	if c.Quotas.Path != "" {
+		guards = append(guards, "QUOTAS_PATH")
+	}
+	if c.RateLimit.Global > 0 || c.RateLimit.PerCaller > 0 || len(c.RateLimit.Methods) > 0 {
+		guards = append(guards, "RATE_LIMIT_*")
+	}
+	if c.LoadShedding.Enabled {
+		guards = append(guards, "LOAD_SHEDDING_ENABLED")
+	}
+	if c.Cluster.Enabled {
+		guards = append(guards, "CLUSTER_ENABLED")
+	}
+	return guards
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfigProtocolGuards(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol string
+		env      map[string]string
+		err      string
+	}{
+		{
+			name:     "resp without guards",
+			protocol: "RESP_ENABLED",
+		},
+		{
+			name:     "memcache without guards",
+			protocol: "MEMCACHE_ENABLED",
+		},
+		{
+			name:     "api keys",
+			protocol: "RESP_ENABLED",
+			env:      map[string]string{"AUTH_API_KEYS_PATH": "api-keys"},
+			err:      "RESP_ENABLED cannot be used with AUTH_API_KEYS_PATH",
+		},
+		{
+			name:     "acl and quotas",
+			protocol: "RESP_ENABLED",
+			env:      map[string]string{"AUTH_ACL_PATH": "acl", "QUOTAS_PATH": "quotas"},
+			err:      "RESP_ENABLED cannot be used with AUTH_ACL_PATH, QUOTAS_PATH",
+		},
+		{
+			name:     "rate limit",
+			protocol: "RESP_ENABLED",
+			env:      map[string]string{"RATE_LIMIT_METHODS": "Get:10"},
+			err:      "RESP_ENABLED cannot be used with RATE_LIMIT_*",
+		},
+		{
+			name:     "load shedding",
+			protocol: "RESP_ENABLED",
+			env:      map[string]string{"LOAD_SHEDDING_ENABLED": "true"},
+			err:      "RESP_ENABLED cannot be used with LOAD_SHEDDING_ENABLED",
+		},
+		{
+			name:     "cluster",
+			protocol: "RESP_ENABLED",
+			env:      map[string]string{"CLUSTER_ENABLED": "true"},
+			err:      "RESP_ENABLED cannot be used with CLUSTER_ENABLED",
+		},
+		{
+			name:     "memcache with client certs",
+			protocol: "MEMCACHE_ENABLED",
+			env:      map[string]string{"AUTH_CLIENT_CERTS": "true", "TLS_ENABLED": "true", "TLS_CLIENT_AUTH": "require", "TLS_CLIENT_CA_PATH": "ca.crt"},
+			err:      "MEMCACHE_ENABLED cannot be used with AUTH_CLIENT_CERTS",
+		},
+		{
+			name:     "memcache with quotas",
+			protocol: "MEMCACHE_ENABLED",
+			env:      map[string]string{"QUOTAS_PATH": "quotas"},
+			err:      "MEMCACHE_ENABLED cannot be used with QUOTAS_PATH",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.protocol, "true")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			c, err := parseConfig()
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, c.RESP.Enabled || c.Memcache.Enabled)
+
+			// the guards can be used without the protocol
+			t.Setenv(tt.protocol, "false")
+			t.Setenv("AUTH_ACL_PATH", "acl")
+			_, err = parseConfig()
+			require.NoError(t, err)
+		})
+	}
+}
@@ -2,29 +2,59 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"maps"
 	"net"
 	"net/http"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/ahmedalhulaibi/loggy"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
-	"go.opencensus.io/plugin/ocgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 
+	"github.com/ahmedalhulaibi/cache-api/internal/auth"
 	"github.com/ahmedalhulaibi/cache-api/internal/cache"
+	"github.com/ahmedalhulaibi/cache-api/internal/cluster"
 	cacheapiv1 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v1"
+	cacheapiv2 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v2"
 	helloworldv1 "github.com/ahmedalhulaibi/cache-api/internal/gen/helloworld/v1"
 	"github.com/ahmedalhulaibi/cache-api/internal/greeter"
+	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/authn"
+	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/authz"
 	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/instanceid"
+	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/loadshed"
 	logmw "github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/log"
+	quotamw "github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/quota"
+	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/ratelimit"
+	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/ready"
 	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/requestid"
+	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/selector"
+	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/shutdown"
 	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/userid"
+	"github.com/ahmedalhulaibi/cache-api/internal/health"
 	httputilgrpcgateway "github.com/ahmedalhulaibi/cache-api/internal/httputil/grpcgateway"
+	"github.com/ahmedalhulaibi/cache-api/internal/httputil/middleware"
+	"github.com/ahmedalhulaibi/cache-api/internal/limit"
+	"github.com/ahmedalhulaibi/cache-api/internal/memcache"
+	"github.com/ahmedalhulaibi/cache-api/internal/replication"
+	"github.com/ahmedalhulaibi/cache-api/internal/resp"
+	"github.com/ahmedalhulaibi/cache-api/internal/tlsutil"
 	"github.com/ahmedalhulaibi/cache-api/internal/tracing"
 )
 
@@ -32,7 +62,8 @@ type container struct {
 	config *Config
 
 	state struct {
-		logger *loggy.Logger
+		logger         *loggy.Logger
+		tracerProvider *sdktrace.TracerProvider
 
 		grpcServer    *grpc.Server
 		gatewayRouter *runtime.ServeMux
@@ -43,10 +74,40 @@ type container struct {
 
 		greeterService helloworldv1.GreeterServiceServer
 		cacheService   cacheapiv1.CacheServiceServer
+		cacheServiceV2 cacheapiv2.CacheServiceServer
+
+		cacheStore    cache.Store
+		appendOnlyLog *cache.AppendOnlyLog
+		encryption    *cache.Encryption
+
+		replicationPrimary *replication.Primary
+		replicationReplica *replication.Replica
+
+		cluster *cluster.Cluster
+
+		certificates *tlsutil.Certificates
+
+		health   *health.Checker
+		restored atomic.Bool
+		// shutdown is closed when the grpc server starts to stop
+		shutdown chan struct{}
+
+		authenticator auth.Authenticator
+		accessControl *auth.ACL
+		quotas        *cache.Quotas
+
+		rateLimiter     *limit.RateLimiter
+		adaptiveLimiter *limit.AdaptiveLimiter
+
+		respServer   *resp.Server
+		respListener net.Listener
+
+		memcacheServer   *memcache.Server
+		memcacheListener net.Listener
 	}
 
 	once struct {
-		logger, grpcServer, gatewayRouter, gatewayServer, grpcListener, gatewayListener, greeterService, cacheService sync.Once
+		logger, tracerProvider, grpcServer, gatewayRouter, gatewayServer, grpcListener, gatewayListener, greeterService, cacheService, cacheServiceV2, cacheStore, appendOnlyLog, encryption, replicationPrimary, replicationReplica, cluster, certificates, health, drain, shutdown, authenticator, accessControl, quotas, rateLimiter, adaptiveLimiter, respServer, respListener, memcacheServer, memcacheListener sync.Once
 	}
 }
 
@@ -58,12 +119,222 @@ func newContainer(config *Config) *container {
 
 func (c *container) cacheService() cacheapiv1.CacheServiceServer {
 	c.once.cacheService.Do(func() {
-		c.state.cacheService = cache.NewCacheService(c.logger())
+		c.state.cacheService = cache.NewCacheService(c.logger(), c.servedStore(), c.cacheServiceOptions()...)
 	})
 
 	return c.state.cacheService
 }
 
+func (c *container) cacheServiceV2() cacheapiv2.CacheServiceServer {
+	c.once.cacheServiceV2.Do(func() {
+		c.state.cacheServiceV2 = cache.NewCacheServiceV2(c.logger(), c.servedStore(), c.cacheServiceOptions()...)
+	})
+
+	return c.state.cacheServiceV2
+}
+
+func (c *container) cacheServiceOptions() []cache.ServiceOption {
+	limits := cache.Limits{
+		MaxKeyLength: c.config.Validation.MaxKeyLength,
+		MaxValueSize: c.config.Validation.MaxValueSize,
+		MaxTTL:       c.config.Validation.MaxTTL,
+	}
+	if c.config.Validation.BucketPattern != "" {
+		limits.BucketPattern = regexp.MustCompile(c.config.Validation.BucketPattern)
+	}
+
+	opts := []cache.ServiceOption{cache.WithLimits(limits)}
+	switch c.config.Replication.Role {
+	case replication.RolePrimary:
+		opts = append(opts, cache.WithReplicationStats(c.replicationPrimary().Stats))
+	case replication.RoleReplica:
+		opts = append(opts, cache.WithReplicationStats(c.replicationReplica().Stats))
+	}
+	if cl := c.cluster(); cl != nil {
+		opts = append(opts, cache.WithRouter(cl))
+	}
+	if quotas := c.quotas(); quotas != nil {
+		opts = append(opts, cache.WithQuotas(quotas))
+	}
+	return opts
+}
+
+func (c *container) cacheStore() cache.Store {
+	c.once.cacheStore.Do(func() {
+		store := cache.NewCache()
+		if c.config.DiskTier.Enabled {
+			disk, err := cache.OpenDiskTier(cache.DiskTierConfig{
+				Dir:         c.config.DiskTier.Dir,
+				MaxBytes:    c.config.DiskTier.MaxBytes,
+				SegmentSize: c.config.DiskTier.SegmentSize,
+			})
+			if err != nil {
+				c.logger().Fatalw(context.Background(), "disk-tier", "dir", c.config.DiskTier.Dir, "err", err)
+			}
+			store.UseDiskTier(disk)
+		}
+		if c.config.Compression.Enabled {
+			codec, _ := cache.CodecByName(c.config.Compression.Codec)
+			compression := cache.Compression{Codec: codec, MinSize: c.config.Compression.MinSize}
+			if len(c.config.Compression.Buckets) == 0 {
+				store.UseCompression("", compression)
+			}
+			for _, bucket := range c.config.Compression.Buckets {
+				store.UseCompression(bucket, compression)
+			}
+		}
+		if e := c.encryption(); e != nil {
+			store.UseEncryption(e)
+		}
+		c.state.cacheStore = store
+	})
+
+	return c.state.cacheStore
+}
+
+// servedStore is the store exposed to clients, replicas only change through replication.
+func (c *container) servedStore() cache.Store {
+	if c.config.Replication.Role == replication.RoleReplica {
+		return cache.ReadOnly(c.cacheStore())
+	}
+	return c.cacheStore()
+}
+
+// encryption returns nil when encryption is disabled.
+func (c *container) encryption() *cache.Encryption {
+	c.once.encryption.Do(func() {
+		if !c.config.Encryption.Enabled {
+			return
+		}
+
+		keyring, err := cache.LoadKeyring(c.config.Encryption.KeyringPath)
+		if err != nil {
+			c.logger().Fatalw(context.Background(), "encryption-keyring", "path", c.config.Encryption.KeyringPath, "err", err)
+		}
+		c.state.encryption = &cache.Encryption{Keyring: keyring, Buckets: c.config.Encryption.Buckets}
+	})
+
+	return c.state.encryption
+}
+
+// appendOnlyLog returns nil when persistence is disabled. The log is replayed into the cache store before it is returned.
+func (c *container) appendOnlyLog() *cache.AppendOnlyLog {
+	c.once.appendOnlyLog.Do(func() {
+		if !c.config.Persistence.AOFEnabled {
+			return
+		}
+
+		ctx := context.Background()
+		aof, err := cache.OpenAppendOnlyLog(c.logger(), cache.AppendOnlyLogConfig{
+			Path:              c.config.Persistence.AOFPath,
+			Fsync:             cache.FsyncPolicy(c.config.Persistence.AOFFsync),
+			RewriteMinSize:    c.config.Persistence.AOFRewriteMinSize,
+			RewritePercentage: c.config.Persistence.AOFRewritePercentage,
+			Encryption:        c.encryption(),
+		})
+		if err != nil {
+			c.logger().Fatalw(ctx, "append-only-log", "path", c.config.Persistence.AOFPath, "err", err)
+		}
+
+		if err := aof.Replay(ctx, c.cacheStore()); err != nil {
+			c.logger().Fatalw(ctx, "append-only-log", "path", c.config.Persistence.AOFPath, "err", err)
+		}
+		aof.Attach(c.cacheStore())
+
+		c.state.appendOnlyLog = aof
+	})
+
+	return c.state.appendOnlyLog
+}
+
+// replicationPrimary returns nil unless this instance is a replication primary.
+func (c *container) replicationPrimary() *replication.Primary {
+	c.once.replicationPrimary.Do(func() {
+		if c.config.Replication.Role != replication.RolePrimary {
+			return
+		}
+
+		c.state.replicationPrimary = replication.NewPrimary(
+			c.logger(),
+			c.cacheStore(),
+			c.config.Replication.BacklogSize,
+			c.config.Replication.HeartbeatInterval,
+		)
+	})
+
+	return c.state.replicationPrimary
+}
+
+// replicationReplica returns nil unless this instance is a replica.
+func (c *container) replicationReplica() *replication.Replica {
+	c.once.replicationReplica.Do(func() {
+		if c.config.Replication.Role != replication.RoleReplica {
+			return
+		}
+
+		replicaID := c.config.Server.InstanceID
+		if replicaID == "" {
+			replicaID, _ = os.Hostname()
+		}
+
+		dialOptions := c.peerDialOptions()
+		if c.config.Replication.APIKey != "" {
+			dialOptions = append(dialOptions, grpc.WithPerRPCCredentials(auth.APIKeyCredentials(c.config.Replication.APIKey)))
+		}
+
+		c.state.replicationReplica = replication.NewReplica(
+			c.logger(),
+			c.cacheStore(),
+			c.config.Replication.PrimaryAddr,
+			replicaID,
+			dialOptions...,
+		)
+	})
+
+	return c.state.replicationReplica
+}
+
+// cluster returns nil unless cluster mode is enabled.
+func (c *container) cluster() *cluster.Cluster {
+	c.once.cluster.Do(func() {
+		if !c.config.Cluster.Enabled {
+			return
+		}
+
+		ctx := context.Background()
+		_, grpcPort, err := net.SplitHostPort(c.config.Server.GRPCAddr)
+		if err != nil {
+			c.logger().Fatalw(ctx, "cluster", "grpc_addr", c.config.Server.GRPCAddr, "err", err)
+		}
+
+		selfAddr := c.config.Cluster.SelfAddr
+		if selfAddr == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				c.logger().Fatalw(ctx, "cluster", "err", err)
+			}
+			selfAddr = net.JoinHostPort(hostname, grpcPort)
+		}
+
+		cl, err := cluster.New(c.logger(), cluster.Config{
+			SelfAddr:           selfAddr,
+			Peers:              c.config.Cluster.Peers,
+			DNSName:            c.config.Cluster.DNSName,
+			DNSPort:            grpcPort,
+			DNSRefreshInterval: c.config.Cluster.DNSRefreshInterval,
+			VirtualNodes:       c.config.Cluster.VirtualNodes,
+			ShardBy:            c.config.Cluster.ShardBy,
+		}, c.peerDialOptions()...)
+		if err != nil {
+			c.logger().Fatalw(ctx, "cluster", "err", err)
+		}
+
+		c.state.cluster = cl
+	})
+
+	return c.state.cluster
+}
+
 func (c *container) greeterService() helloworldv1.GreeterServiceServer {
 	c.once.greeterService.Do(func() {
 		c.state.greeterService = greeter.NewGreeter("Hello, %s! Ya filthy animal.")
@@ -96,21 +367,288 @@ func (c *container) logger() *loggy.Logger {
 	return c.state.logger
 }
 
+// health returns the checker of the readiness of this instance.
+func (c *container) health() *health.Checker {
+	c.once.health.Do(func() {
+		checker := health.NewChecker(
+			cacheapiv1.CacheService_ServiceDesc.ServiceName,
+			cacheapiv2.CacheService_ServiceDesc.ServiceName,
+		)
+		if c.config.Persistence.AOFEnabled {
+			checker.AddCheck("restore", c.restored)
+		}
+		if replica := c.replicationReplica(); replica != nil {
+			checker.AddCheck("replication", replica.Ready)
+		}
+		if cl := c.cluster(); cl != nil {
+			checker.AddCheck("cluster", cl.Ready)
+		}
+		c.state.health = checker
+	})
+
+	return c.state.health
+}
+
+// shutdown returns the channel closed when the grpc server starts to stop, which ends its open streams.
+func (c *container) shutdown() chan struct{} {
+	c.once.shutdown.Do(func() {
+		c.state.shutdown = make(chan struct{})
+	})
+
+	return c.state.shutdown
+}
+
+// restored returns an error until the store is restored from the append-only log.
+func (c *container) restored() error {
+	if c.config.Persistence.AOFEnabled && !c.state.restored.Load() {
+		return errors.New("replaying append-only log")
+	}
+	return nil
+}
+
+// certificates returns the TLS certificates of the servers, or nil when TLS is disabled.
+func (c *container) certificates() *tlsutil.Certificates {
+	c.once.certificates.Do(func() {
+		if !c.config.TLS.Enabled {
+			return
+		}
+
+		certs, err := tlsutil.Load(tlsutil.Config{
+			CertPath:     c.config.TLS.CertPath,
+			KeyPath:      c.config.TLS.KeyPath,
+			ClientCAPath: c.config.TLS.ClientCAPath,
+			ClientAuth:   tlsutil.ClientAuth(c.config.TLS.ClientAuth),
+			CAPath:       c.config.TLS.CAPath,
+		})
+		if err != nil {
+			c.logger().Fatalw(context.Background(), "tls", "err", err)
+		}
+		c.state.certificates = certs
+	})
+
+	return c.state.certificates
+}
+
+// peerDialOptions are the dial options of connections to other instances.
+func (c *container) peerDialOptions() []grpc.DialOption {
+	transportCredentials := insecure.NewCredentials()
+	if certs := c.certificates(); certs != nil {
+		transportCredentials = credentials.NewTLS(certs.PeerConfig())
+	}
+	return []grpc.DialOption{
+		grpc.WithTransportCredentials(transportCredentials),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler(
+			otelgrpc.WithTracerProvider(c.tracerProvider()),
+			otelgrpc.WithPropagators(tracing.Propagator()),
+		)),
+	}
+}
+
+// tracerProvider returns the tracer provider of every span of this instance, which is also
+// installed as the global tracer provider along with the trace context propagators.
+func (c *container) tracerProvider() *sdktrace.TracerProvider {
+	c.once.tracerProvider.Do(func() {
+		tp, err := tracing.NewTracerProvider(context.Background(), tracing.Config{
+			ServiceName:  c.config.Server.ServiceName,
+			InstanceID:   c.config.Server.InstanceID,
+			Exporter:     c.config.Tracing.Exporter,
+			OTLPEndpoint: c.config.Tracing.OTLPEndpoint,
+			OTLPInsecure: c.config.Tracing.OTLPInsecure,
+			FilePath:     c.config.Tracing.FilePath,
+			Sampler:      c.config.Tracing.Sampler,
+			SamplerRatio: c.config.Tracing.SamplerRatio,
+		})
+		if err != nil {
+			c.logger().Fatalw(context.Background(), "tracing", "err", err)
+		}
+		otel.SetTracerProvider(tp)
+		otel.SetTextMapPropagator(tracing.Propagator())
+
+		c.state.tracerProvider = tp
+	})
+
+	return c.state.tracerProvider
+}
+
+// authenticator returns the authenticator of API calls, or nil when authentication is disabled.
+func (c *container) authenticator() auth.Authenticator {
+	c.once.authenticator.Do(func() {
+		var chain auth.Chain
+		if c.config.Auth.APIKeysPath != "" {
+			keys, err := auth.LoadAPIKeys(c.config.Auth.APIKeysPath)
+			if err != nil {
+				c.logger().Fatalw(context.Background(), "authenticator", "err", err)
+			}
+			chain = append(chain, keys)
+		}
+		if c.config.Auth.JWKSPath != "" {
+			jwt, err := auth.LoadJWT(c.config.Auth.JWKSPath, auth.JWTConfig{
+				Issuer:    c.config.Auth.JWTIssuer,
+				Audience:  c.config.Auth.JWTAudience,
+				UserClaim: c.config.Auth.JWTUserClaim,
+				Leeway:    c.config.Auth.JWTLeeway,
+			})
+			if err != nil {
+				c.logger().Fatalw(context.Background(), "authenticator", "err", err)
+			}
+			chain = append(chain, jwt)
+		}
+		if c.config.Auth.ClientCerts {
+			chain = append(chain, auth.ClientCerts{Proxy: c.certificates().Own})
+		}
+		if len(chain) > 0 {
+			c.state.authenticator = chain
+		}
+	})
+
+	return c.state.authenticator
+}
+
+// accessControl returns the access control list of API calls, or nil when authorization is disabled.
+func (c *container) accessControl() *auth.ACL {
+	c.once.accessControl.Do(func() {
+		if c.config.Auth.ACLPath == "" {
+			return
+		}
+
+		acl, err := auth.LoadACL(c.config.Auth.ACLPath)
+		if err != nil {
+			c.logger().Fatalw(context.Background(), "access-control", "err", err)
+		}
+		c.state.accessControl = acl
+	})
+
+	return c.state.accessControl
+}
+
+// quotas returns the quotas of principals, or nil when quotas are disabled.
+func (c *container) quotas() *cache.Quotas {
+	c.once.quotas.Do(func() {
+		if c.config.Quotas.Path == "" {
+			return
+		}
+
+		quotas, err := cache.LoadQuotas(c.config.Quotas.Path, c.servedStore())
+		if err != nil {
+			c.logger().Fatalw(context.Background(), "quotas", "err", err)
+		}
+		c.state.quotas = quotas
+	})
+
+	return c.state.quotas
+}
+
+// rateLimiter returns the rate limiter of API calls, or nil when no rate limit is set.
+func (c *container) rateLimiter() *limit.RateLimiter {
+	c.once.rateLimiter.Do(func() {
+		limits := limit.RateLimits{
+			Global:    c.config.RateLimit.Global,
+			Methods:   c.config.RateLimit.Methods,
+			PerCaller: c.config.RateLimit.PerCaller,
+		}
+		if limits.Global <= 0 && len(limits.Methods) == 0 && limits.PerCaller <= 0 {
+			return
+		}
+		c.state.rateLimiter = limit.NewRateLimiter(limits)
+	})
+
+	return c.state.rateLimiter
+}
+
+// adaptiveLimiter returns the limiter that sheds API calls, or nil when load shedding is disabled.
+func (c *container) adaptiveLimiter() *limit.AdaptiveLimiter {
+	c.once.adaptiveLimiter.Do(func() {
+		if !c.config.LoadShedding.Enabled {
+			return
+		}
+		c.state.adaptiveLimiter = limit.NewAdaptiveLimiter(limit.AdaptiveConfig{
+			InitialLimit:     c.config.LoadShedding.InitialLimit,
+			MinLimit:         c.config.LoadShedding.MinLimit,
+			MaxLimit:         c.config.LoadShedding.MaxLimit,
+			LatencyThreshold: c.config.LoadShedding.LatencyThreshold,
+			Backoff:          c.config.LoadShedding.Backoff,
+			RetryAfter:       c.config.LoadShedding.RetryAfter,
+		})
+	})
+
+	return c.state.adaptiveLimiter
+}
+
 func (c *container) grpcServer() *grpc.Server {
 	c.once.grpcServer.Do(func() {
-		c.state.grpcServer = grpc.NewServer(
-			grpc.StatsHandler(&ocgrpc.ServerHandler{}),
-			grpc.ChainUnaryInterceptor(
-				requestid.RequestIdUnaryServerInterceptor(c.logger()),
-				instanceid.InstanceIdUnaryServerInterceptor(c.logger(), c.config.Server.InstanceID),
-				userid.UserIdUnaryServerInterceptor(c.logger()),
-				tracing.NewOpenCensusTraceInterceptor(c.logger()),
-				logmw.LoggerUnaryServerInterceptor(c.logger()),
-			),
+		unary := []grpc.UnaryServerInterceptor{
+			requestid.RequestIdUnaryServerInterceptor(c.logger()),
+			instanceid.InstanceIdUnaryServerInterceptor(c.logger(), c.config.Server.InstanceID),
+		}
+		// every call but health checks waits for the store to be restored, is authenticated and limited
+		guardedUnary := []grpc.UnaryServerInterceptor{ready.ReadyUnaryServerInterceptor(c.logger(), c.restored)}
+		guardedStream := []grpc.StreamServerInterceptor{ready.ReadyStreamServerInterceptor(c.logger(), c.restored)}
+		// shed before any work is spent on a call, rate limit once the caller is known
+		if limiter := c.adaptiveLimiter(); limiter != nil {
+			guardedUnary = append(guardedUnary, loadshed.LoadShedUnaryServerInterceptor(c.logger(), limiter))
+		}
+		if authenticator := c.authenticator(); authenticator != nil {
+			guardedUnary = append(guardedUnary, authn.AuthnUnaryServerInterceptor(c.logger(), authenticator))
+			guardedStream = append(guardedStream, authn.AuthnStreamServerInterceptor(c.logger(), authenticator))
+		}
+		if limiter := c.rateLimiter(); limiter != nil {
+			guardedUnary = append(guardedUnary, ratelimit.RateLimitUnaryServerInterceptor(c.logger(), limiter))
+			guardedStream = append(guardedStream, ratelimit.RateLimitStreamServerInterceptor(c.logger(), limiter))
+		}
+		if acl := c.accessControl(); acl != nil {
+			methods := auth.MethodPermissions{}
+			maps.Copy(methods, cache.MethodPermissions)
+			maps.Copy(methods, replication.MethodPermissions)
+			maps.Copy(methods, cluster.MethodPermissions)
+			guardedUnary = append(guardedUnary, authz.AuthzUnaryServerInterceptor(c.logger(), acl, methods))
+			guardedStream = append(guardedStream, authz.AuthzStreamServerInterceptor(c.logger(), acl, methods))
+		}
+		if quotas := c.quotas(); quotas != nil {
+			guardedUnary = append(guardedUnary, quotamw.QuotaUnaryServerInterceptor(c.logger(), quotas))
+			guardedStream = append(guardedStream, quotamw.QuotaStreamServerInterceptor(c.logger(), quotas))
+		}
+		guarded := func(fullMethod string) bool {
+			return !strings.HasPrefix(fullMethod, "/"+health.ServiceName+"/")
+		}
+		stream := []grpc.StreamServerInterceptor{
+			shutdown.ShutdownStreamServerInterceptor(c.logger(), c.shutdown()),
+			requestid.RequestIdStreamServerInterceptor(c.logger()),
+			instanceid.InstanceIdStreamServerInterceptor(c.logger(), c.config.Server.InstanceID),
+			selector.SelectStreamServerInterceptor(guarded, guardedStream...),
+			userid.UserIdStreamServerInterceptor(c.logger()),
+			tracing.TraceStreamServerInterceptor(c.logger()),
+			logmw.LoggerStreamServerInterceptor(c.logger()),
+		}
+		unary = append(unary,
+			selector.SelectUnaryServerInterceptor(guarded, guardedUnary...),
+			userid.UserIdUnaryServerInterceptor(c.logger()),
+			tracing.TraceUnaryServerInterceptor(c.logger()),
+			logmw.LoggerUnaryServerInterceptor(c.logger()),
 		)
 
+		opts := []grpc.ServerOption{
+			grpc.StatsHandler(otelgrpc.NewServerHandler(
+				otelgrpc.WithTracerProvider(c.tracerProvider()),
+				otelgrpc.WithPropagators(tracing.Propagator()),
+			)),
+			grpc.ChainUnaryInterceptor(unary...),
+			grpc.ChainStreamInterceptor(stream...),
+		}
+		if certs := c.certificates(); certs != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(certs.ServerConfig())))
+		}
+		c.state.grpcServer = grpc.NewServer(opts...)
+
 		helloworldv1.RegisterGreeterServiceServer(c.state.grpcServer, c.greeterService())
 		cacheapiv1.RegisterCacheServiceServer(c.state.grpcServer, c.cacheService())
+		cacheapiv2.RegisterCacheServiceServer(c.state.grpcServer, c.cacheServiceV2())
+		if primary := c.replicationPrimary(); primary != nil {
+			cacheapiv1.RegisterReplicationServiceServer(c.state.grpcServer, primary)
+		}
+		if cl := c.cluster(); cl != nil {
+			cacheapiv1.RegisterClusterServiceServer(c.state.grpcServer, cl)
+		}
+		healthpb.RegisterHealthServer(c.state.grpcServer, c.health().Server())
 		reflection.Register(c.state.grpcServer)
 	})
 
@@ -121,12 +659,28 @@ func (c *container) gatewayRouter() *runtime.ServeMux {
 	c.once.gatewayRouter.Do(func() {
 		c.state.gatewayRouter = runtime.NewServeMux(
 			runtime.WithIncomingHeaderMatcher(httputilgrpcgateway.CustomMatcher),
+			runtime.WithOutgoingHeaderMatcher(httputilgrpcgateway.OutgoingMatcher),
+			runtime.WithMetadata(httputilgrpcgateway.ClientCertAnnotator),
+			runtime.WithMetadata(httputilgrpcgateway.RouteAnnotator),
+			runtime.WithErrorHandler(httputilgrpcgateway.ErrorHandler),
+			runtime.WithRoutingErrorHandler(httputilgrpcgateway.RoutingErrorHandler),
 		)
 
+		// the gateway presents the certificate of the server, which the GRPC server trusts to forward client certificates
+		transportCredentials := insecure.NewCredentials()
+		if certs := c.certificates(); certs != nil {
+			transportCredentials = credentials.NewTLS(certs.LoopbackConfig())
+		}
+
 		ctx := context.Background()
 		conn, err := grpc.NewClient(
-			fmt.Sprintf("0.0.0.0%s", c.config.Server.GRPCAddr),
-			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			c.grpcLoopbackAddr(),
+			grpc.WithTransportCredentials(transportCredentials),
+			// continues the trace of the HTTP request in the GRPC server
+			grpc.WithStatsHandler(otelgrpc.NewClientHandler(
+				otelgrpc.WithTracerProvider(c.tracerProvider()),
+				otelgrpc.WithPropagators(tracing.Propagator()),
+			)),
 		)
 		if err != nil {
 			c.logger().Fatalw(ctx, "gateway-router", "err", err)
@@ -149,30 +703,112 @@ func (c *container) gatewayRouter() *runtime.ServeMux {
 		if err != nil {
 			c.logger().Fatalw(context.Background(), "gateway-router", "err", err)
 		}
+
+		err = cacheapiv2.RegisterCacheServiceHandler(
+			ctx,
+			c.state.gatewayRouter,
+			conn,
+		)
+		if err != nil {
+			c.logger().Fatalw(context.Background(), "gateway-router", "err", err)
+		}
+
+		if c.config.Cluster.Enabled {
+			err = cacheapiv1.RegisterClusterServiceHandler(
+				ctx,
+				c.state.gatewayRouter,
+				conn,
+			)
+			if err != nil {
+				c.logger().Fatalw(context.Background(), "gateway-router", "err", err)
+			}
+		}
 	})
 
 	return c.state.gatewayRouter
 }
 
+// grpcLoopbackAddr is the address the gateway dials the GRPC server on, loopback when the server
+// listens on every interface.
+func (c *container) grpcLoopbackAddr() string {
+	addr := c.grpcListener().Addr().(*net.TCPAddr)
+	if addr.IP.IsUnspecified() {
+		return net.JoinHostPort("127.0.0.1", strconv.Itoa(addr.Port))
+	}
+	return addr.String()
+}
+
 func (c *container) gatewayServer() *http.Server {
 	c.once.gatewayServer.Do(func() {
-		gatewayRouter := c.gatewayRouter()
+		var api http.Handler = c.gatewayRouter()
+		if authenticator := c.authenticator(); authenticator != nil {
+			api = middleware.NewAuthenticator(c.logger(), authenticator)(api)
+		}
+
+		// probes are not authenticated
+		handler := http.NewServeMux()
+		handler.Handle("GET /healthz", c.health().LivenessHandler())
+		handler.Handle("GET /readyz", c.health().ReadinessHandler())
+		handler.Handle("/", middleware.Chain(api, c.gatewayMiddlewares()...))
+
+		// the span of a request continues the trace of its traceparent or B3 headers and is the parent
+		// of the span of the GRPC call it is routed to
+		traced := otelhttp.NewHandler(handler, "gateway",
+			otelhttp.WithTracerProvider(c.tracerProvider()),
+			otelhttp.WithPropagators(tracing.Propagator()),
+			otelhttp.WithFilter(func(r *http.Request) bool {
+				return r.URL.Path != "/healthz" && r.URL.Path != "/readyz"
+			}),
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+				return r.Method
+			}),
+		)
+
+		var tlsConfig *tls.Config
+		if certs := c.certificates(); certs != nil {
+			tlsConfig = certs.ServerConfig()
+		}
 
 		c.state.gatewayServer = &http.Server{
 			Addr:         c.config.Server.GatewayAddr,
 			ReadTimeout:  c.config.Server.Timeout,
 			WriteTimeout: c.config.Server.Timeout,
-			Handler:      gatewayRouter,
-			// Handler: &ochttp.Handler{
-			// 	Handler:     gatewayRouter,
-			// 	Propagation: &b3.HTTPFormat{},
-			// },
+			Handler:      traced,
+			TLSConfig:    tlsConfig,
 		}
 	})
 
 	return c.state.gatewayServer
 }
 
+// gatewayMiddlewares wrap the API served by the gateway, outermost first. CORS preflight requests are
+// answered before authentication, which browsers do not send credentials to.
+func (c *container) gatewayMiddlewares() []func(http.Handler) http.Handler {
+	config := c.config.Gateway
+	middlewares := []func(http.Handler) http.Handler{
+		middleware.NewRequestID(c.logger()),
+		middleware.NewRecoverer(c.logger()),
+	}
+	if config.AccessLog {
+		middlewares = append(middlewares, middleware.NewLogger(c.logger(), config.RedactedHeaders...))
+	}
+	middlewares = append(middlewares,
+		middleware.NewCORS(middleware.CORSConfig{
+			AllowedOrigins:   config.CORSAllowedOrigins,
+			AllowedMethods:   config.CORSAllowedMethods,
+			AllowedHeaders:   config.CORSAllowedHeaders,
+			ExposedHeaders:   config.CORSExposedHeaders,
+			AllowCredentials: config.CORSAllowCredentials,
+			MaxAge:           config.CORSMaxAge,
+		}),
+		middleware.NewMaxBodySize(config.MaxBodySize),
+	)
+	if config.GzipEnabled {
+		middlewares = append(middlewares, middleware.NewGzip(config.GzipLevel, config.GzipMinSize))
+	}
+	return middlewares
+}
+
 func (c *container) gatewayListener() net.Listener {
 	c.once.gatewayListener.Do(func() {
 		listener, err := net.Listen("tcp", c.config.Server.GatewayAddr)
@@ -186,6 +822,48 @@ func (c *container) gatewayListener() net.Listener {
 	return c.state.gatewayListener
 }
 
+func (c *container) respServer() *resp.Server {
+	c.once.respServer.Do(func() {
+		c.state.respServer = resp.NewServer(c.logger(), c.servedStore(), c.config.RESP.DefaultBucket)
+	})
+
+	return c.state.respServer
+}
+
+func (c *container) respListener() net.Listener {
+	c.once.respListener.Do(func() {
+		listener, err := net.Listen("tcp", c.config.RESP.Addr)
+		if err != nil {
+			c.logger().Fatalw(context.Background(), "resp-listener", "addr", c.config.RESP.Addr, "err", err)
+		}
+
+		c.state.respListener = listener
+	})
+
+	return c.state.respListener
+}
+
+func (c *container) memcacheServer() *memcache.Server {
+	c.once.memcacheServer.Do(func() {
+		c.state.memcacheServer = memcache.NewServer(c.logger(), c.servedStore(), c.config.Memcache.Bucket)
+	})
+
+	return c.state.memcacheServer
+}
+
+func (c *container) memcacheListener() net.Listener {
+	c.once.memcacheListener.Do(func() {
+		listener, err := net.Listen("tcp", c.config.Memcache.Addr)
+		if err != nil {
+			c.logger().Fatalw(context.Background(), "memcache-listener", "addr", c.config.Memcache.Addr, "err", err)
+		}
+
+		c.state.memcacheListener = listener
+	})
+
+	return c.state.memcacheListener
+}
+
 func (c *container) grpcListener() net.Listener {
 	c.once.grpcListener.Do(func() {
 		listener, err := net.Listen("tcp", c.config.Server.GRPCAddr)
@@ -3,15 +3,17 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"contrib.go.opencensus.io/exporter/ocagent"
-	"go.opencensus.io/trace"
 	"golang.org/x/sync/errgroup"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/memcache"
+	"github.com/ahmedalhulaibi/cache-api/internal/resp"
 )
 
 func main() {
@@ -23,16 +25,7 @@ func main() {
 
 	container := newContainer(config)
 
-	// TODO: swap out for opentelemetry generic exporter when otel collector is ready
-	if oce, err := ocagent.NewExporter(
-		ocagent.WithInsecure(),
-		ocagent.WithReconnectionPeriod(5*time.Second),
-		ocagent.WithAddress(config.Server.OpenCensusAgentHost),
-		ocagent.WithServiceName(config.Server.ServiceName),
-	); err == nil {
-		trace.RegisterExporter(oce)
-		trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
-	}
+	tracerProvider := container.tracerProvider()
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
@@ -40,15 +33,225 @@ func main() {
 	if err := run(ctx, container); err != nil {
 		container.logger().Errorw(ctx, "run", "err", err)
 	}
+
+	// flush the spans of the calls that completed during shutdown
+	sctx, scancel := context.WithTimeout(context.Background(), config.Server.ShutdownTimeout)
+	defer scancel()
+	if err := tracerProvider.Shutdown(sctx); err != nil {
+		container.logger().Errorw(ctx, "tracing shutdown", "err", err)
+	}
 }
 
 func run(ctx context.Context, c *container) error {
 	errg, ctx := errgroup.WithContext(ctx)
 
+	// the GRPC and gateway servers start first so that probes are answered while the store is
+	// restored, everything else that touches the store waits for the restore
+	runHealth(ctx, errg, c)
+	runReload(ctx, errg, c)
+	runCertificateReload(ctx, errg, c)
+	runCluster(ctx, errg, c)
 	runGRPCServer(ctx, errg, c)
 	runGatewayServer(ctx, errg, c)
 
-	return errg.Wait()
+	errg.Go(func() error {
+		runAppendOnlyLog(ctx, errg, c)
+		c.state.restored.Store(true)
+		c.logger().Infow(ctx, "store restored")
+
+		runReencryption(ctx, errg, c)
+		runReplication(ctx, errg, c)
+		runRESPServer(ctx, errg, c)
+		runMemcacheServer(ctx, errg, c)
+		return nil
+	})
+
+	err := errg.Wait()
+
+	// the log is closed once every server has stopped, so that the writes acknowledged while they
+	// shut down are persisted
+	if c.config.Persistence.AOFEnabled {
+		if cerr := c.appendOnlyLog().Close(); cerr != nil {
+			c.logger().Errorw(ctx, "failed to close append-only log", "path", c.config.Persistence.AOFPath, "err", cerr)
+		}
+	}
+	return err
+}
+
+func runHealth(ctx context.Context, errg *errgroup.Group, c *container) {
+	checker := c.health()
+
+	errg.Go(func() error {
+		return checker.Run(ctx, c.config.Server.HealthCheckInterval)
+	})
+}
+
+// drain marks the instance as not ready and waits for load balancers to stop routing to it before
+// the servers are shut down. Every server keeps serving writes until then, the append-only log is
+// only closed once they have all stopped.
+func drain(ctx context.Context, c *container) {
+	c.once.drain.Do(func() {
+		c.health().Shutdown()
+		c.logger().Infow(ctx, "draining", "delay", c.config.Server.ShutdownDrainDelay)
+		time.Sleep(c.config.Server.ShutdownDrainDelay)
+	})
+}
+
+func runAppendOnlyLog(ctx context.Context, errg *errgroup.Group, c *container) {
+	aof := c.appendOnlyLog()
+	if aof == nil {
+		return
+	}
+
+	errg.Go(func() error {
+		return aof.Run(ctx)
+	})
+}
+
+// runReencryption migrates the values encrypted with older keys to the newest key and rewrites the
+// append-only log so that it no longer depends on them. It runs on startup and every time SIGHUP
+// reloads the keyring.
+func runReencryption(ctx context.Context, errg *errgroup.Group, c *container) {
+	e := c.encryption()
+	if e == nil {
+		return
+	}
+	store, ok := c.cacheStore().(interface{ Reencrypt() (int, error) })
+	if !ok {
+		return
+	}
+
+	reencrypt := func() {
+		n, err := store.Reencrypt()
+		if err != nil {
+			c.logger().Errorw(ctx, "reencryption failed", "key_id", e.Keyring.Newest(), "err", err)
+			return
+		}
+		c.logger().Infow(ctx, "reencrypted values", "key_id", e.Keyring.Newest(), "count", n)
+
+		if aof := c.appendOnlyLog(); aof != nil {
+			if err := aof.Rewrite(); err != nil {
+				c.logger().Errorw(ctx, "failed to rewrite append-only log", "path", c.config.Persistence.AOFPath, "err", err)
+			}
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	errg.Go(func() error {
+		defer signal.Stop(hup)
+
+		reencrypt()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-hup:
+				if err := e.Keyring.Reload(); err != nil {
+					c.logger().Errorw(ctx, "failed to reload encryption keyring", "path", c.config.Encryption.KeyringPath, "err", err)
+					continue
+				}
+				reencrypt()
+			}
+		}
+	})
+}
+
+// runReload reloads the access control list, the quotas and the TLS certificates every time SIGHUP is received.
+func runReload(ctx context.Context, errg *errgroup.Group, c *container) {
+	type reloader struct {
+		name, path string
+		reload     func() error
+	}
+	var reloaders []reloader
+	if acl := c.accessControl(); acl != nil {
+		reloaders = append(reloaders, reloader{"access control list", c.config.Auth.ACLPath, acl.Reload})
+	}
+	if quotas := c.quotas(); quotas != nil {
+		reloaders = append(reloaders, reloader{"quotas", c.config.Quotas.Path, quotas.Reload})
+	}
+	if certs := c.certificates(); certs != nil {
+		reloaders = append(reloaders, reloader{"tls certificates", c.config.TLS.CertPath, certs.Reload})
+	}
+	if len(reloaders) == 0 {
+		return
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	errg.Go(func() error {
+		defer signal.Stop(hup)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-hup:
+				for _, r := range reloaders {
+					if err := r.reload(); err != nil {
+						c.logger().Errorw(ctx, "failed to reload "+r.name, "path", r.path, "err", err)
+						continue
+					}
+					c.logger().Infow(ctx, "reloaded "+r.name, "path", r.path)
+				}
+			}
+		}
+	})
+}
+
+// runCertificateReload reloads the TLS certificates when their files change.
+func runCertificateReload(ctx context.Context, errg *errgroup.Group, c *container) {
+	certs := c.certificates()
+	if certs == nil || c.config.TLS.ReloadInterval <= 0 {
+		return
+	}
+
+	errg.Go(func() error {
+		ticker := time.NewTicker(c.config.TLS.ReloadInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				if !certs.Modified() {
+					continue
+				}
+				if err := certs.Reload(); err != nil {
+					c.logger().Errorw(ctx, "failed to reload tls certificates", "path", c.config.TLS.CertPath, "err", err)
+					continue
+				}
+				c.logger().Infow(ctx, "reloaded tls certificates", "path", c.config.TLS.CertPath)
+			}
+		}
+	})
+}
+
+func runReplication(ctx context.Context, errg *errgroup.Group, c *container) {
+	replica := c.replicationReplica()
+	if replica == nil {
+		return
+	}
+
+	c.logger().Infow(ctx, "starting replication", "primary", c.config.Replication.PrimaryAddr)
+	errg.Go(func() error {
+		return replica.Run(ctx)
+	})
+}
+
+func runCluster(ctx context.Context, errg *errgroup.Group, c *container) {
+	cl := c.cluster()
+	if cl == nil {
+		return
+	}
+
+	c.logger().Infow(ctx, "starting cluster membership", "members", cl.Ring().Members())
+	errg.Go(func() error {
+		return cl.Run(ctx)
+	})
 }
 
 func runGRPCServer(ctx context.Context, errg *errgroup.Group, c *container) {
@@ -60,13 +263,25 @@ func runGRPCServer(ctx context.Context, errg *errgroup.Group, c *container) {
 
 	errg.Go(func() error {
 		<-ctx.Done()
+		drain(ctx, c)
 
 		sctx, cancel := context.WithTimeout(context.Background(), c.config.Server.ShutdownTimeout)
 		defer cancel()
 
-		grpcServer.GracefulStop()
-		<-sctx.Done()
-		grpcServer.Stop()
+		// open streams are ended so that they do not hold up the graceful stop, which is still cut short
+		// when calls outlast the timeout
+		close(c.shutdown())
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-sctx.Done():
+			c.logger().Warnw(ctx, "grpc server graceful stop timed out", "addr", grpcAddr, "timeout", c.config.Server.ShutdownTimeout)
+			grpcServer.Stop()
+		}
 
 		c.logger().Infow(ctx, "grpc server shutdown", "addr", grpcAddr)
 		return nil
@@ -90,6 +305,7 @@ func runGatewayServer(ctx context.Context, errg *errgroup.Group, c *container) {
 
 	errg.Go(func() error {
 		<-ctx.Done()
+		drain(ctx, c)
 
 		sctx, cancel := context.WithTimeout(context.Background(), c.config.Server.ShutdownTimeout)
 		defer cancel()
@@ -103,7 +319,81 @@ func runGatewayServer(ctx context.Context, errg *errgroup.Group, c *container) {
 	})
 
 	errg.Go(func() error {
-		if err := gatewayServer.Serve(gatewayListener); err != nil && err != http.ErrServerClosed {
+		serve := gatewayServer.Serve
+		if gatewayServer.TLSConfig != nil {
+			serve = func(l net.Listener) error { return gatewayServer.ServeTLS(l, "", "") }
+		}
+		if err := serve(gatewayListener); err != nil && err != http.ErrServerClosed {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func runRESPServer(ctx context.Context, errg *errgroup.Group, c *container) {
+	if !c.config.RESP.Enabled {
+		return
+	}
+
+	respServer := c.respServer()
+
+	respListener := c.respListener()
+	respAddr := respListener.Addr().String()
+	c.logger().Infow(ctx, "starting resp server", "addr", respAddr)
+
+	errg.Go(func() error {
+		<-ctx.Done()
+		drain(ctx, c)
+
+		sctx, cancel := context.WithTimeout(context.Background(), c.config.Server.ShutdownTimeout)
+		defer cancel()
+
+		if err := respServer.Shutdown(sctx); err != nil {
+			return fmt.Errorf("resp shutdown: %w", err)
+		}
+
+		c.logger().Infow(ctx, "resp server shutdown", "addr", respAddr)
+		return nil
+	})
+
+	errg.Go(func() error {
+		if err := respServer.Serve(respListener); err != nil && err != resp.ErrServerClosed {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func runMemcacheServer(ctx context.Context, errg *errgroup.Group, c *container) {
+	if !c.config.Memcache.Enabled {
+		return
+	}
+
+	memcacheServer := c.memcacheServer()
+
+	memcacheListener := c.memcacheListener()
+	memcacheAddr := memcacheListener.Addr().String()
+	c.logger().Infow(ctx, "starting memcache server", "addr", memcacheAddr)
+
+	errg.Go(func() error {
+		<-ctx.Done()
+		drain(ctx, c)
+
+		sctx, cancel := context.WithTimeout(context.Background(), c.config.Server.ShutdownTimeout)
+		defer cancel()
+
+		if err := memcacheServer.Shutdown(sctx); err != nil {
+			return fmt.Errorf("memcache shutdown: %w", err)
+		}
+
+		c.logger().Infow(ctx, "memcache server shutdown", "addr", memcacheAddr)
+		return nil
+	})
+
+	errg.Go(func() error {
+		if err := memcacheServer.Serve(memcacheListener); err != nil && err != memcache.ErrServerClosed {
 			return err
 		}
 
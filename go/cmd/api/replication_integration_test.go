@@ -0,0 +1,106 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	cacheapiv1 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v1"
+)
+
+func buildAPI(t *testing.T) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "api")
+	out, err := exec.Command("go", "build", "-o", bin, ".").CombinedOutput()
+	require.NoError(t, err, string(out))
+	return bin
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	return lis.Addr().String()
+}
+
+// startAPI runs the api binary with env and returns a client for its grpc address. The gateway
+// listens on a free address unless env sets ADDR.
+func startAPI(t *testing.T, bin string, env ...string) (cacheapiv1.CacheServiceClient, string) {
+	t.Helper()
+	grpcAddr := freeAddr(t)
+
+	cmd := exec.Command(bin)
+	cmd.Env = append(os.Environ(), append([]string{"ADDR=" + freeAddr(t)}, append(env, "GRPC_ADDR="+grpcAddr)...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		cmd.Process.Signal(os.Interrupt)
+		cmd.Wait()
+	})
+
+	conn, err := grpc.NewClient(grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	client := cacheapiv1.NewCacheServiceClient(conn)
+	require.Eventually(t, func() bool {
+		_, err := client.GetStats(context.Background(), &cacheapiv1.GetStatsRequest{})
+		return err == nil
+	}, 10*time.Second, 50*time.Millisecond)
+
+	return client, grpcAddr
+}
+
+func TestReplicationAcrossProcesses(t *testing.T) {
+	ctx := context.Background()
+	bin := buildAPI(t)
+
+	primary, primaryAddr := startAPI(t, bin, "REPLICATION_ROLE=primary", "INSTANCE_ID=primary")
+	_, err := primary.Set(ctx, &cacheapiv1.SetRequest{Bucket: "bucket1", Key: "key1", Value: "value1"})
+	require.NoError(t, err)
+
+	replicas := make([]cacheapiv1.CacheServiceClient, 2)
+	for i := range replicas {
+		replicas[i], _ = startAPI(t, bin, "REPLICATION_ROLE=replica", "REPLICATION_PRIMARY_ADDR="+primaryAddr, fmt.Sprintf("INSTANCE_ID=replica-%d", i))
+	}
+
+	_, err = primary.Set(ctx, &cacheapiv1.SetRequest{Bucket: "bucket1", Key: "key2", Value: "value2"})
+	require.NoError(t, err)
+
+	for _, replica := range replicas {
+		for key, value := range map[string]string{"key1": "value1", "key2": "value2"} {
+			require.Eventually(t, func() bool {
+				resp, err := replica.Get(ctx, &cacheapiv1.GetRequest{Bucket: "bucket1", Key: key})
+				return err == nil && resp.Value == value
+			}, 10*time.Second, 50*time.Millisecond, key)
+		}
+
+		_, err := replica.Set(ctx, &cacheapiv1.SetRequest{Bucket: "bucket1", Key: "key3", Value: "value3"})
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+		stats, err := replica.GetStats(ctx, &cacheapiv1.GetStatsRequest{})
+		require.NoError(t, err)
+		require.Equal(t, "replica", stats.Replication.Role)
+		require.True(t, stats.Replication.Connected)
+		require.Zero(t, stats.Replication.Lag)
+	}
+
+	stats, err := primary.GetStats(ctx, &cacheapiv1.GetStatsRequest{})
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), stats.Replication.ConnectedReplicas)
+}
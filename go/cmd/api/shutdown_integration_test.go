@@ -0,0 +1,135 @@
+//go:build integration
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	cacheapiv1 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v1"
+)
+
+// startStoppableAPI runs the api binary like startAPI and returns a function that interrupts it and
+// waits for it to exit.
+func startStoppableAPI(t *testing.T, bin string, env ...string) (cacheapiv1.CacheServiceClient, string, func()) {
+	t.Helper()
+	grpcAddr := freeAddr(t)
+
+	cmd := exec.Command(bin)
+	cmd.Env = append(os.Environ(), append([]string{"ADDR=" + freeAddr(t)}, append(env, "GRPC_ADDR="+grpcAddr)...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	require.NoError(t, cmd.Start())
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		<-exited
+	})
+
+	conn, err := grpc.NewClient(grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	client := cacheapiv1.NewCacheServiceClient(conn)
+	require.Eventually(t, func() bool {
+		_, err := client.GetStats(context.Background(), &cacheapiv1.GetStatsRequest{})
+		return err == nil
+	}, 10*time.Second, 50*time.Millisecond)
+
+	stop := func() {
+		t.Helper()
+		require.NoError(t, cmd.Process.Signal(os.Interrupt))
+		select {
+		case <-exited:
+		case <-time.After(10 * time.Second):
+			t.Fatal("shutdown did not complete")
+		}
+	}
+	return client, grpcAddr, stop
+}
+
+func TestShutdownEndsOpenStreams(t *testing.T) {
+	ctx := context.Background()
+	bin := buildAPI(t)
+
+	client, grpcAddr, stop := startStoppableAPI(t, bin, "REPLICATION_ROLE=primary", "SHUTDOWN_DRAIN_DELAY=0s", "SHUTDOWN_TIMEOUT=30s")
+
+	// a replica sync and an invalidation watch stay open until the server stops
+	startAPI(t, bin, "REPLICATION_ROLE=replica", "REPLICATION_PRIMARY_ADDR="+grpcAddr)
+	require.Eventually(t, func() bool {
+		stats, err := client.GetStats(ctx, &cacheapiv1.GetStatsRequest{})
+		return err == nil && stats.Replication.ConnectedReplicas == 1
+	}, 10*time.Second, 50*time.Millisecond)
+
+	watch, err := client.WatchInvalidations(ctx, &cacheapiv1.WatchInvalidationsRequest{})
+	require.NoError(t, err)
+	_, err = watch.Header()
+	require.NoError(t, err)
+
+	stop()
+
+	_, err = watch.Recv()
+	require.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestShutdownPersistsDrainWrites(t *testing.T) {
+	ctx := context.Background()
+	bin := buildAPI(t)
+	memcacheAddr := freeAddr(t)
+	env := []string{"AOF_ENABLED=true", "AOF_PATH=" + filepath.Join(t.TempDir(), "cache.aof"), "SHUTDOWN_DRAIN_DELAY=2s",
+		"MEMCACHE_ENABLED=true", "MEMCACHE_ADDR=" + memcacheAddr, "MEMCACHE_BUCKET=bucket1"}
+
+	client, grpcAddr, stop := startStoppableAPI(t, bin, env...)
+	_, err := client.Set(ctx, &cacheapiv1.SetRequest{Bucket: "bucket1", Key: "key1", Value: "value1"})
+	require.NoError(t, err)
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		stop()
+	}()
+
+	// calls are still served while the instance drains and reports not serving
+	conn, err := grpc.NewClient(grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Eventually(t, func() bool {
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		return err == nil && resp.Status == healthpb.HealthCheckResponse_NOT_SERVING
+	}, time.Second, 10*time.Millisecond)
+	_, err = client.Set(ctx, &cacheapiv1.SetRequest{Bucket: "bucket1", Key: "key2", Value: "value2"})
+	require.NoError(t, err)
+
+	mc, err := net.Dial("tcp", memcacheAddr)
+	require.NoError(t, err)
+	defer mc.Close()
+	_, err = mc.Write([]byte("set key3 0 0 6\r\nvalue3\r\n"))
+	require.NoError(t, err)
+	reply, err := bufio.NewReader(mc).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "STORED\r\n", reply)
+	<-stopped
+
+	client, _, _ = startStoppableAPI(t, bin, env...)
+	for key, value := range map[string]string{"key1": "value1", "key2": "value2", "key3": "value3"} {
+		resp, err := client.Get(ctx, &cacheapiv1.GetRequest{Bucket: "bucket1", Key: key})
+		require.NoError(t, err)
+		require.Equal(t, value, resp.Value, key)
+	}
+}
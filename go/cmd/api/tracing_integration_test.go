@@ -0,0 +1,99 @@
+//go:build integration
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// exportedSpan is a span written by the file exporter.
+type exportedSpan struct {
+	Name        string
+	SpanKind    int
+	SpanContext struct{ TraceID, SpanID string }
+	Parent      struct{ TraceID, SpanID string }
+}
+
+// readSpans reads the spans of trace traceID written to path.
+func readSpans(t *testing.T, path, traceID string) []exportedSpan {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var spans []exportedSpan
+	dec := json.NewDecoder(bufio.NewReader(bytes.NewReader(data)))
+	for dec.More() {
+		var span exportedSpan
+		require.NoError(t, dec.Decode(&span))
+		if span.SpanContext.TraceID == traceID {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func TestTracePropagationThroughGateway(t *testing.T) {
+	const (
+		traceID  = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentID = "00f067aa0ba902b7"
+	)
+	bin := buildAPI(t)
+	tracesPath := filepath.Join(t.TempDir(), "traces.json")
+	gatewayAddr := freeAddr(t)
+	startAPI(t, bin, "ADDR="+gatewayAddr, "TRACING_EXPORTER=file", "TRACING_FILE_PATH="+tracesPath)
+
+	for _, header := range []http.Header{
+		{"Traceparent": {"00-" + traceID + "-" + parentID + "-01"}},
+		{"X-B3-Traceid": {traceID}, "X-B3-Spanid": {parentID}, "X-B3-Sampled": {"1"}},
+	} {
+		req, err := http.NewRequest(http.MethodPost, "http://"+gatewayAddr+"/v1/set", strings.NewReader(`{"bucket":"b","key":"k","value":"v"}`))
+		require.NoError(t, err)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	// HTTP server span -> gateway GRPC client span -> GRPC server span, for each request
+	var spans []exportedSpan
+	require.Eventually(t, func() bool {
+		spans = readSpans(t, tracesPath, traceID)
+		return len(spans) >= 6
+	}, 15*time.Second, 100*time.Millisecond)
+
+	byID := map[string]exportedSpan{}
+	for _, span := range spans {
+		byID[span.SpanContext.SpanID] = span
+	}
+
+	var servers int
+	for _, span := range spans {
+		if span.Name != "cacheapi.v1.CacheService/Set" || span.SpanKind != 2 {
+			continue
+		}
+		servers++
+
+		client := byID[span.Parent.SpanID]
+		require.Equal(t, "cacheapi.v1.CacheService/Set", client.Name)
+		require.Equal(t, 3, client.SpanKind)
+
+		gateway := byID[client.Parent.SpanID]
+		require.Equal(t, "POST /v1/set", gateway.Name)
+		require.Equal(t, parentID, gateway.Parent.SpanID)
+	}
+	require.Equal(t, 2, servers)
+}
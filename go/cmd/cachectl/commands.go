@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ahmedalhulaibi/cache-api/client"
+)
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, e *env, args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"get":     {"<bucket> <key>", cmdGet},
+		"set":     {"[-ttl duration] [-f file] <bucket> <key> [value], reads the value from stdin when it is - or missing", cmdSet},
+		"delete":  {"<bucket> <key>", cmdDelete},
+		"stats":   {"", cmdStats},
+		"buckets": {"", cmdBuckets},
+		"keys":    {"[-prefix prefix] <bucket>", cmdKeys},
+		"export":  {"[-bucket bucket] [-f file], writes every key as a JSON line", cmdExport},
+		"import":  {"[-ttl duration] [-f file], reads keys written by export", cmdImport},
+		"quotas":  {"[principal]", cmdQuotas},
+	}
+}
+
+// flags parses the flags of a command and checks the number of positional arguments.
+func flags(e *env, name string, args []string, minArgs, maxArgs int, define func(fs *flag.FlagSet)) ([]string, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage: cachectl %s %s\n", name, commands[name].usage)
+		fs.PrintDefaults()
+	}
+	if define != nil {
+		define(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() < minArgs || fs.NArg() > maxArgs {
+		fs.Usage()
+		return nil, flag.ErrHelp
+	}
+	return fs.Args(), nil
+}
+
+func cmdGet(ctx context.Context, e *env, args []string) error {
+	args, err := flags(e, "get", args, 2, 2, nil)
+	if err != nil {
+		return err
+	}
+
+	value, err := e.client.Get(ctx, args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	return e.write(view{
+		header: []string{"BUCKET", "KEY", "VALUE"},
+		rows:   [][]string{{args[0], args[1], string(value)}},
+		json:   record{Bucket: args[0], Key: args[1], Value: string(value)},
+		raw:    value,
+	})
+}
+
+func cmdSet(ctx context.Context, e *env, args []string) error {
+	var ttl time.Duration
+	var file string
+	args, err := flags(e, "set", args, 2, 3, func(fs *flag.FlagSet) {
+		fs.DurationVar(&ttl, "ttl", 0, "expire the key after ttl")
+		fs.StringVar(&file, "f", "", "read the value from file")
+	})
+	if err != nil {
+		return err
+	}
+
+	var value []byte
+	switch {
+	case file != "":
+		if len(args) == 3 {
+			return fmt.Errorf("a value and -f are mutually exclusive")
+		}
+		if value, err = os.ReadFile(file); err != nil {
+			return err
+		}
+	case len(args) == 2 || args[2] == "-":
+		if value, err = io.ReadAll(e.stdin); err != nil {
+			return err
+		}
+	default:
+		value = []byte(args[2])
+	}
+
+	return e.client.Set(ctx, args[0], args[1], value, client.TTL(ttl))
+}
+
+func cmdDelete(ctx context.Context, e *env, args []string) error {
+	args, err := flags(e, "delete", args, 2, 2, nil)
+	if err != nil {
+		return err
+	}
+	return e.client.Delete(ctx, args[0], args[1])
+}
+
+type statsView struct {
+	Hits              uint64  `json:"hits"`
+	Misses            uint64  `json:"misses"`
+	Evictions         uint64  `json:"evictions"`
+	Expired           uint64  `json:"expired"`
+	DiskHits          uint64  `json:"disk_hits"`
+	DiskMisses        uint64  `json:"disk_misses"`
+	Bytes             uint64  `json:"bytes"`
+	UncompressedBytes uint64  `json:"uncompressed_bytes"`
+	CompressionRatio  float64 `json:"compression_ratio"`
+}
+
+func cmdStats(ctx context.Context, e *env, args []string) error {
+	if _, err := flags(e, "stats", args, 0, 0, nil); err != nil {
+		return err
+	}
+
+	s, err := e.client.Stats(ctx)
+	if err != nil {
+		return err
+	}
+
+	values := []string{
+		strconv.FormatUint(s.Hits, 10),
+		strconv.FormatUint(s.Misses, 10),
+		strconv.FormatUint(s.Evictions, 10),
+		strconv.FormatUint(s.Expired, 10),
+		strconv.FormatUint(s.DiskHits, 10),
+		strconv.FormatUint(s.DiskMisses, 10),
+		strconv.FormatUint(s.Bytes, 10),
+		strconv.FormatFloat(s.CompressionRatio, 'f', 2, 64),
+	}
+	return e.write(view{
+		header: []string{"HITS", "MISSES", "EVICTIONS", "EXPIRED", "DISK_HITS", "DISK_MISSES", "BYTES", "RATIO"},
+		rows:   [][]string{values},
+		json: statsView{
+			Hits:              s.Hits,
+			Misses:            s.Misses,
+			Evictions:         s.Evictions,
+			Expired:           s.Expired,
+			DiskHits:          s.DiskHits,
+			DiskMisses:        s.DiskMisses,
+			Bytes:             s.Bytes,
+			UncompressedBytes: s.UncompressedBytes,
+			CompressionRatio:  s.CompressionRatio,
+		},
+		raw: fmt.Appendf(nil, "hits %s\nmisses %s\nevictions %s\nexpired %s\ndisk_hits %s\ndisk_misses %s\nbytes %s\ncompression_ratio %s\n", values[0], values[1], values[2], values[3], values[4], values[5], values[6], values[7]),
+	})
+}
+
+type quotaView struct {
+	Principal            string  `json:"principal"`
+	Buckets              int     `json:"buckets"`
+	Keys                 int     `json:"keys"`
+	Bytes                uint64  `json:"bytes"`
+	MaxBuckets           int     `json:"max_buckets"`
+	MaxKeys              int     `json:"max_keys"`
+	MaxBytes             uint64  `json:"max_bytes"`
+	MaxRequestsPerSecond float64 `json:"max_requests_per_second"`
+}
+
+func cmdQuotas(ctx context.Context, e *env, args []string) error {
+	args, err := flags(e, "quotas", args, 0, 1, nil)
+	if err != nil {
+		return err
+	}
+
+	var principal string
+	if len(args) == 1 {
+		principal = args[0]
+	}
+	usages, err := e.client.QuotaUsage(ctx, principal)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(usages))
+	views := make([]quotaView, 0, len(usages))
+	var raw []byte
+	for _, u := range usages {
+		values := []string{
+			u.Principal,
+			strconv.Itoa(u.Buckets),
+			strconv.Itoa(u.Keys),
+			strconv.FormatUint(u.Bytes, 10),
+			strconv.Itoa(u.MaxBuckets),
+			strconv.Itoa(u.MaxKeys),
+			strconv.FormatUint(u.MaxBytes, 10),
+			strconv.FormatFloat(u.MaxRequestsPerSecond, 'f', -1, 64),
+		}
+		rows = append(rows, values)
+		views = append(views, quotaView(u))
+		raw = fmt.Appendf(raw, "%s buckets=%s keys=%s bytes=%s\n", values[0], values[1], values[2], values[3])
+	}
+	return e.write(view{
+		header: []string{"PRINCIPAL", "BUCKETS", "KEYS", "BYTES", "MAX_BUCKETS", "MAX_KEYS", "MAX_BYTES", "MAX_RPS"},
+		rows:   rows,
+		json:   views,
+		raw:    raw,
+	})
+}
+
+func cmdBuckets(ctx context.Context, e *env, args []string) error {
+	if _, err := flags(e, "buckets", args, 0, 0, nil); err != nil {
+		return err
+	}
+
+	buckets, err := e.client.ListBuckets(ctx)
+	if err != nil {
+		return err
+	}
+
+	return e.write(view{
+		header: []string{"BUCKET"},
+		rows:   column(buckets),
+		json:   nonNil(buckets),
+		raw:    lines(buckets),
+	})
+}
+
+func cmdKeys(ctx context.Context, e *env, args []string) error {
+	var prefix string
+	args, err := flags(e, "keys", args, 1, 1, func(fs *flag.FlagSet) {
+		fs.StringVar(&prefix, "prefix", "", "only list keys starting with prefix")
+	})
+	if err != nil {
+		return err
+	}
+
+	keys, err := e.client.ListKeys(ctx, args[0], prefix)
+	if err != nil {
+		return err
+	}
+
+	return e.write(view{
+		header: []string{"KEY"},
+		rows:   column(keys),
+		json:   nonNil(keys),
+		raw:    lines(keys),
+	})
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// record is a key as written by export and read by import.
+type record struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+}
+
+// cmdExport writes every key as a JSON line, expiries are not exported.
+func cmdExport(ctx context.Context, e *env, args []string) error {
+	var bucket, file string
+	if _, err := flags(e, "export", args, 0, 0, func(fs *flag.FlagSet) {
+		fs.StringVar(&bucket, "bucket", "", "only export bucket")
+		fs.StringVar(&file, "f", "", "write to file instead of stdout")
+	}); err != nil {
+		return err
+	}
+
+	buckets := []string{bucket}
+	if bucket == "" {
+		var err error
+		if buckets, err = e.client.ListBuckets(ctx); err != nil {
+			return err
+		}
+	}
+
+	out := e.stdout
+	if file != "" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	enc := json.NewEncoder(w)
+
+	var n int
+	for _, b := range buckets {
+		keys, err := e.client.ListKeys(ctx, b, "")
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			value, err := e.client.Get(ctx, b, key)
+			if errors.Is(err, client.ErrNotFound) {
+				// deleted or expired since it was listed
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := enc.Encode(record{Bucket: b, Key: key, Value: string(value)}); err != nil {
+				return err
+			}
+			n++
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stderr, "exported %d keys\n", n)
+	return nil
+}
+
+func cmdImport(ctx context.Context, e *env, args []string) error {
+	var ttl time.Duration
+	var file string
+	if _, err := flags(e, "import", args, 0, 0, func(fs *flag.FlagSet) {
+		fs.DurationVar(&ttl, "ttl", 0, "expire imported keys after ttl")
+		fs.StringVar(&file, "f", "", "read from file instead of stdin")
+	}); err != nil {
+		return err
+	}
+
+	in := e.stdin
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(in))
+	var n int
+	for {
+		var r record
+		err := dec.Decode(&r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("record %d: %w", n+1, err)
+		}
+		if err := e.client.Set(ctx, r.Bucket, r.Key, []byte(r.Value), client.TTL(ttl)); err != nil {
+			return fmt.Errorf("record %d: %w", n+1, err)
+		}
+		n++
+	}
+
+	fmt.Fprintf(e.stderr, "imported %d keys\n", n)
+	return nil
+}
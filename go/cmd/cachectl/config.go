@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputRaw   = "raw"
+)
+
+type Config struct {
+	Addr    string        `json:"addr" envconfig:"CACHECTL_ADDR" default:"localhost:8090" desc:"GRPC address of the cache server"`
+	Timeout time.Duration `json:"timeout" envconfig:"CACHECTL_TIMEOUT" default:"5s" desc:"Timeout of every call, including retries"`
+	Output  string        `json:"output" envconfig:"CACHECTL_OUTPUT" default:"table" desc:"Output format: table, json or raw"`
+	APIKey  string        `json:"-" envconfig:"CACHECTL_API_KEY" default:"" desc:"API key sent with every call"`
+	TLS     bool          `json:"tls" envconfig:"CACHECTL_TLS" default:"false" desc:"Connect over TLS"`
+	CAPath  string        `json:"ca_path" envconfig:"CACHECTL_TLS_CA_PATH" default:"" desc:"PEM bundle of the CAs that sign the server certificate, the system roots when empty"`
+	Cert    string        `json:"cert_path" envconfig:"CACHECTL_TLS_CERT_PATH" default:"" desc:"PEM client certificate presented to the server"`
+	Key     string        `json:"key_path" envconfig:"CACHECTL_TLS_KEY_PATH" default:"" desc:"PEM private key of the client certificate"`
+}
+
+// parseConfig reads the configuration from the environment and then from the global flags in args,
+// it returns the arguments following the flags.
+func parseConfig(args []string, stderr io.Writer) (*Config, []string, error) {
+	var c Config
+
+	if err := envconfig.Process("", &c); err != nil {
+		return nil, nil, err
+	}
+
+	fs := flag.NewFlagSet("cachectl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { usage(fs) }
+	fs.StringVar(&c.Addr, "addr", c.Addr, "GRPC address of the cache server (CACHECTL_ADDR)")
+	fs.DurationVar(&c.Timeout, "timeout", c.Timeout, "timeout of every call, including retries (CACHECTL_TIMEOUT)")
+	fs.StringVar(&c.Output, "o", c.Output, "output format: table, json or raw (CACHECTL_OUTPUT)")
+	fs.StringVar(&c.APIKey, "api-key", c.APIKey, "API key sent with every call (CACHECTL_API_KEY)")
+	fs.BoolVar(&c.TLS, "tls", c.TLS, "connect over TLS (CACHECTL_TLS)")
+	fs.StringVar(&c.CAPath, "ca", c.CAPath, "PEM bundle of the CAs that sign the server certificate, the system roots when empty (CACHECTL_TLS_CA_PATH)")
+	fs.StringVar(&c.Cert, "cert", c.Cert, "PEM client certificate presented to the server (CACHECTL_TLS_CERT_PATH)")
+	fs.StringVar(&c.Key, "key", c.Key, "PEM private key of the client certificate (CACHECTL_TLS_KEY_PATH)")
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	switch c.Output {
+	case outputTable, outputJSON, outputRaw:
+	default:
+		return nil, nil, fmt.Errorf("unknown output format %q", c.Output)
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return nil, nil, flag.ErrHelp
+	}
+
+	return &c, fs.Args(), nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/ahmedalhulaibi/cache-api/client"
+	"github.com/ahmedalhulaibi/cache-api/internal/tlsutil"
+)
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	cancel()
+	os.Exit(code)
+}
+
+// env is what commands run with.
+type env struct {
+	client *client.Client
+	config *Config
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func (e *env) write(v view) error {
+	return write(e.stdout, e.config.Output, v)
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	config, args, err := parseConfig(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q, run cachectl -h for usage\n", args[0])
+		return 2
+	}
+
+	opts := []client.Option{client.WithTimeout(config.Timeout), client.WithAPIKey(config.APIKey)}
+	if config.TLS || config.CAPath != "" || config.Cert != "" {
+		tlsConfig, err := tlsutil.ClientConfig(config.CAPath, config.Cert, config.Key)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		opts = append(opts, client.WithDialOptions(grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))))
+	}
+
+	c, err := client.New(config.Addr, opts...)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer c.Close()
+
+	e := &env{client: c, config: config, stdin: stdin, stdout: stdout, stderr: stderr}
+	if err := cmd.run(ctx, e, args[1:]); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(stderr, "%s: %v\n", args[0], err)
+		}
+		return 1
+	}
+	return 0
+}
+
+func usage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprintf(out, "Usage: cachectl [flags] <command> [arguments]\n\nCommands:\n")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-8s %s\n", name, commands[name].usage)
+	}
+
+	fmt.Fprintf(out, "\nFlags:\n")
+	fs.PrintDefaults()
+}
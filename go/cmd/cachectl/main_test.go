@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/cache"
+	cacheapiv1 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v1"
+)
+
+func startServer(t *testing.T) string {
+	t.Helper()
+	l := loggy.New(zap.NewNop().Sugar())
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	cacheapiv1.RegisterCacheServiceServer(srv, cache.NewCacheService(&l, cache.NewCache()))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	return lis.Addr().String()
+}
+
+// cachectl runs the command line against addr and returns the exit code, stdout and stderr.
+func cachectl(t *testing.T, addr, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), append([]string{"-addr", addr}, args...), strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestGetSetDelete(t *testing.T) {
+	addr := startServer(t)
+
+	code, _, _ := cachectl(t, addr, "", "set", "bucket", "key", "value")
+	require.Equal(t, 0, code)
+	code, _, _ = cachectl(t, addr, "from stdin", "set", "-ttl", "1m", "bucket", "stdin")
+	require.Equal(t, 0, code)
+
+	code, out, _ := cachectl(t, addr, "", "-o", "raw", "get", "bucket", "stdin")
+	require.Equal(t, 0, code)
+	require.Equal(t, "from stdin", out)
+
+	_, out, _ = cachectl(t, addr, "", "-o", "json", "get", "bucket", "key")
+	require.JSONEq(t, `{"bucket":"bucket","key":"key","value":"value"}`, out)
+
+	_, out, _ = cachectl(t, addr, "", "get", "bucket", "key")
+	require.Equal(t, "BUCKET  KEY  VALUE\nbucket  key  value\n", out)
+
+	_, out, _ = cachectl(t, addr, "", "-o", "raw", "keys", "bucket")
+	require.Equal(t, "key\nstdin\n", out)
+
+	code, _, errOut := cachectl(t, addr, "", "delete", "bucket", "key")
+	require.Equal(t, 0, code, errOut)
+	code, _, errOut = cachectl(t, addr, "", "get", "bucket", "key")
+	require.Equal(t, 1, code)
+	require.Contains(t, errOut, "not found")
+
+	code, _, _ = cachectl(t, addr, "", "get", "bucket")
+	require.Equal(t, 1, code)
+	code, _, _ = cachectl(t, addr, "", "nope")
+	require.Equal(t, 2, code)
+}
+
+func TestExportImport(t *testing.T) {
+	src := startServer(t)
+	for _, kv := range [][]string{{"b1", "k1", "v1"}, {"b1", "k2", "v2"}, {"b2", "k1", "v3"}} {
+		code, _, _ := cachectl(t, src, "", "set", kv[0], kv[1], kv[2])
+		require.Equal(t, 0, code)
+	}
+
+	file := filepath.Join(t.TempDir(), "export.jsonl")
+	code, _, errOut := cachectl(t, src, "", "export", "-f", file)
+	require.Equal(t, 0, code, errOut)
+	require.Contains(t, errOut, "exported 3 keys")
+
+	dst := startServer(t)
+	code, _, errOut = cachectl(t, dst, "", "import", "-f", file)
+	require.Equal(t, 0, code, errOut)
+
+	_, out, _ := cachectl(t, dst, "", "-o", "json", "buckets")
+	require.JSONEq(t, `["b1","b2"]`, out)
+	_, out, _ = cachectl(t, dst, "", "-o", "raw", "get", "b2", "k1")
+	require.Equal(t, "v3", out)
+}
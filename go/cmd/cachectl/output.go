@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// view is the result of a command in every output format, a command with nothing to show returns an empty view.
+type view struct {
+	header []string
+	rows   [][]string
+	json   any
+	raw    []byte
+}
+
+func write(w io.Writer, format string, v view) error {
+	switch format {
+	case outputJSON:
+		if v.json == nil {
+			return nil
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v.json)
+	case outputRaw:
+		_, err := w.Write(v.raw)
+		return err
+	default:
+		if len(v.header) == 0 {
+			return nil
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(v.header, "\t"))
+		for _, row := range v.rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	}
+}
+
+// lines renders values one per line for the raw output.
+func lines(values []string) []byte {
+	if len(values) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(values, "\n") + "\n")
+}
+
+// column renders values as the rows of a single column table.
+func column(values []string) [][]string {
+	rows := make([][]string, len(values))
+	for i, v := range values {
+		rows[i] = []string{v}
+	}
+	return rows
+}
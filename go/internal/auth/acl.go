@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Permission is a set of operations a principal may perform on a bucket.
+type Permission uint8
+
+const (
+	PermissionRead Permission = 1 << iota
+	PermissionWrite
+	// PermissionAdmin also grants read and write.
+	PermissionAdmin
+)
+
+func (p Permission) String() string {
+	var names []string
+	for _, n := range []struct {
+		p    Permission
+		name string
+	}{{PermissionRead, "read"}, {PermissionWrite, "write"}, {PermissionAdmin, "admin"}} {
+		if p&n.p != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// parsePermission parses a comma separated list of read, write and admin.
+func parsePermission(s string) (Permission, error) {
+	var p Permission
+	for _, name := range strings.Split(s, ",") {
+		switch strings.TrimSpace(name) {
+		case "read":
+			p |= PermissionRead
+		case "write":
+			p |= PermissionWrite
+		case "admin":
+			p |= PermissionAdmin | PermissionRead | PermissionWrite
+		default:
+			return 0, fmt.Errorf("unknown permission %q", name)
+		}
+	}
+	return p, nil
+}
+
+// MethodPermissions maps the full method names of RPCs to the permission they require on the
+// buckets of their request. RPCs without a bucket require it on every bucket.
+type MethodPermissions map[string]Permission
+
+// Rule grants permissions on the buckets matching a pattern to a principal.
+type Rule struct {
+	// Principal is a user id, or * for every caller.
+	Principal string
+	// Bucket is a path.Match pattern, only * matches the operations that span every bucket.
+	Bucket      string
+	Permissions Permission
+}
+
+// ACL is an access control list, a principal is granted the union of the permissions of the rules
+// matching it and nothing else.
+type ACL struct {
+	path string
+
+	mu    sync.RWMutex
+	rules []Rule
+}
+
+// LoadACL reads a file with one rule per line: a principal, a bucket pattern and a comma separated
+// list of permissions. Blank lines and lines starting with # are ignored.
+func LoadACL(path string) (*ACL, error) {
+	a := &ACL{path: path}
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Reload reads the file of the access control list again, the rules in use are kept when it is invalid.
+func (a *ACL) Reload() error {
+	f, err := os.Open(a.path)
+	if err != nil {
+		return fmt.Errorf("auth: %w", err)
+	}
+	defer f.Close()
+
+	var rules []Rule
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return fmt.Errorf("auth: %s:%d: expected a principal, a bucket pattern and permissions", a.path, n)
+		}
+		if _, err := path.Match(fields[1], ""); err != nil {
+			return fmt.Errorf("auth: %s:%d: %w", a.path, n, err)
+		}
+		p, err := parsePermission(fields[2])
+		if err != nil {
+			return fmt.Errorf("auth: %s:%d: %w", a.path, n, err)
+		}
+		rules = append(rules, Rule{Principal: fields[0], Bucket: fields[1], Permissions: p})
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("auth: %w", err)
+	}
+
+	a.mu.Lock()
+	a.rules = rules
+	a.mu.Unlock()
+	return nil
+}
+
+// Allowed reports whether principal holds permission p on bucket. An empty bucket stands for every
+// bucket.
+func (a *ACL) Allowed(principal, bucket string, p Permission) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var granted Permission
+	for _, r := range a.rules {
+		if r.Principal != "*" && r.Principal != principal {
+			continue
+		}
+		if bucket == "" {
+			if r.Bucket != "*" {
+				continue
+			}
+		} else if ok, _ := path.Match(r.Bucket, bucket); !ok {
+			continue
+		}
+		granted |= r.Permissions
+	}
+	return granted&p == p
+}
+
+// Principal returns the user id of the caller, empty when it was not authenticated.
+func Principal(ctx context.Context) string {
+	if id, ok := FromContext(ctx); ok {
+		return id.Subject
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestACL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acl")
+	require.NoError(t, os.WriteFile(path, []byte(`# principal bucket permissions
+checkout  cart      read,write
+*         cart      read
+search    catalog-* read
+ops       *         admin
+`), 0o600))
+
+	acl, err := LoadACL(path)
+	require.NoError(t, err)
+
+	require.True(t, acl.Allowed("checkout", "cart", PermissionRead|PermissionWrite))
+	require.True(t, acl.Allowed("search", "cart", PermissionRead))
+	require.False(t, acl.Allowed("search", "cart", PermissionWrite))
+	require.True(t, acl.Allowed("search", "catalog-en", PermissionRead))
+	require.False(t, acl.Allowed("search", "catalog-en", PermissionWrite))
+	require.False(t, acl.Allowed("checkout", "catalog-en", PermissionRead))
+	require.False(t, acl.Allowed("", "catalog-en", PermissionRead))
+
+	// only * patterns cover every bucket
+	require.False(t, acl.Allowed("checkout", "", PermissionAdmin))
+	require.True(t, acl.Allowed("ops", "", PermissionAdmin))
+	require.True(t, acl.Allowed("ops", "cart", PermissionWrite))
+
+	require.NoError(t, os.WriteFile(path, []byte("checkout cart read\n"), 0o600))
+	require.NoError(t, acl.Reload())
+	require.False(t, acl.Allowed("checkout", "cart", PermissionWrite))
+	require.False(t, acl.Allowed("ops", "cart", PermissionRead))
+
+	// an invalid file keeps the rules in use
+	require.NoError(t, os.WriteFile(path, []byte("checkout cart execute\n"), 0o600))
+	require.ErrorContains(t, acl.Reload(), `:1: unknown permission "execute"`)
+	require.True(t, acl.Allowed("checkout", "cart", PermissionRead))
+
+	require.NoError(t, os.WriteFile(path, []byte("checkout [cart read\n"), 0o600))
+	require.Error(t, acl.Reload())
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// MethodAPIKey is the method of identities verified by a static API key.
+const MethodAPIKey = "api_key"
+
+// APIKeys verifies static API keys. Keys are held as SHA-256 digests, so that a lookup does not
+// leak how much of a key matched.
+type APIKeys struct {
+	subjects map[[sha256.Size]byte]string
+}
+
+// LoadAPIKeys reads a file with one user id and key per line, separated by whitespace. Blank lines
+// and lines starting with # are ignored.
+func LoadAPIKeys(path string) (*APIKeys, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("auth: %w", err)
+	}
+	defer f.Close()
+
+	a := &APIKeys{subjects: map[[sha256.Size]byte]string{}}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("auth: %s:%d: expected a user id and a key", path, n)
+		}
+		a.add(fields[0], fields[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("auth: %w", err)
+	}
+	return a, nil
+}
+
+func (a *APIKeys) add(subject, key string) {
+	a.subjects[sha256.Sum256([]byte(key))] = subject
+}
+
+func (a *APIKeys) Authenticate(ctx context.Context, creds Credentials) (*Identity, error) {
+	if creds.APIKey == "" {
+		return nil, nil
+	}
+
+	subject, ok := a.subjects[sha256.Sum256([]byte(creds.APIKey))]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	return &Identity{Subject: subject, Method: MethodAPIKey}, nil
+}
+
+// APIKeyCredentials sends a static API key with every call of a GRPC connection.
+type APIKeyCredentials string
+
+func (k APIKeyCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{APIKeyHeader: string(k)}, nil
+}
+
+func (k APIKeyCredentials) RequireTransportSecurity() bool {
+	return false
+}
@@ -0,0 +1,133 @@
+// Package auth verifies the credentials presented with a request and derives the identity of the caller.
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// APIKeyHeader carries a static API key, as an HTTP header or as GRPC metadata.
+const APIKeyHeader = "x-api-key"
+
+const authorizationHeader = "authorization"
+
+var (
+	// ErrMissingCredentials is returned when a request carries no credentials.
+	ErrMissingCredentials = errors.New("auth: missing credentials")
+	// ErrInvalidCredentials is returned when the credentials of a request cannot be verified.
+	ErrInvalidCredentials = errors.New("auth: invalid credentials")
+)
+
+// Identity is a caller whose credentials were verified.
+type Identity struct {
+	// Subject is the user id of the caller.
+	Subject string
+	// Method is the method that verified the caller: api_key, jwt or client_cert.
+	Method string
+	// Certificate is the client certificate that verified the caller, nil for other methods.
+	Certificate *x509.Certificate
+}
+
+// Credentials are the credentials presented with a request.
+type Credentials struct {
+	APIKey      string
+	BearerToken string
+	// Certificate is the client certificate verified by the TLS handshake of the connection.
+	Certificate *x509.Certificate
+	// ForwardedCertificate is the client certificate a proxy forwarded with the request.
+	ForwardedCertificate *x509.Certificate
+}
+
+// Authenticator verifies credentials. It returns a nil identity and no error when the credentials
+// it verifies are absent, so that authenticators can be chained.
+type Authenticator interface {
+	Authenticate(ctx context.Context, creds Credentials) (*Identity, error)
+}
+
+// Chain tries every authenticator in order and returns the first identity.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(ctx context.Context, creds Credentials) (*Identity, error) {
+	for _, a := range c {
+		id, err := a.Authenticate(ctx, creds)
+		if err != nil || id != nil {
+			return id, err
+		}
+	}
+	return nil, ErrMissingCredentials
+}
+
+// CredentialsFromMetadata reads the credentials of a GRPC request.
+func CredentialsFromMetadata(md metadata.MD) Credentials {
+	var creds Credentials
+	if v := md.Get(APIKeyHeader); len(v) > 0 {
+		creds.APIKey = v[0]
+	}
+	if v := md.Get(authorizationHeader); len(v) > 0 {
+		creds.BearerToken = bearerToken(v[0])
+	}
+	if v := md.Get(ClientCertHeader); len(v) > 0 {
+		creds.ForwardedCertificate, _ = DecodeCertificate(v[0])
+	}
+	return creds
+}
+
+// CredentialsFromContext reads the credentials of a GRPC request, including the client
+// certificate of its connection.
+func CredentialsFromContext(ctx context.Context) Credentials {
+	md, _ := metadata.FromIncomingContext(ctx)
+	creds := CredentialsFromMetadata(md)
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			creds.Certificate = verifiedCertificate(info.State.VerifiedChains)
+		}
+	}
+	return creds
+}
+
+// CredentialsFromRequest reads the credentials of an HTTP request.
+func CredentialsFromRequest(r *http.Request) Credentials {
+	creds := Credentials{
+		APIKey:      r.Header.Get(APIKeyHeader),
+		BearerToken: bearerToken(r.Header.Get(authorizationHeader)),
+	}
+	if r.TLS != nil {
+		creds.Certificate = verifiedCertificate(r.TLS.VerifiedChains)
+	}
+	return creds
+}
+
+func verifiedCertificate(chains [][]*x509.Certificate) *x509.Certificate {
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return nil
+	}
+	return chains[0][0]
+}
+
+func bearerToken(authorization string) string {
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+type identityKey struct{}
+
+// NewContext returns a context carrying the identity of the caller.
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity of the caller, set once its credentials were verified.
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok && id != nil
+}
@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-keys")
+	require.NoError(t, os.WriteFile(path, []byte("# billing service\nbilling key-1\n\nsearch   key-2\n"), 0o600))
+
+	keys, err := LoadAPIKeys(path)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	id, err := keys.Authenticate(ctx, Credentials{APIKey: "key-2"})
+	require.NoError(t, err)
+	require.Equal(t, &Identity{Subject: "search", Method: MethodAPIKey}, id)
+
+	_, err = keys.Authenticate(ctx, Credentials{APIKey: "key-3"})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+
+	id, err = keys.Authenticate(ctx, Credentials{BearerToken: "token"})
+	require.NoError(t, err)
+	require.Nil(t, id)
+
+	require.NoError(t, os.WriteFile(path, []byte("billing\n"), 0o600))
+	_, err = LoadAPIKeys(path)
+	require.ErrorContains(t, err, ":1: expected a user id and a key")
+}
+
+// testSigner signs tokens with one of the keys of a test JWKS.
+type testSigner struct {
+	kid  string
+	alg  string
+	sign func(input []byte) []byte
+}
+
+func (s testSigner) token(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": s.alg, "kid": s.kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return input + "." + base64.RawURLEncoding.EncodeToString(s.sign([]byte(input)))
+}
+
+func encodeInt(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// writeTestJWKS writes a JWKS with an RSA, an EC and an Ed25519 key and returns their signers.
+func writeTestJWKS(t *testing.T) (string, map[string]testSigner) {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	jwks := map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": encodeInt(rsaKey.N.Bytes()), "e": encodeInt(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encodeInt(ecKey.X.FillBytes(make([]byte, 32))), "y": encodeInt(ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": encodeInt(edPub)},
+	}}
+	b, err := json.Marshal(jwks)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, b, 0o600))
+
+	signers := map[string]testSigner{
+		"RS256": {kid: "rsa", alg: "RS256", sign: func(input []byte) []byte {
+			digest := sha256.Sum256(input)
+			sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+			require.NoError(t, err)
+			return sig
+		}},
+		"ES256": {kid: "ec", alg: "ES256", sign: func(input []byte) []byte {
+			digest := sha256.Sum256(input)
+			r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+			require.NoError(t, err)
+			return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}},
+		"EdDSA": {kid: "ed", alg: "EdDSA", sign: func(input []byte) []byte {
+			return ed25519.Sign(edKey, input)
+		}},
+	}
+	return path, signers
+}
+
+func TestJWT(t *testing.T) {
+	path, signers := writeTestJWKS(t)
+	now := time.Unix(1_700_000_000, 0)
+
+	jwt, err := LoadJWT(path, JWTConfig{
+		Issuer:   "https://issuer.example",
+		Audience: "cache-api",
+		Leeway:   time.Minute,
+		Clock:    func() time.Time { return now },
+	})
+	require.NoError(t, err)
+
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{
+			"sub": "user-1",
+			"iss": "https://issuer.example",
+			"aud": []string{"other", "cache-api"},
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	ctx := context.Background()
+	for alg, signer := range signers {
+		id, err := jwt.Authenticate(ctx, Credentials{BearerToken: signer.token(t, claims(nil))})
+		require.NoError(t, err, alg)
+		require.Equal(t, &Identity{Subject: "user-1", Method: MethodJWT}, id, alg)
+	}
+
+	rs := signers["RS256"]
+	for name, c := range map[string]map[string]any{
+		"expired":       {"exp": now.Add(-2 * time.Minute).Unix()},
+		"missing exp":   {"exp": nil},
+		"not yet valid": {"nbf": now.Add(2 * time.Minute).Unix()},
+		"issuer":        {"iss": "https://other.example"},
+		"audience":      {"aud": "other"},
+		"subject":       {"sub": nil},
+	} {
+		_, err := jwt.Authenticate(ctx, Credentials{BearerToken: rs.token(t, claims(c))})
+		require.ErrorIs(t, err, ErrInvalidCredentials, name)
+	}
+
+	// within the leeway
+	_, err = jwt.Authenticate(ctx, Credentials{BearerToken: rs.token(t, claims(map[string]any{"exp": now.Add(-30 * time.Second).Unix()}))})
+	require.NoError(t, err)
+
+	// a signature must be made with the algorithm of the key
+	forged := testSigner{kid: "rsa", alg: "ES256", sign: signers["ES256"].sign}
+	_, err = jwt.Authenticate(ctx, Credentials{BearerToken: forged.token(t, claims(nil))})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+
+	unsigned := testSigner{kid: "rsa", alg: "none", sign: func([]byte) []byte { return nil }}
+	_, err = jwt.Authenticate(ctx, Credentials{BearerToken: unsigned.token(t, claims(nil))})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+
+	token := rs.token(t, claims(nil))
+	_, err = jwt.Authenticate(ctx, Credentials{BearerToken: token[:len(token)-4] + "AAAA"})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-keys")
+	require.NoError(t, os.WriteFile(path, []byte("billing key-1\n"), 0o600))
+	keys, err := LoadAPIKeys(path)
+	require.NoError(t, err)
+
+	jwksPath, signers := writeTestJWKS(t)
+	jwt, err := LoadJWT(jwksPath, JWTConfig{})
+	require.NoError(t, err)
+
+	chain := Chain{keys, jwt}
+	ctx := context.Background()
+
+	_, err = chain.Authenticate(ctx, Credentials{})
+	require.ErrorIs(t, err, ErrMissingCredentials)
+
+	token := signers["EdDSA"].token(t, map[string]any{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()})
+	md := metadata.Pairs("authorization", "Bearer "+token)
+	id, err := chain.Authenticate(ctx, CredentialsFromMetadata(md))
+	require.NoError(t, err)
+	require.Equal(t, "user-1", id.Subject)
+
+	r, err := http.NewRequest(http.MethodGet, "/", nil)
+	require.NoError(t, err)
+	r.Header.Set("X-API-Key", "key-1")
+	id, err = chain.Authenticate(ctx, CredentialsFromRequest(r))
+	require.NoError(t, err)
+	require.Equal(t, "billing", id.Subject)
+}
+
+func testCertificate(t *testing.T, subject pkix.Name) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: subject, NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestClientCerts(t *testing.T) {
+	gateway := testCertificate(t, pkix.Name{CommonName: "cache-api"})
+	billing := testCertificate(t, pkix.Name{CommonName: "billing"})
+	certs := ClientCerts{Proxy: func(cert *x509.Certificate) bool { return cert.Equal(gateway) }}
+	ctx := context.Background()
+
+	id, err := certs.Authenticate(ctx, Credentials{Certificate: billing})
+	require.NoError(t, err)
+	require.Equal(t, &Identity{Subject: "billing", Method: MethodClientCert, Certificate: billing}, id)
+
+	// only a proxy forwards certificates
+	md := metadata.Pairs(ClientCertHeader, EncodeCertificate(billing))
+	creds := CredentialsFromMetadata(md)
+	require.True(t, billing.Equal(creds.ForwardedCertificate))
+
+	creds.Certificate = gateway
+	id, err = certs.Authenticate(ctx, creds)
+	require.NoError(t, err)
+	require.Equal(t, "billing", id.Subject)
+
+	search := testCertificate(t, pkix.Name{CommonName: "search"})
+	id, err = certs.Authenticate(ctx, Credentials{Certificate: search, ForwardedCertificate: billing})
+	require.NoError(t, err)
+	require.Equal(t, "search", id.Subject)
+
+	id, err = certs.Authenticate(ctx, Credentials{Certificate: gateway})
+	require.NoError(t, err)
+	require.Nil(t, id)
+
+	_, err = certs.Authenticate(ctx, Credentials{Certificate: testCertificate(t, pkix.Name{Organization: []string{"acme"}})})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+}
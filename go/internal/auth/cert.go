@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// MethodClientCert is the method of identities verified by a TLS client certificate.
+const MethodClientCert = "client_cert"
+
+// ClientCertHeader carries a client certificate forwarded by a proxy, as URL escaped PEM.
+const ClientCertHeader = "x-client-cert"
+
+// ClientCerts verifies callers by the client certificate verified by the TLS handshake. The user
+// id is the common name of the certificate, or its first URI such as a SPIFFE id.
+type ClientCerts struct {
+	// Proxy reports whether a certificate is the one of a trusted proxy, such as the gateway, whose
+	// requests are verified by the certificate it forwards in ClientCertHeader.
+	Proxy func(cert *x509.Certificate) bool
+}
+
+func (c ClientCerts) Authenticate(ctx context.Context, creds Credentials) (*Identity, error) {
+	cert := creds.Certificate
+	if cert != nil && c.Proxy != nil && c.Proxy(cert) {
+		cert = creds.ForwardedCertificate
+	}
+	if cert == nil {
+		return nil, nil
+	}
+
+	subject := cert.Subject.CommonName
+	if subject == "" && len(cert.URIs) > 0 {
+		subject = cert.URIs[0].String()
+	}
+	if subject == "" {
+		return nil, fmt.Errorf("%w: client certificate without a common name or URI", ErrInvalidCredentials)
+	}
+	return &Identity{Subject: subject, Method: MethodClientCert, Certificate: cert}, nil
+}
+
+// EncodeCertificate encodes cert for ClientCertHeader.
+func EncodeCertificate(cert *x509.Certificate) string {
+	return url.QueryEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})))
+}
+
+// DecodeCertificate decodes a certificate encoded by EncodeCertificate.
+func DecodeCertificate(s string) (*x509.Certificate, error) {
+	b, err := url.QueryUnescape(s)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(b))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("auth: malformed certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
@@ -0,0 +1,532 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ahmedalhulaibi/loggy"
+)
+
+/*
+The append-only log records every mutation of a Store so that it can be rebuilt on startup.
+
+Each record is framed as:
+
+	| length uint32 | crc32c uint32 | payload (length bytes) |
+
+and the payload is:
+
+	| type uint8 | expiry int64 (unix nanos, 0 for none) | flags uint32 | uvarint len | bucket | uvarint len | key | uvarint len | value |
+	| uvarint len | content type | uvarint count | count * (uvarint len | metadata key | uvarint len | metadata value) |
+
+The content type and metadata are only written when either is set.
+
+When the log is encrypted, the values of set operations on encrypted buckets are written as
+encryption envelopes and the high bit of their type is set.
+
+A crash can leave a partially written record at the end of the file. Replay detects a short or
+corrupt final record and truncates the file back to the last complete record. A corrupt record
+that is followed by more data is not a torn write and replay refuses to continue.
+*/
+
+type FsyncPolicy string
+
+const (
+	FsyncAlways      FsyncPolicy = "always"
+	FsyncEverySecond FsyncPolicy = "everysec"
+	FsyncNever       FsyncPolicy = "never"
+)
+
+var ErrCorruptLog = errors.New("append-only log is corrupt")
+
+const aofHeaderSize = 8
+
+// opSealed is set on the type of a record whose value is an encryption envelope
+const opSealed OperationType = 0x80
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+type AppendOnlyLogConfig struct {
+	Path  string
+	Fsync FsyncPolicy
+	// RewriteMinSize is the log size in bytes below which the log is never rewritten
+	RewriteMinSize int64
+	// RewritePercentage is the growth over the size after the last rewrite that triggers a rewrite, 0 disables rewriting
+	RewritePercentage int
+	// Encryption encrypts the values of the buckets it selects, its keyring decrypts them on replay
+	Encryption *Encryption
+}
+
+type AppendOnlyLog struct {
+	config AppendOnlyLogConfig
+	logger *loggy.Logger
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	baseSize int64
+	dirty    bool
+	// while rewriting, operations are also buffered so they can be appended to the rewritten log
+	rewriting  bool
+	rewriteBuf [][]byte
+
+	store Store
+}
+
+func OpenAppendOnlyLog(logger *loggy.Logger, config AppendOnlyLogConfig) (*AppendOnlyLog, error) {
+	switch config.Fsync {
+	case FsyncAlways, FsyncEverySecond, FsyncNever:
+	case "":
+		config.Fsync = FsyncEverySecond
+	default:
+		return nil, fmt.Errorf("unknown fsync policy %q", config.Fsync)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(config.Path), 0o755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(config.Path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AppendOnlyLog{
+		config: config,
+		logger: logger,
+		file:   f,
+	}, nil
+}
+
+// Replay applies every record in the log to store and positions the log for appending.
+func (l *AppendOnlyLog) Replay(ctx context.Context, store Store) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	info, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(l.file)
+	var offset int64
+	var count int
+	for {
+		op, n, err := readOperation(r, info.Size()-offset)
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			op, err = l.open(op)
+			if err != nil {
+				return fmt.Errorf("%w: record at offset %d: %v", ErrCorruptLog, offset, err)
+			}
+		}
+		if err != nil {
+			// a torn write only leaves a partial record at the end of the log, a record followed by
+			// complete ones is corrupt
+			if offset+int64(n) < info.Size() && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return fmt.Errorf("%w: record at offset %d: %v", ErrCorruptLog, offset, err)
+			}
+			if next := l.nextRecord(offset, info.Size()); next >= 0 {
+				return fmt.Errorf("%w: record at offset %d: %v, a complete record follows at offset %d", ErrCorruptLog, offset, err, next)
+			}
+
+			l.logger.Warnw(ctx, "truncating incomplete append-only log record", "path", l.config.Path, "offset", offset, "size", info.Size(), "err", err)
+			if err := l.file.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		}
+
+		if err := store.Apply(op); err != nil {
+			return fmt.Errorf("applying record at offset %d: %w", offset, err)
+		}
+		offset += int64(n)
+		count++
+	}
+
+	if _, err := l.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	l.size = offset
+	l.baseSize = offset
+
+	l.logger.Infow(ctx, "replayed append-only log", "path", l.config.Path, "records", count, "size", offset)
+	return nil
+}
+
+// nextRecord returns the offset of the first complete record after offset, or -1 when there is none.
+// It is only called once a record failed to read, so that a corrupt length does not pass for the end of
+// the log.
+func (l *AppendOnlyLog) nextRecord(offset, size int64) int64 {
+	for start := offset + 1; start+aofHeaderSize <= size; start++ {
+		if _, _, err := readOperation(io.NewSectionReader(l.file, start, size-start), size-start); err == nil {
+			return start
+		}
+	}
+	return -1
+}
+
+// Attach subscribes the log to every mutation of store.
+func (l *AppendOnlyLog) Attach(store Store) {
+	l.store = store
+	store.Subscribe(l.append)
+}
+
+func (l *AppendOnlyLog) append(op Operation) {
+	op, err := l.seal(op)
+	if err != nil {
+		l.logger.Errorw(context.Background(), "failed to encrypt append-only log record", "path", l.config.Path, "err", err)
+		return
+	}
+	b := encodeOperation(op)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rewriting {
+		l.rewriteBuf = append(l.rewriteBuf, b)
+	}
+
+	n, err := l.file.Write(b)
+	l.size += int64(n)
+	if err != nil {
+		l.logger.Errorw(context.Background(), "failed to write append-only log", "path", l.config.Path, "err", err)
+		return
+	}
+
+	if l.config.Fsync == FsyncAlways {
+		if err := l.file.Sync(); err != nil {
+			l.logger.Errorw(context.Background(), "failed to sync append-only log", "path", l.config.Path, "err", err)
+		}
+		return
+	}
+	l.dirty = true
+}
+
+// Run syncs the log according to the fsync policy and rewrites it when it has grown enough, until
+// ctx is done. The log stays open for the writes that follow, Close syncs and closes it once the
+// store is no longer written to.
+func (l *AppendOnlyLog) Run(ctx context.Context) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if l.config.Fsync == FsyncEverySecond {
+				if err := l.sync(); err != nil {
+					l.logger.Errorw(ctx, "failed to sync append-only log", "path", l.config.Path, "err", err)
+				}
+			}
+
+			if l.shouldRewrite() {
+				if err := l.Rewrite(); err != nil {
+					l.logger.Errorw(ctx, "failed to rewrite append-only log", "path", l.config.Path, "err", err)
+				}
+			}
+		}
+	}
+}
+
+func (l *AppendOnlyLog) sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.dirty {
+		return nil
+	}
+	l.dirty = false
+	return l.file.Sync()
+}
+
+func (l *AppendOnlyLog) shouldRewrite() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.store == nil || l.config.RewritePercentage <= 0 || l.size < l.config.RewriteMinSize {
+		return false
+	}
+	return l.size >= l.baseSize+l.baseSize*int64(l.config.RewritePercentage)/100
+}
+
+// Rewrite compacts the log into the minimal set of operations that rebuild the current state.
+// Mutations are not blocked while the snapshot is written.
+func (l *AppendOnlyLog) Rewrite() error {
+	l.mu.Lock()
+	if l.rewriting {
+		l.mu.Unlock()
+		return nil
+	}
+	l.rewriting = true
+	l.rewriteBuf = nil
+	l.mu.Unlock()
+
+	tmp, err := l.writeSnapshot()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer func() {
+		l.rewriting = false
+		l.rewriteBuf = nil
+	}()
+
+	if err != nil {
+		return err
+	}
+
+	abort := func(err error) error {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	// operations applied during the snapshot may or may not be part of it, replaying them is idempotent
+	size, err := tmp.Seek(0, io.SeekEnd)
+	if err != nil {
+		return abort(err)
+	}
+	for _, b := range l.rewriteBuf {
+		n, err := tmp.Write(b)
+		size += int64(n)
+		if err != nil {
+			return abort(err)
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		return abort(err)
+	}
+
+	if err := os.Rename(tmp.Name(), l.config.Path); err != nil {
+		return abort(err)
+	}
+
+	l.file.Close()
+	l.file = tmp
+	l.size = size
+	l.baseSize = size
+	l.dirty = false
+
+	l.logger.Infow(context.Background(), "rewrote append-only log", "path", l.config.Path, "size", size)
+	return nil
+}
+
+func (l *AppendOnlyLog) writeSnapshot() (*os.File, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(l.config.Path), filepath.Base(l.config.Path)+".rewrite-*")
+	if err != nil {
+		return nil, err
+	}
+
+	w := bufio.NewWriter(tmp)
+	err = l.store.Snapshot(func(op Operation) error {
+		op, err := l.seal(op)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(encodeOperation(op))
+		return err
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	return tmp, nil
+}
+
+func (l *AppendOnlyLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.file.Sync(); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+// seal replaces the value of a set operation on an encrypted bucket with an encryption envelope.
+func (l *AppendOnlyLog) seal(op Operation) (Operation, error) {
+	k := l.config.Encryption.keyring(op.Bucket)
+	if k == nil || op.Type != OpSet {
+		return op, nil
+	}
+
+	envelope, _, err := k.seal(op.Bucket, op.Key, op.Value)
+	if err != nil {
+		return op, err
+	}
+	op.Type |= opSealed
+	op.Value = envelope
+	return op, nil
+}
+
+// open decrypts the value of a sealed operation.
+func (l *AppendOnlyLog) open(op Operation) (Operation, error) {
+	if op.Type&opSealed == 0 {
+		return op, nil
+	}
+	if l.config.Encryption == nil || l.config.Encryption.Keyring == nil {
+		return op, fmt.Errorf("encrypted record without a keyring")
+	}
+
+	value, err := l.config.Encryption.Keyring.open(op.Bucket, op.Key, op.Value)
+	if err != nil {
+		return op, err
+	}
+	op.Type &^= opSealed
+	op.Value = value
+	return op, nil
+}
+
+func encodeOperation(op Operation) []byte {
+	var expiry int64
+	if !op.Expiry.IsZero() {
+		expiry = op.Expiry.UnixNano()
+	}
+
+	payload := make([]byte, 0, 1+8+4+3*binary.MaxVarintLen64+len(op.Bucket)+len(op.Key)+len(op.Value))
+	payload = append(payload, byte(op.Type))
+	payload = binary.LittleEndian.AppendUint64(payload, uint64(expiry))
+	payload = binary.LittleEndian.AppendUint32(payload, op.Flags)
+	for _, field := range [][]byte{[]byte(op.Bucket), []byte(op.Key), op.Value} {
+		payload = appendField(payload, field)
+	}
+
+	if op.ContentType != "" || len(op.Metadata) > 0 {
+		payload = appendField(payload, []byte(op.ContentType))
+		payload = binary.AppendUvarint(payload, uint64(len(op.Metadata)))
+		for k, v := range op.Metadata {
+			payload = appendField(payload, []byte(k))
+			payload = appendField(payload, []byte(v))
+		}
+	}
+
+	b := make([]byte, aofHeaderSize, aofHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(b[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(b[4:8], crc32.Checksum(payload, crcTable))
+	return append(b, payload...)
+}
+
+// readOperation returns the decoded operation and the number of bytes the record occupies.
+// On error the returned size is the number of bytes the record claims to occupy.
+// A record claiming to be larger than remaining bytes is reported as truncated.
+func readOperation(r io.Reader, remaining int64) (Operation, int, error) {
+	var header [aofHeaderSize]byte
+	n, err := io.ReadFull(r, header[:])
+	if err != nil {
+		if err == io.EOF {
+			return Operation{}, 0, io.EOF
+		}
+		return Operation{}, n, err
+	}
+
+	size := aofHeaderSize + int(binary.LittleEndian.Uint32(header[0:4]))
+	if int64(size) > remaining {
+		return Operation{}, size, io.ErrUnexpectedEOF
+	}
+	payload := make([]byte, size-aofHeaderSize)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Operation{}, size, err
+	}
+
+	if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(header[4:8]) {
+		return Operation{}, size, fmt.Errorf("checksum mismatch")
+	}
+
+	op, err := decodeOperation(payload)
+	return op, size, err
+}
+
+func appendField(b, field []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(field)))
+	return append(b, field...)
+}
+
+// readField returns the next length-prefixed field of b and the rest of b.
+func readField(b []byte) ([]byte, []byte, error) {
+	l, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < l {
+		return nil, nil, fmt.Errorf("malformed record")
+	}
+	return b[n : n+int(l)], b[n+int(l):], nil
+}
+
+func decodeOperation(payload []byte) (Operation, error) {
+	if len(payload) < 13 {
+		return Operation{}, fmt.Errorf("record too short")
+	}
+
+	op := Operation{Type: OperationType(payload[0])}
+	if expiry := int64(binary.LittleEndian.Uint64(payload[1:9])); expiry != 0 {
+		op.Expiry = time.Unix(0, expiry)
+	}
+	op.Flags = binary.LittleEndian.Uint32(payload[9:13])
+
+	rest := payload[13:]
+	fields := make([][]byte, 3)
+	for i := range fields {
+		var err error
+		if fields[i], rest, err = readField(rest); err != nil {
+			return Operation{}, err
+		}
+	}
+
+	op.Bucket = string(fields[0])
+	op.Key = string(fields[1])
+	if len(fields[2]) > 0 {
+		op.Value = append([]byte(nil), fields[2]...)
+	}
+	if len(rest) == 0 {
+		return op, nil
+	}
+
+	contentType, rest, err := readField(rest)
+	if err != nil {
+		return Operation{}, err
+	}
+	op.ContentType = string(contentType)
+
+	count, n := binary.Uvarint(rest)
+	if n <= 0 || count > uint64(len(rest)) {
+		return Operation{}, fmt.Errorf("malformed record")
+	}
+	rest = rest[n:]
+	if count > 0 {
+		op.Metadata = make(map[string]string, count)
+	}
+	for i := uint64(0); i < count; i++ {
+		var k, v []byte
+		if k, rest, err = readField(rest); err != nil {
+			return Operation{}, err
+		}
+		if v, rest, err = readField(rest); err != nil {
+			return Operation{}, err
+		}
+		op.Metadata[string(k)] = string(v)
+	}
+	return op, nil
+}
@@ -0,0 +1,258 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestLogger() *loggy.Logger {
+	l := loggy.New(zap.NewNop().Sugar())
+	return &l
+}
+
+func openTestLog(t *testing.T, path string) (*AppendOnlyLog, *buckets) {
+	t.Helper()
+	aof, err := OpenAppendOnlyLog(newTestLogger(), AppendOnlyLogConfig{Path: path, Fsync: FsyncAlways})
+	require.NoError(t, err)
+
+	b := NewCache()
+	require.NoError(t, aof.Replay(context.Background(), b))
+	aof.Attach(b)
+	return aof, b
+}
+
+func TestAppendOnlyLogReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	aof, b := openTestLog(t, path)
+	require.NoError(t, b.Set(context.Background(), "bucket1", "key1", []byte("value1")))
+	require.NoError(t, b.Set(context.Background(), "bucket1", "key2", []byte("value2"), WithTTL(time.Hour)))
+	require.NoError(t, b.Set(context.Background(), "bucket2", "key1", []byte("value3"), WithFlags(7)))
+	require.NoError(t, b.Set(context.Background(), "bucket2", "key2", []byte("{}"),
+		WithContentType("application/json"), WithMetadata(map[string]string{"owner": "web"})))
+	require.NoError(t, b.Delete(context.Background(), "bucket1", "key1"))
+	require.NoError(t, aof.Close())
+
+	aof, b = openTestLog(t, path)
+	defer aof.Close()
+
+	v, err := b.Get(context.Background(), "bucket1", "key1")
+	require.NoError(t, err)
+	require.Nil(t, v)
+
+	v, err = b.Get(context.Background(), "bucket1", "key2")
+	require.NoError(t, err)
+	require.Equal(t, []byte("value2"), v)
+
+	e, err := b.Lookup(context.Background(), "bucket2", "key1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("value3"), e.Value)
+	require.Equal(t, uint32(7), e.Flags)
+
+	e, err = b.Lookup(context.Background(), "bucket2", "key2")
+	require.NoError(t, err)
+	require.Equal(t, "application/json", e.ContentType)
+	require.Equal(t, map[string]string{"owner": "web"}, e.Metadata)
+}
+
+func TestAppendOnlyLogReplayExpired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	aof, b := openTestLog(t, path)
+	past := time.Now().Add(-time.Minute)
+	require.NoError(t, b.Set(context.Background(), "bucket1", "key1", []byte("value1"), WithClock(func() time.Time { return past }), WithTTL(time.Second)))
+	require.NoError(t, aof.Close())
+
+	aof, b = openTestLog(t, path)
+	defer aof.Close()
+
+	v, err := b.Get(context.Background(), "bucket1", "key1")
+	require.NoError(t, err)
+	require.Nil(t, v)
+	require.Equal(t, uint64(1), b.Stats().Expired)
+}
+
+func TestAppendOnlyLogTruncatedTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	aof, b := openTestLog(t, path)
+	require.NoError(t, b.Set(context.Background(), "bucket1", "key1", []byte("value1")))
+	require.NoError(t, b.Set(context.Background(), "bucket1", "key2", []byte("value2")))
+	require.NoError(t, aof.Close())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-3))
+
+	aof, b = openTestLog(t, path)
+	v, err := b.Get(context.Background(), "bucket1", "key1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("value1"), v)
+	v, err = b.Get(context.Background(), "bucket1", "key2")
+	require.NoError(t, err)
+	require.Nil(t, v)
+
+	// the torn record is truncated and new records are appended after the last complete one
+	require.NoError(t, b.Set(context.Background(), "bucket1", "key3", []byte("value3")))
+	require.NoError(t, aof.Close())
+
+	aof, b = openTestLog(t, path)
+	defer aof.Close()
+	v, err = b.Get(context.Background(), "bucket1", "key3")
+	require.NoError(t, err)
+	require.Equal(t, []byte("value3"), v)
+}
+
+func TestAppendOnlyLogCorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	aof, b := openTestLog(t, path)
+	require.NoError(t, b.Set(context.Background(), "bucket1", "key1", []byte("value1")))
+	require.NoError(t, b.Set(context.Background(), "bucket1", "key2", []byte("value2")))
+	require.NoError(t, aof.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[aofHeaderSize+12] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	aof, err = OpenAppendOnlyLog(newTestLogger(), AppendOnlyLogConfig{Path: path})
+	require.NoError(t, err)
+	defer aof.Close()
+	require.ErrorIs(t, aof.Replay(context.Background(), NewCache()), ErrCorruptLog)
+}
+
+func TestAppendOnlyLogCorruptLength(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	aof, b := openTestLog(t, path)
+	require.NoError(t, b.Set(context.Background(), "bucket1", "key1", []byte("value1")))
+	require.NoError(t, b.Set(context.Background(), "bucket1", "key2", []byte("value2")))
+	require.NoError(t, aof.Close())
+
+	// a length that reaches past the end of the log is not a torn write when complete records follow
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	binary.LittleEndian.PutUint32(data[0:4], uint32(len(data)))
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	aof, err = OpenAppendOnlyLog(newTestLogger(), AppendOnlyLogConfig{Path: path})
+	require.NoError(t, err)
+	defer aof.Close()
+	require.ErrorIs(t, aof.Replay(context.Background(), NewCache()), ErrCorruptLog)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), info.Size())
+}
+
+func TestAppendOnlyLogRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	aof, b := openTestLog(t, path)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, b.Set(context.Background(), "bucket1", "key1", []byte("value1")))
+	}
+	require.NoError(t, b.Set(context.Background(), "bucket1", "key2", []byte("value2")))
+	require.NoError(t, b.Delete(context.Background(), "bucket1", "key2"))
+
+	before, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, aof.Rewrite())
+	after, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Less(t, after.Size(), before.Size())
+
+	require.NoError(t, b.Set(context.Background(), "bucket1", "key3", []byte("value3")))
+	require.NoError(t, aof.Close())
+
+	aof, b = openTestLog(t, path)
+	defer aof.Close()
+	for key, want := range map[string][]byte{"key1": []byte("value1"), "key2": nil, "key3": []byte("value3")} {
+		v, err := b.Get(context.Background(), "bucket1", key)
+		require.NoError(t, err)
+		require.Equal(t, want, v, key)
+	}
+}
+
+func TestAppendOnlyLogReplaySpilled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	open := func() (*AppendOnlyLog, *buckets, *DiskTier) {
+		aof, err := OpenAppendOnlyLog(newTestLogger(), AppendOnlyLogConfig{Path: path, Fsync: FsyncAlways})
+		require.NoError(t, err)
+		b, d := newTestDiskCache(t, 2, DiskTierConfig{})
+		require.NoError(t, aof.Replay(context.Background(), b))
+		aof.Attach(b)
+		return aof, b, d
+	}
+
+	aof, b, d := open()
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, b.Set(context.Background(), "bucket", fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i))))
+	}
+	require.Equal(t, 2, d.Stats().Keys)
+	require.NoError(t, aof.Close())
+
+	// the disk tier starts empty, replaying spills the same keys to it again
+	aof, b, d = open()
+	defer aof.Close()
+	require.Equal(t, 2, d.Stats().Keys)
+	require.Equal(t, Usage{Keys: 4, Bytes: 24}, b.Usage("bucket"))
+	for i := 1; i <= 4; i++ {
+		v, err := b.Get(context.Background(), "bucket", fmt.Sprintf("key%d", i))
+		require.NoError(t, err)
+		require.Equal(t, []byte(fmt.Sprintf("value%d", i)), v)
+	}
+	require.Equal(t, uint64(0), b.Stats().Evictions)
+}
+
+func TestAppendOnlyLogReplayEvicts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	aof, b := openTestLog(t, path)
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, b.Set(context.Background(), "bucket", fmt.Sprintf("key%d", i), []byte("value")))
+	}
+	require.NoError(t, aof.Close())
+
+	// a store restarted with a smaller capacity evicts while replaying
+	aof, err := OpenAppendOnlyLog(newTestLogger(), AppendOnlyLogConfig{Path: path, Fsync: FsyncAlways})
+	require.NoError(t, err)
+	defer aof.Close()
+	b = NewCacheWithCapacity(2)
+	require.NoError(t, aof.Replay(context.Background(), b))
+	require.Equal(t, []string{"key2", "key3"}, b.Keys("bucket"))
+	require.Equal(t, uint64(1), b.Stats().Evictions)
+}
+
+func TestAppendOnlyLogWritesAfterRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	aof, b := openTestLog(t, path)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- aof.Run(ctx) }()
+	cancel()
+	require.NoError(t, <-done)
+
+	// servers keep writing while they drain, the log is closed once they have stopped
+	require.NoError(t, b.Set(context.Background(), "bucket1", "key1", []byte("value1")))
+	require.NoError(t, aof.Close())
+
+	aof, b = openTestLog(t, path)
+	defer aof.Close()
+
+	v, err := b.Get(context.Background(), "bucket1", "key1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("value1"), v)
+}
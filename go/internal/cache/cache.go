@@ -2,8 +2,11 @@ package cache
 
 import (
 	"container/list"
+	"context"
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -27,13 +30,116 @@ System Considerations:
 - Error handling
 */
 
+// Cache is a store of buckets of keys. Operations on keys record a span as a child of the span of
+// ctx, with events for the time spent waiting on locks, expired and evicted keys, and a child span
+// for every load from the disk tier.
 type Cache interface {
-	Set(bucket, key string, value []byte, opts ...Option) error
-	Get(bucket, key string, opts ...Option) ([]byte, error)
-	Delete(bucket, key string, opts ...Option) error
+	Set(ctx context.Context, bucket, key string, value []byte, opts ...Option) error
+	Get(ctx context.Context, bucket, key string, opts ...Option) ([]byte, error)
+	// GetEntry is Get returning the entry of a key, its value read under the same lock as its content
+	// type and metadata
+	GetEntry(ctx context.Context, bucket, key string, opts ...Option) (*Entry, error)
+	Delete(ctx context.Context, bucket, key string, opts ...Option) error
+	// DeleteIf atomically deletes a key when cond returns true for its entry, and reports whether it did
+	DeleteIf(ctx context.Context, bucket, key string, cond DeleteFunc, opts ...Option) (bool, error)
+	// Update atomically replaces the entry of a key with the result of fn
+	Update(ctx context.Context, bucket, key string, fn UpdateFunc, opts ...Option) error
+	// Lookup returns the live entry of a key, or nil, without counting a hit or miss or changing recency
+	Lookup(ctx context.Context, bucket, key string, opts ...Option) (*Entry, error)
+	// Flush removes every key of a bucket
+	Flush(ctx context.Context, bucket string) error
+	// Buckets returns the sorted names of the buckets holding at least one live key
+	Buckets() []string
+	// Keys returns the sorted live keys of a bucket
+	Keys(bucket string) []string
+	// Usage returns the keys of a bucket and the size of their values across both tiers
+	Usage(bucket string) Usage
 	Stats() stats
 }
 
+// Usage is the number of keys of a bucket and the size of their values before compression.
+// Expired keys are counted until they are removed.
+type Usage struct {
+	Keys  int
+	Bytes uint64
+}
+
+// Entry is the value and absolute expiry of a key, the zero Expiry means no expiry.
+// Flags are opaque to the cache and CAS changes every time the key is set.
+type Entry struct {
+	Value  []byte
+	Expiry time.Time
+	Flags  uint32
+	// CAS is assigned by the cache. An UpdateFunc keeps it by returning the current CAS, as a touch does.
+	CAS uint64
+	// ContentType is the media type of the value and Metadata describes it, both are optional
+	ContentType string
+	Metadata    map[string]string
+}
+
+// UpdateFunc receives the current entry of a key, or nil when the key does not exist,
+// and returns the entry to store, or nil to leave the key unchanged.
+type UpdateFunc func(current *Entry) (*Entry, error)
+
+// DeleteFunc receives the current entry of a key, or nil when the key does not exist,
+// and reports whether to delete it.
+type DeleteFunc func(current *Entry) bool
+
+// Store is a Cache whose mutations can be observed, replayed and snapshotted.
+// It is the extension point used by persistence and replication.
+type Store interface {
+	Cache
+	// Apply replays an operation produced by another store or a log. A set makes room as Set does,
+	// as the keys a store spills to its disk tier are not recorded as operations.
+	Apply(op Operation) error
+	// Subscribe registers fn to be called for every mutation, in the order they are applied to a bucket.
+	Subscribe(fn func(Operation))
+	// Snapshot calls fn with a set operation for every live record.
+	Snapshot(fn func(Operation) error) error
+}
+
+type OperationType uint8
+
+const (
+	OpSet OperationType = iota + 1
+	OpDelete
+	OpExpire
+	OpEvict
+	// OpFlush removes every bucket, or a single bucket when one is named
+	OpFlush
+)
+
+func (t OperationType) String() string {
+	switch t {
+	case OpSet:
+		return "set"
+	case OpDelete:
+		return "delete"
+	case OpExpire:
+		return "expire"
+	case OpEvict:
+		return "evict"
+	case OpFlush:
+		return "flush"
+	default:
+		return "unknown"
+	}
+}
+
+// Operation describes a single mutation of a bucket.
+type Operation struct {
+	Type   OperationType
+	Bucket string
+	Key    string
+	Value  []byte
+	// Expiry is the absolute expiry of a set operation, the zero value means no expiry
+	Expiry time.Time
+	Flags  uint32
+	// ContentType and Metadata describe the value of a set operation
+	ContentType string
+	Metadata    map[string]string
+}
+
 type EvictionPolicy string
 
 const (
@@ -50,6 +156,11 @@ type Options struct {
 	clock          func() time.Time
 	// for testing purposes override this behaviour
 	evictOnGet bool
+	// expiry overrides ttl with an absolute expiry, used when applying operations
+	expiry      *time.Time
+	flags       uint32
+	contentType string
+	metadata    map[string]string
 }
 
 func getOptions(opts ...Option) (*Options, error) {
@@ -83,6 +194,44 @@ func WithEvictionPolicy(policy EvictionPolicy) Option {
 	}
 }
 
+// WithContentType stores the media type of the value.
+func WithContentType(contentType string) Option {
+	return func(o *Options) error {
+		o.contentType = contentType
+		return nil
+	}
+}
+
+// WithMetadata stores string pairs describing the value, the map must not be modified afterwards.
+func WithMetadata(metadata map[string]string) Option {
+	return func(o *Options) error {
+		o.metadata = metadata
+		return nil
+	}
+}
+
+// WithFlags stores opaque client flags with the value, as memcached clients do.
+func WithFlags(flags uint32) Option {
+	return func(o *Options) error {
+		o.flags = flags
+		return nil
+	}
+}
+
+func withExpiry(expiry time.Time) Option {
+	return func(o *Options) error {
+		o.expiry = &expiry
+		return nil
+	}
+}
+
+func withoutEvictOnGet() Option {
+	return func(o *Options) error {
+		o.evictOnGet = false
+		return nil
+	}
+}
+
 // for testing purposes
 func WithClock(clock func() time.Time) Option {
 	return func(o *Options) error {
@@ -97,85 +246,414 @@ Assumptions:
 2. Given that a cache is at capacity and a `Get` method is called and the Oldest eviction policy is applied, we will still return the value for the key
 */
 
-var _ Cache = (*buckets)(nil)
+var _ Store = (*buckets)(nil)
 
 type buckets struct {
-	buckets map[string]cache
+	buckets  map[string]cache
+	capacity int
 	sync.RWMutex
+
+	// cas is shared by all buckets so that a value is never reused after a flush
+	cas atomic.Uint64
+	// disk receives the records evicted from memory, nil when there is no disk tier
+	disk *DiskTier
+	// compression is keyed by bucket, the empty bucket applies to buckets without their own
+	compression map[string]Compression
+	encryption  *Encryption
+
+	observersMu sync.RWMutex
+	observers   []func(Operation)
 }
 
 func NewCache() *buckets {
+	return NewCacheWithCapacity(255)
+}
+
+// NewCacheWithCapacity creates a cache whose buckets hold at most capacity keys.
+func NewCacheWithCapacity(capacity int) *buckets {
 	return &buckets{
-		buckets: make(map[string]cache),
+		buckets:  make(map[string]cache),
+		capacity: capacity,
+	}
+}
+
+// UseDiskTier spills the records evicted from memory to d instead of dropping them.
+// It must be called before the cache is used.
+func (b *buckets) UseDiskTier(d *DiskTier) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.disk = d
+	d.onEvict = func(bucket, key string) {
+		b.notifier(bucket)(Operation{Type: OpEvict, Key: key})
 	}
 }
 
-func (b *buckets) Set(bucket, key string, value []byte, opts ...Option) error {
+// UseCompression compresses the values of a bucket, or of every bucket without its own compression
+// when bucket is empty. It must be called before the cache is used.
+func (b *buckets) UseCompression(bucket string, c Compression) {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.compression == nil {
+		b.compression = make(map[string]Compression)
+	}
+	b.compression[bucket] = c
+}
+
+// UseEncryption encrypts the values of the buckets selected by e. It must be called before the cache is used.
+func (b *buckets) UseEncryption(e *Encryption) {
+	b.Lock()
+	defer b.Unlock()
+	b.encryption = e
+}
+
+// Reencrypt rewraps every value encrypted with an older key of the keyring with its newest key and
+// returns the number of values migrated. Values are not re-encrypted and their CAS is unchanged.
+func (b *buckets) Reencrypt() (int, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	var total int
+	for _, c := range b.buckets {
+		n, err := c.reencrypt()
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (b *buckets) Set(ctx context.Context, bucket, key string, value []byte, opts ...Option) (err error) {
+	ctx, span := startSpan(ctx, "cache.Set", bucket, key)
+	defer func() { endSpan(span, err) }()
+	span.SetAttributes(attrValueSize.Int(len(value)))
+
 	o, err := getOptions(opts...)
 	if err != nil {
 		return err
 	}
 
-	b.Lock()
+	acquire(ctx, "buckets", b.Lock)
 	defer b.Unlock()
+	return b.bucket(bucket).Set(ctx, key, value, o)
+}
+
+// bucket returns the named bucket, creating it on demand. It must be called with the write lock held.
+func (b *buckets) bucket(name string) cache {
+	if _, ok := b.buckets[name]; !ok {
+		c := newCache(b.capacity)
+		c.notify = b.notifier(name)
+		c.cas = &b.cas
+		c.disk = b.disk
+		c.bucket = name
+		if comp, ok := b.compression[name]; ok {
+			c.compression = comp
+		} else {
+			c.compression = b.compression[""]
+		}
+		c.keyring = b.encryption.keyring(name)
+		b.buckets[name] = c
+	}
+	return b.buckets[name]
+}
+
+func (b *buckets) Get(ctx context.Context, bucket, key string, opts ...Option) (value []byte, err error) {
+	ctx, span := startSpan(ctx, "cache.Get", bucket, key)
+	defer func() {
+		if value != nil {
+			span.SetAttributes(attrValueSize.Int(len(value)))
+		}
+		endSpan(span, err)
+	}()
+
+	o, err := getOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	acquire(ctx, "buckets", b.RLock)
+	defer b.RUnlock()
 	if _, ok := b.buckets[bucket]; !ok {
-		b.buckets[bucket] = newCache(255)
+		recordLookup(ctx, false, "")
+		return nil, nil
 	}
-	return b.buckets[bucket].Set(key, value, o)
+	return b.buckets[bucket].Get(ctx, key, o)
 }
 
-func (b *buckets) Get(bucket, key string, opts ...Option) ([]byte, error) {
+func (b *buckets) GetEntry(ctx context.Context, bucket, key string, opts ...Option) (e *Entry, err error) {
+	ctx, span := startSpan(ctx, "cache.GetEntry", bucket, key)
+	defer func() {
+		if e != nil {
+			span.SetAttributes(attrValueSize.Int(len(e.Value)))
+		}
+		endSpan(span, err)
+	}()
+
 	o, err := getOptions(opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	b.RLock()
+	acquire(ctx, "buckets", b.RLock)
 	defer b.RUnlock()
 	if _, ok := b.buckets[bucket]; !ok {
+		recordLookup(ctx, false, "")
 		return nil, nil
 	}
-	return b.buckets[bucket].Get(key, o)
+	return b.buckets[bucket].GetEntry(ctx, key, o)
 }
 
-func (b *buckets) Delete(bucket, key string, opts ...Option) error {
+func (b *buckets) Delete(ctx context.Context, bucket, key string, opts ...Option) (err error) {
+	ctx, span := startSpan(ctx, "cache.Delete", bucket, key)
+	defer func() { endSpan(span, err) }()
+
 	o, err := getOptions(opts...)
 	if err != nil {
 		return err
 	}
 
-	b.RLock()
+	acquire(ctx, "buckets", b.RLock)
 	defer b.RUnlock()
 	if _, ok := b.buckets[bucket]; !ok {
 		return nil
 	}
-	return b.buckets[bucket].Delete(key, o)
+	return b.buckets[bucket].Delete(ctx, key, o)
+}
+
+func (b *buckets) DeleteIf(ctx context.Context, bucket, key string, cond DeleteFunc, opts ...Option) (deleted bool, err error) {
+	ctx, span := startSpan(ctx, "cache.DeleteIf", bucket, key)
+	defer func() { endSpan(span, err) }()
+
+	o, err := getOptions(opts...)
+	if err != nil {
+		return false, err
+	}
+
+	acquire(ctx, "buckets", b.RLock)
+	defer b.RUnlock()
+	if _, ok := b.buckets[bucket]; !ok {
+		cond(nil)
+		return false, nil
+	}
+	return b.buckets[bucket].DeleteIf(ctx, key, cond, o)
+}
+
+func (b *buckets) Update(ctx context.Context, bucket, key string, fn UpdateFunc, opts ...Option) (err error) {
+	ctx, span := startSpan(ctx, "cache.Update", bucket, key)
+	defer func() { endSpan(span, err) }()
+
+	o, err := getOptions(opts...)
+	if err != nil {
+		return err
+	}
+
+	acquire(ctx, "buckets", b.Lock)
+	defer b.Unlock()
+	return b.bucket(bucket).Update(ctx, key, fn, o)
+}
+
+func (b *buckets) Lookup(ctx context.Context, bucket, key string, opts ...Option) (e *Entry, err error) {
+	ctx, span := startSpan(ctx, "cache.Lookup", bucket, key)
+	defer func() {
+		if e != nil {
+			span.SetAttributes(attrValueSize.Int(len(e.Value)))
+		}
+		endSpan(span, err)
+	}()
+
+	o, err := getOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	acquire(ctx, "buckets", b.RLock)
+	defer b.RUnlock()
+	if _, ok := b.buckets[bucket]; !ok {
+		return nil, nil
+	}
+	return b.buckets[bucket].Lookup(ctx, key, o)
+}
+
+func (b *buckets) Flush(ctx context.Context, bucket string) (err error) {
+	_, span := startSpan(ctx, "cache.Flush", bucket, "")
+	defer func() { endSpan(span, err) }()
+
+	return b.Apply(Operation{Type: OpFlush, Bucket: bucket})
+}
+
+func (b *buckets) Buckets() []string {
+	b.RLock()
+	defer b.RUnlock()
+
+	var names []string
+	for name, c := range b.buckets {
+		if len(c.keys(time.Now())) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (b *buckets) Keys(bucket string) []string {
+	b.RLock()
+	defer b.RUnlock()
+
+	c, ok := b.buckets[bucket]
+	if !ok {
+		return nil
+	}
+	keys := c.keys(time.Now())
+	sort.Strings(keys)
+	return keys
+}
+
+func (b *buckets) Apply(op Operation) error {
+	switch op.Type {
+	case OpSet:
+		opts := []Option{WithFlags(op.Flags), WithContentType(op.ContentType), WithMetadata(op.Metadata)}
+		if !op.Expiry.IsZero() {
+			opts = append(opts, withExpiry(op.Expiry))
+		}
+		// an empty value is still a value, a nil value would read as a miss
+		value := op.Value
+		if value == nil {
+			value = []byte{}
+		}
+		return b.Set(context.Background(), op.Bucket, op.Key, value, opts...)
+	case OpDelete, OpExpire, OpEvict:
+		b.RLock()
+		defer b.RUnlock()
+		if c, ok := b.buckets[op.Bucket]; ok {
+			c.drop(op.Key, op.Type)
+		}
+		return nil
+	case OpFlush:
+		b.Lock()
+		defer b.Unlock()
+		if op.Bucket == "" {
+			b.buckets = make(map[string]cache)
+		} else {
+			delete(b.buckets, op.Bucket)
+		}
+		if b.disk != nil {
+			b.disk.flush(op.Bucket)
+		}
+		b.notifier(op.Bucket)(Operation{Type: OpFlush})
+		return nil
+	default:
+		return fmt.Errorf("unknown operation type %d", op.Type)
+	}
+}
+
+func (b *buckets) Subscribe(fn func(Operation)) {
+	b.observersMu.Lock()
+	defer b.observersMu.Unlock()
+	b.observers = append(b.observers, fn)
+}
+
+func (b *buckets) Snapshot(fn func(Operation) error) error {
+	b.RLock()
+	names := make([]string, 0, len(b.buckets))
+	caches := make([]cache, 0, len(b.buckets))
+	for name, c := range b.buckets {
+		names = append(names, name)
+		caches = append(caches, c)
+	}
+	b.RUnlock()
+
+	now := time.Now()
+	for i, c := range caches {
+		records, err := c.records()
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			if r.expiry != nil && now.After(*r.expiry) {
+				continue
+			}
+			op := r.operation()
+			op.Bucket = names[i]
+			if r.expiry != nil {
+				op.Expiry = *r.expiry
+			}
+			if err := fn(op); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *buckets) notifier(bucket string) func(Operation) {
+	return func(op Operation) {
+		op.Bucket = bucket
+		b.observersMu.RLock()
+		defer b.observersMu.RUnlock()
+		for _, fn := range b.observers {
+			fn(op)
+		}
+	}
+}
+
+func (b *buckets) Usage(bucket string) Usage {
+	b.RLock()
+	c, ok := b.buckets[bucket]
+	b.RUnlock()
+
+	var u Usage
+	if ok {
+		u = c.usage()
+	}
+	if b.disk != nil {
+		d := b.disk.bucketUsage(bucket)
+		u.Keys += d.Keys
+		u.Bytes += d.Bytes
+	}
+	return u
 }
 
 func (b *buckets) Stats() stats {
 	b.RLock()
 	defer b.RUnlock()
-	var h, m, e, ex uint64
+	var total stats
 	for _, c := range b.buckets {
 		s := c.Stats()
-		h += s.Hits
-		m += s.Misses
-		e += s.Evictions
-		ex += s.Expired
+		total.Hits += s.Hits
+		total.Misses += s.Misses
+		total.Evictions += s.Evictions
+		total.Expired += s.Expired
+		total.DiskHits += s.DiskHits
+		total.DiskMisses += s.DiskMisses
+		total.Bytes += s.Bytes
+		total.UncompressedBytes += s.UncompressedBytes
 	}
-	return stats{
-		Hits:      h,
-		Misses:    m,
-		Evictions: e,
-		Expired:   ex,
+	if b.disk != nil {
+		total.Evictions += b.disk.Stats().Evictions
 	}
+	return total
 }
 
 type cache interface {
-	Set(key string, value []byte, opts *Options) error
-	Get(key string, opts *Options) ([]byte, error)
-	Delete(key string, opts *Options) error
+	Set(ctx context.Context, key string, value []byte, opts *Options) error
+	Get(ctx context.Context, key string, opts *Options) ([]byte, error)
+	GetEntry(ctx context.Context, key string, opts *Options) (*Entry, error)
+	Delete(ctx context.Context, key string, opts *Options) error
+	DeleteIf(ctx context.Context, key string, cond DeleteFunc, opts *Options) (bool, error)
+	Update(ctx context.Context, key string, fn UpdateFunc, opts *Options) error
+	Lookup(ctx context.Context, key string, opts *Options) (*Entry, error)
 	Stats() stats
+	usage() Usage
+	// drop removes a key and reports it as an operation of type t
+	drop(key string, t OperationType) bool
+	// records returns the records from oldest to newest insertion, with decompressed and decrypted values
+	records() ([]*record, error)
+	// keys returns the keys that have not expired at now
+	keys(now time.Time) []string
+	// reencrypt rewraps the values encrypted with an older key with the newest key
+	reencrypt() (int, error)
 }
 
 func newCache(capacity int) *cacheImplementation {
@@ -184,6 +662,8 @@ func newCache(capacity int) *cacheImplementation {
 		ruIndex:    make(map[string]*list.Element, capacity),
 		oldestList: list.New(),
 		capacity:   capacity,
+		notify:     func(Operation) {},
+		cas:        new(atomic.Uint64),
 	}
 }
 
@@ -191,6 +671,44 @@ type record struct {
 	key    string
 	value  []byte
 	expiry *time.Time
+	flags  uint32
+	cas    uint64
+	// codec is set when value is compressed, size is then the size of the uncompressed value
+	codec Codec
+	size  int
+	// keyID is set when value is an encryption envelope, it is the id of the key wrapping its data key
+	keyID       string
+	contentType string
+	metadata    map[string]string
+}
+
+// operation returns the set operation storing r, its value as stored.
+func (r *record) operation() Operation {
+	op := Operation{Type: OpSet, Key: r.key, Value: r.value, Flags: r.flags, ContentType: r.contentType, Metadata: r.metadata}
+	if r.expiry != nil {
+		op.Expiry = *r.expiry
+	}
+	return op
+}
+
+func (r *record) rawSize() int {
+	if r.codec == nil {
+		return len(r.value)
+	}
+	return r.size
+}
+
+func (c *cacheImplementation) entry(r *record) (*Entry, error) {
+	value, err := c.rawValue(r)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Entry{Value: value, Flags: r.flags, CAS: r.cas, ContentType: r.contentType, Metadata: r.metadata}
+	if r.expiry != nil {
+		e.Expiry = *r.expiry
+	}
+	return e, nil
 }
 
 /*
@@ -202,52 +720,113 @@ type cacheImplementation struct {
 	oldestList *list.List // doubly linked list, front is oldest
 	capacity   int
 	stats      stats
+	// notify is called with every mutation while the lock is held
+	notify func(Operation)
+	cas    *atomic.Uint64
+	// disk holds the records of this bucket evicted from memory, a key is never in both
+	disk        *DiskTier
+	bucket      string
+	compression Compression
+	// keyring encrypts the values of this bucket, nil when they are not encrypted
+	keyring *Keyring
 	sync.RWMutex
 }
 
+// stats counts hits and misses across both tiers, DiskHits and DiskMisses count the gets that
+// missed in memory and were looked up in the disk tier.
+//
+// Bytes is the size of the values held in memory as stored, after compression, and
+// UncompressedBytes their size before compression.
 type stats struct {
 	Hits, Misses, Evictions, Expired uint64
+	DiskHits, DiskMisses             uint64
+	Bytes, UncompressedBytes         uint64
 }
 
-func (c *cacheImplementation) Set(key string, value []byte, opts *Options) error {
-	c.Lock()
-	defer c.Unlock()
-
-	if c.ruList.Len() >= c.capacity {
-		if err := c.evict(opts.evictionPolicy); err != nil {
-			return err
-		}
+// CompressionRatio is UncompressedBytes / Bytes, 1 when nothing is stored.
+func (s stats) CompressionRatio() float64 {
+	if s.Bytes == 0 {
+		return 1
 	}
+	return float64(s.UncompressedBytes) / float64(s.Bytes)
+}
+
+func (c *cacheImplementation) Set(ctx context.Context, key string, value []byte, opts *Options) error {
+	acquire(ctx, "bucket", c.Lock)
+	defer c.Unlock()
 
 	var expiry *time.Time = nil
-	if opts.ttl > 0 {
+	if opts.expiry != nil {
+		expiry = opts.expiry
+	} else if opts.ttl > 0 {
 		t := opts.clock().Add(opts.ttl)
 		expiry = &t
 	}
 
-	r := &record{
-		key:    key,
-		value:  value,
-		expiry: expiry,
+	return c.set(ctx, &record{
+		key:         key,
+		value:       value,
+		expiry:      expiry,
+		flags:       opts.flags,
+		contentType: opts.contentType,
+		metadata:    opts.metadata,
+	}, opts)
+}
+
+// set stores r, assigning it a new CAS unless it has one. It must be called with the lock held.
+func (c *cacheImplementation) set(ctx context.Context, r *record, opts *Options) error {
+	op := r.operation()
+
+	if err := c.compression.compress(r); err != nil {
+		return err
+	}
+	if err := c.seal(r); err != nil {
+		return err
+	}
+	if c.disk != nil {
+		c.disk.remove(c.bucket, r.key)
+	}
+	if err := c.insert(ctx, r, opts); err != nil {
+		return err
+	}
+
+	c.notify(op)
+	return nil
+}
+
+// insert adds r to memory without notifying, making room first. It must be called with the lock held.
+func (c *cacheImplementation) insert(ctx context.Context, r *record, opts *Options) error {
+	if c.ruList.Len() >= c.capacity {
+		if err := c.evict(ctx, opts.evictionPolicy); err != nil {
+			return err
+		}
 	}
 
-	oe, ok := c.ruIndex[key]
+	if r.cas == 0 {
+		r.cas = c.cas.Add(1)
+	}
+
+	oe, ok := c.ruIndex[r.key]
 	if ok {
 		elem, ok := oe.Value.(*list.Element)
 		if ok {
 			c.ruList.MoveToFront(elem)
 			// the old record is replaced with the new one, old one will be garbage collected
+			c.account(elem.Value.(*record), -1)
+			c.account(r, 1)
 			elem.Value = r
 			return nil
 		}
 	}
 
+	c.account(r, 1)
+
 	if c.ruList.Len() == 0 {
-		c.ruIndex[key] = c.oldestList.PushFront(c.ruList.PushFront(r))
+		c.ruIndex[r.key] = c.oldestList.PushFront(c.ruList.PushFront(r))
 		return nil
 	}
 
-	c.ruIndex[key] = c.oldestList.InsertBefore(
+	c.ruIndex[r.key] = c.oldestList.InsertBefore(
 		c.ruList.InsertBefore(r, c.ruList.Front()),
 		c.oldestList.Front(),
 	)
@@ -255,13 +834,35 @@ func (c *cacheImplementation) Set(key string, value []byte, opts *Options) error
 	return nil
 }
 
-func (c *cacheImplementation) Get(key string, opts *Options) ([]byte, error) {
-	c.Lock()
+func (c *cacheImplementation) Get(ctx context.Context, key string, opts *Options) ([]byte, error) {
+	e, err := c.GetEntry(ctx, key, opts)
+	if e == nil {
+		return nil, err
+	}
+	return e.Value, nil
+}
+
+func (c *cacheImplementation) GetEntry(ctx context.Context, key string, opts *Options) (*Entry, error) {
+	acquire(ctx, "bucket", c.Lock)
 	defer c.Unlock()
 
 	elem, ok := c.ruIndex[key]
-	if !ok {
+	promoted := false
+	if !ok && c.disk != nil {
+		var err error
+		if elem, err = c.load(ctx, key, opts); err != nil {
+			return nil, err
+		}
+		if elem == nil {
+			c.stats.DiskMisses++
+		} else {
+			c.stats.DiskHits++
+			promoted = true
+		}
+	}
+	if elem == nil {
 		c.stats.Misses++
+		recordLookup(ctx, false, "")
 		return nil, nil
 	}
 
@@ -271,11 +872,26 @@ func (c *cacheImplementation) Get(key string, opts *Options) ([]byte, error) {
 		c.stats.Misses++
 		c.stats.Expired++
 		c.remove(elem)
+		c.notify(Operation{Type: OpExpire, Key: key})
+		recordExpiry(ctx, key)
+		recordLookup(ctx, false, "")
 		return nil, nil
 	}
 
+	// a promoted record already made room for itself and is the most recently used
+	if promoted {
+		c.stats.Hits++
+		recordLookup(ctx, true, "disk")
+		return c.entry(record)
+	}
+
+	// the entry is read before evicting, as the evicted record may be the one that was read
+	e, err := c.entry(record)
+	if err != nil {
+		return nil, err
+	}
 	if opts.evictOnGet && c.ruList.Len() >= c.capacity {
-		if err := c.evict(EvictOldest); err != nil {
+		if err := c.evict(ctx, EvictOldest); err != nil {
 			return nil, err
 		}
 	} else {
@@ -283,35 +899,310 @@ func (c *cacheImplementation) Get(key string, opts *Options) ([]byte, error) {
 	}
 
 	c.stats.Hits++
-	return record.value, nil
+	recordLookup(ctx, true, "memory")
+	return e, nil
 }
 
-func (c *cacheImplementation) Delete(key string, opts *Options) error {
-	c.Lock()
+func (c *cacheImplementation) Update(ctx context.Context, key string, fn UpdateFunc, opts *Options) error {
+	acquire(ctx, "bucket", c.Lock)
 	defer c.Unlock()
 
+	var err error
 	elem, ok := c.ruIndex[key]
-	if !ok {
-		return nil
+	if !ok && c.disk != nil {
+		if elem, err = c.load(ctx, key, opts); err != nil {
+			return err
+		}
 	}
 
-	c.remove(elem)
+	var current *Entry
+	var currentCAS uint64
+	if elem != nil {
+		r := elem.Value.(*list.Element).Value.(*record)
+		if r.expiry != nil && opts.clock().After(*r.expiry) {
+			c.stats.Expired++
+			c.remove(elem)
+			c.notify(Operation{Type: OpExpire, Key: key})
+			recordExpiry(ctx, key)
+		} else {
+			if current, err = c.entry(r); err != nil {
+				return err
+			}
+			currentCAS = r.cas
+		}
+	}
+
+	next, err := fn(current)
+	if err != nil || next == nil {
+		return err
+	}
+
+	r := &record{key: key, value: next.Value, flags: next.Flags, contentType: next.ContentType, metadata: next.Metadata}
+	if !next.Expiry.IsZero() {
+		r.expiry = &next.Expiry
+	}
+	if currentCAS != 0 && next.CAS == currentCAS {
+		r.cas = currentCAS
+	}
+	return c.set(ctx, r, opts)
+}
+
+func (c *cacheImplementation) Lookup(ctx context.Context, key string, opts *Options) (*Entry, error) {
+	acquire(ctx, "bucket", c.RLock)
+	defer c.RUnlock()
+
+	var r *record
+	if elem, ok := c.ruIndex[key]; ok {
+		r = elem.Value.(*list.Element).Value.(*record)
+	} else if c.disk != nil {
+		var err error
+		if r, err = c.disk.get(c.bucket, key); err != nil {
+			return nil, err
+		}
+	}
+
+	if r == nil || (r.expiry != nil && opts.clock().After(*r.expiry)) {
+		return nil, nil
+	}
+	return c.entry(r)
+}
+
+// load promotes the record of a key from the disk tier and returns its element, or nil when the
+// key is not on disk or has expired. It must be called with the lock held.
+func (c *cacheImplementation) load(ctx context.Context, key string, opts *Options) (elem *list.Element, err error) {
+	ctx, span := startSpan(ctx, "cache.load", c.bucket, key)
+	defer func() {
+		span.SetAttributes(attrHit.Bool(elem != nil))
+		endSpan(span, err)
+	}()
+
+	r, err := c.disk.take(c.bucket, key)
+	if err != nil || r == nil {
+		return nil, err
+	}
+
+	if r.expiry != nil && opts.clock().After(*r.expiry) {
+		c.stats.Expired++
+		c.notify(Operation{Type: OpExpire, Key: key})
+		recordExpiry(ctx, key)
+		return nil, nil
+	}
+
+	if err := c.insert(ctx, r, opts); err != nil {
+		// leave the record on disk when memory cannot make room for it
+		c.disk.put(c.bucket, r)
+		return nil, err
+	}
+	return c.ruIndex[key], nil
+}
+
+func (c *cacheImplementation) Delete(ctx context.Context, key string, opts *Options) error {
+	c.drop(key, OpDelete)
 	return nil
 }
 
+func (c *cacheImplementation) DeleteIf(ctx context.Context, key string, cond DeleteFunc, opts *Options) (bool, error) {
+	acquire(ctx, "bucket", c.Lock)
+	defer c.Unlock()
+
+	var err error
+	elem, ok := c.ruIndex[key]
+	if !ok && c.disk != nil {
+		if elem, err = c.load(ctx, key, opts); err != nil {
+			return false, err
+		}
+	}
+
+	var current *Entry
+	if elem != nil {
+		r := elem.Value.(*list.Element).Value.(*record)
+		if r.expiry != nil && opts.clock().After(*r.expiry) {
+			c.stats.Expired++
+			c.remove(elem)
+			c.notify(Operation{Type: OpExpire, Key: key})
+			recordExpiry(ctx, key)
+			elem = nil
+		} else if current, err = c.entry(r); err != nil {
+			return false, err
+		}
+	}
+
+	if !cond(current) || elem == nil {
+		return false, nil
+	}
+	c.remove(elem)
+	c.notify(Operation{Type: OpDelete, Key: key})
+	return true, nil
+}
+
+func (c *cacheImplementation) drop(key string, t OperationType) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	if elem, ok := c.ruIndex[key]; ok {
+		c.remove(elem)
+	} else if c.disk == nil || !c.disk.remove(c.bucket, key) {
+		return false
+	}
+
+	c.notify(Operation{Type: t, Key: key})
+	return true
+}
+
+func (c *cacheImplementation) records() ([]*record, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	var records []*record
+	if c.disk != nil {
+		var err error
+		if records, err = c.disk.records(c.bucket); err != nil {
+			return nil, err
+		}
+	}
+	for e := c.oldestList.Back(); e != nil; e = e.Prev() {
+		records = append(records, e.Value.(*list.Element).Value.(*record))
+	}
+
+	for i, r := range records {
+		value, err := c.rawValue(r)
+		if err != nil {
+			return nil, err
+		}
+		records[i] = &record{
+			key:         r.key,
+			value:       value,
+			expiry:      r.expiry,
+			flags:       r.flags,
+			cas:         r.cas,
+			contentType: r.contentType,
+			metadata:    r.metadata,
+		}
+	}
+	return records, nil
+}
+
+func (c *cacheImplementation) keys(now time.Time) []string {
+	c.RLock()
+	defer c.RUnlock()
+
+	keys := make([]string, 0, len(c.ruIndex))
+	for key, elem := range c.ruIndex {
+		r := elem.Value.(*list.Element).Value.(*record)
+		if r.expiry == nil || !now.After(*r.expiry) {
+			keys = append(keys, key)
+		}
+	}
+	if c.disk != nil {
+		keys = append(keys, c.disk.keys(c.bucket, now)...)
+	}
+	return keys
+}
+
 func (c *cacheImplementation) Stats() stats {
 	c.RLock()
 	defer c.RUnlock()
 	return c.stats
 }
 
+func (c *cacheImplementation) usage() Usage {
+	c.RLock()
+	defer c.RUnlock()
+	return Usage{Keys: len(c.ruIndex), Bytes: c.stats.UncompressedBytes}
+}
+
 func (c *cacheImplementation) remove(e *list.Element) {
 	c.oldestList.Remove(e)
 	r := c.ruList.Remove(e.Value.(*list.Element)).(*record)
 	delete(c.ruIndex, r.key)
+	c.account(r, -1)
+}
+
+// seal replaces the value of r with an encryption envelope when the bucket is encrypted.
+func (c *cacheImplementation) seal(r *record) error {
+	if c.keyring == nil || r.keyID != "" {
+		return nil
+	}
+
+	envelope, keyID, err := c.keyring.seal(c.bucket, r.key, r.value)
+	if err != nil {
+		return fmt.Errorf("encrypting %s: %w", r.key, err)
+	}
+	r.value, r.keyID = envelope, keyID
+	return nil
+}
+
+// rawValue returns the value of r, decrypting and decompressing it if needed.
+func (c *cacheImplementation) rawValue(r *record) ([]byte, error) {
+	v := r.value
+	if r.keyID != "" {
+		var err error
+		if v, err = c.keyring.open(c.bucket, r.key, v); err != nil {
+			return nil, fmt.Errorf("decrypting %s: %w", r.key, err)
+		}
+	}
+	if r.codec == nil {
+		return v, nil
+	}
+
+	v, err := r.codec.Decompress(v)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing %s with %s: %w", r.key, r.codec.Name(), err)
+	}
+	return v, nil
+}
+
+func (c *cacheImplementation) reencrypt() (int, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.keyring == nil {
+		return 0, nil
+	}
+	newest := c.keyring.Newest()
+	rewrap := func(r *record) (bool, error) {
+		if r.keyID == "" || r.keyID == newest {
+			return false, nil
+		}
+		envelope, err := c.keyring.rewrap(r.value, newest)
+		if err != nil {
+			return false, fmt.Errorf("reencrypting %s: %w", r.key, err)
+		}
+		r.value, r.keyID = envelope, newest
+		return true, nil
+	}
+
+	var n int
+	for e := c.ruList.Front(); e != nil; e = e.Next() {
+		r := e.Value.(*record)
+		c.account(r, -1)
+		ok, err := rewrap(r)
+		c.account(r, 1)
+		if err != nil {
+			return n, err
+		}
+		if ok {
+			n++
+		}
+	}
+
+	if c.disk != nil {
+		m, err := c.disk.rewrite(c.bucket, rewrap)
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// account adds (sign 1) or removes (sign -1) the size of a record held in memory from the stats.
+func (c *cacheImplementation) account(r *record, sign int) {
+	c.stats.Bytes += uint64(sign * len(r.value))
+	c.stats.UncompressedBytes += uint64(sign * r.rawSize())
 }
 
-func (c *cacheImplementation) evict(e EvictionPolicy) error {
+func (c *cacheImplementation) evict(ctx context.Context, e EvictionPolicy) error {
 	elem, err := c.getEvictionCandidate(e)
 	if err != nil {
 		return err
@@ -321,8 +1212,16 @@ func (c *cacheImplementation) evict(e EvictionPolicy) error {
 		return nil
 	}
 
+	r := elem.Value.(*list.Element).Value.(*record)
 	c.remove(elem)
+	// a record that cannot be written to the disk tier is dropped instead
+	if c.disk != nil && c.disk.put(c.bucket, r) == nil {
+		recordEviction(ctx, r.key, e, true)
+		return nil
+	}
 	c.stats.Evictions++
+	c.notify(Operation{Type: OpEvict, Key: r.key})
+	recordEviction(ctx, r.key, e, false)
 	return nil
 }
 
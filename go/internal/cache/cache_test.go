@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -12,15 +13,15 @@ func TestBucket(t *testing.T) {
 	b := NewCache()
 	require.NotNil(t, b)
 
-	require.NoError(t, b.Set("bucket1", "key1", []byte("value1")))
-	record, err := b.Get("bucket1", "key1")
+	require.NoError(t, b.Set(context.Background(), "bucket1", "key1", []byte("value1")))
+	record, err := b.Get(context.Background(), "bucket1", "key1")
 	require.NoError(t, err)
 	require.Equal(t, []byte("value1"), record)
 
 	for i := 0; i < 1000; i++ {
-		require.NoError(t, b.Set("bucket1", fmt.Sprintf("r%d", i), []byte("value1"), WithTTL(0*time.Second), WithEvictionPolicy(EvictLRU)))
+		require.NoError(t, b.Set(context.Background(), "bucket1", fmt.Sprintf("r%d", i), []byte("value1"), WithTTL(0*time.Second), WithEvictionPolicy(EvictLRU)))
 		if i%255 == 0 {
-			r, err := b.Get("bucket1", fmt.Sprintf("r%d", i-255))
+			r, err := b.Get(context.Background(), "bucket1", fmt.Sprintf("r%d", i-255))
 			require.NoError(t, err)
 			require.Nil(t, r)
 		}
@@ -34,15 +35,15 @@ func TestCacheImplementationGet(t *testing.T) {
 	defaultOpts.evictOnGet = false
 	defaultOpts.evictionPolicy = EvictDisabled
 
-	require.NoError(t, c.Set("user:1", []byte("user1"), defaultOpts))
-	record, err := c.Get("user:1", defaultOpts)
+	require.NoError(t, c.Set(context.Background(), "user:1", []byte("user1"), defaultOpts))
+	record, err := c.Get(context.Background(), "user:1", defaultOpts)
 	require.NoError(t, err)
 	require.Equal(t, []byte("user1"), record)
 
 	// By default, eviction is disabled right now, so this will return an error
-	require.Error(t, c.Set("user:2", []byte("user2"), defaultOpts))
+	require.Error(t, c.Set(context.Background(), "user:2", []byte("user2"), defaultOpts))
 	// This record will not be evicted since evictOnGet is false
-	record, err = c.Get("user:1", defaultOpts)
+	record, err = c.Get(context.Background(), "user:1", defaultOpts)
 	require.NoError(t, err)
 	require.Equal(t, []byte("user1"), record)
 }
@@ -53,14 +54,14 @@ func TestLruEviction(t *testing.T) {
 	defaultOpts.evictOnGet = false
 	defaultOpts.evictionPolicy = EvictLRU
 
-	require.NoError(t, c.Set("user:1", []byte("user1"), defaultOpts))
-	record, err := c.Get("user:1", defaultOpts)
+	require.NoError(t, c.Set(context.Background(), "user:1", []byte("user1"), defaultOpts))
+	record, err := c.Get(context.Background(), "user:1", defaultOpts)
 	require.NoError(t, err)
 	require.Equal(t, []byte("user1"), record)
 
-	require.NoError(t, c.Set("user:2", []byte("user2"), defaultOpts))
+	require.NoError(t, c.Set(context.Background(), "user:2", []byte("user2"), defaultOpts))
 	// This record will be evicted since evictOnGet is false
-	record, err = c.Get("user:1", defaultOpts)
+	record, err = c.Get(context.Background(), "user:1", defaultOpts)
 	require.NoError(t, err)
 	require.Nil(t, record)
 }
@@ -71,13 +72,13 @@ func TestLruEvictionIncreasedCapacity(t *testing.T) {
 	defaultOpts.evictOnGet = false
 	defaultOpts.evictionPolicy = EvictLRU
 
-	require.NoError(t, c.Set("user:1", []byte("user1"), defaultOpts))
-	require.NoError(t, c.Set("user:2", []byte("user2"), defaultOpts))
-	record, err := c.Get("user:1", defaultOpts)
+	require.NoError(t, c.Set(context.Background(), "user:1", []byte("user1"), defaultOpts))
+	require.NoError(t, c.Set(context.Background(), "user:2", []byte("user2"), defaultOpts))
+	record, err := c.Get(context.Background(), "user:1", defaultOpts)
 	require.NoError(t, err)
 	require.Equal(t, []byte("user1"), record)
-	require.NoError(t, c.Set("user:3", []byte("user3"), defaultOpts))
-	record, err = c.Get("user:2", defaultOpts)
+	require.NoError(t, c.Set(context.Background(), "user:3", []byte("user3"), defaultOpts))
+	record, err = c.Get(context.Background(), "user:2", defaultOpts)
 	require.NoError(t, err)
 	require.Nil(t, record)
 }
@@ -88,13 +89,13 @@ func TestMruEviction(t *testing.T) {
 	defaultOpts.evictOnGet = false
 	defaultOpts.evictionPolicy = EvictMRU
 
-	require.NoError(t, c.Set("user:1", []byte("user1"), defaultOpts))
-	require.NoError(t, c.Set("user:2", []byte("user2"), defaultOpts))
-	record, err := c.Get("user:1", defaultOpts)
+	require.NoError(t, c.Set(context.Background(), "user:1", []byte("user1"), defaultOpts))
+	require.NoError(t, c.Set(context.Background(), "user:2", []byte("user2"), defaultOpts))
+	record, err := c.Get(context.Background(), "user:1", defaultOpts)
 	require.NoError(t, err)
 	require.Equal(t, []byte("user1"), record)
-	require.NoError(t, c.Set("user:3", []byte("user3"), defaultOpts))
-	record, err = c.Get("user:1", defaultOpts)
+	require.NoError(t, c.Set(context.Background(), "user:3", []byte("user3"), defaultOpts))
+	record, err = c.Get(context.Background(), "user:1", defaultOpts)
 	require.NoError(t, err)
 	require.Nil(t, record)
 }
@@ -111,15 +112,15 @@ func TestTtlExpiry(t *testing.T) {
 		return now
 	}
 
-	require.NoError(t, c.Set("user:1", []byte("user1"), defaultOpts))
-	record, err := c.Get("user:1", defaultOpts)
+	require.NoError(t, c.Set(context.Background(), "user:1", []byte("user1"), defaultOpts))
+	record, err := c.Get(context.Background(), "user:1", defaultOpts)
 	require.NoError(t, err)
 	require.Equal(t, []byte("user1"), record)
 
 	defaultOpts.clock = func() time.Time {
 		return now.Add(2 * time.Second)
 	}
-	record, err = c.Get("user:1", defaultOpts)
+	record, err = c.Get(context.Background(), "user:1", defaultOpts)
 	require.NoError(t, err)
 	require.Nil(t, record)
 
@@ -136,14 +137,14 @@ func TestOldestEviction(t *testing.T) {
 	defaultOpts.evictOnGet = false
 	defaultOpts.evictionPolicy = EvictOldest
 
-	require.NoError(t, c.Set("user:1", []byte("user1"), defaultOpts))
-	record, err := c.Get("user:1", defaultOpts)
+	require.NoError(t, c.Set(context.Background(), "user:1", []byte("user1"), defaultOpts))
+	record, err := c.Get(context.Background(), "user:1", defaultOpts)
 	require.NoError(t, err)
 	require.Equal(t, []byte("user1"), record)
 
-	require.NoError(t, c.Set("user:2", []byte("user2"), defaultOpts))
+	require.NoError(t, c.Set(context.Background(), "user:2", []byte("user2"), defaultOpts))
 	// This record will be evicted since evictOnGet is false
-	record, err = c.Get("user:1", defaultOpts)
+	record, err = c.Get(context.Background(), "user:1", defaultOpts)
 	require.NoError(t, err)
 	require.Nil(t, record)
 
@@ -153,3 +154,140 @@ func TestOldestEviction(t *testing.T) {
 	require.Equal(t, uint64(1), stats.Evictions)
 	require.Equal(t, uint64(0), stats.Expired)
 }
+
+func TestUpdate(t *testing.T) {
+	b := NewCache()
+
+	incr := func(current *Entry) (*Entry, error) {
+		if current == nil {
+			return &Entry{Value: []byte("1")}, nil
+		}
+		return &Entry{Value: append(current.Value, '1'), Expiry: current.Expiry}, nil
+	}
+	require.NoError(t, b.Update(context.Background(), "bucket1", "key1", incr))
+	require.NoError(t, b.Update(context.Background(), "bucket1", "key1", incr))
+	v, err := b.Get(context.Background(), "bucket1", "key1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("11"), v)
+
+	// returning nil leaves the key unchanged
+	require.NoError(t, b.Update(context.Background(), "bucket1", "key2", func(current *Entry) (*Entry, error) {
+		require.Nil(t, current)
+		return nil, nil
+	}))
+	e, err := b.Lookup(context.Background(), "bucket1", "key2")
+	require.NoError(t, err)
+	require.Nil(t, e)
+
+	// Lookup does not count hits or misses
+	before := b.Stats()
+	e, err = b.Lookup(context.Background(), "bucket1", "key1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("11"), e.Value)
+	require.True(t, e.Expiry.IsZero())
+	require.Equal(t, before, b.Stats())
+}
+
+func TestUpdateExpired(t *testing.T) {
+	b := NewCache()
+	now := time.Now()
+	require.NoError(t, b.Set(context.Background(), "bucket1", "key1", []byte("value1"), WithTTL(time.Second), WithClock(func() time.Time { return now })))
+
+	later := WithClock(func() time.Time { return now.Add(2 * time.Second) })
+	e, err := b.Lookup(context.Background(), "bucket1", "key1", later)
+	require.NoError(t, err)
+	require.Nil(t, e)
+
+	require.NoError(t, b.Update(context.Background(), "bucket1", "key1", func(current *Entry) (*Entry, error) {
+		require.Nil(t, current)
+		return &Entry{Value: []byte("value2")}, nil
+	}, later))
+	require.Equal(t, uint64(1), b.Stats().Expired)
+}
+
+func TestDeleteIf(t *testing.T) {
+	b := NewCache()
+	require.NoError(t, b.Set(context.Background(), "bucket1", "key1", []byte("value1")))
+	e, err := b.Lookup(context.Background(), "bucket1", "key1")
+	require.NoError(t, err)
+
+	deleted, err := b.DeleteIf(context.Background(), "bucket1", "key1", func(current *Entry) bool {
+		return current.CAS != e.CAS
+	})
+	require.NoError(t, err)
+	require.False(t, deleted)
+	require.Equal(t, Usage{Keys: 1, Bytes: 6}, b.Usage("bucket1"))
+
+	deleted, err = b.DeleteIf(context.Background(), "bucket1", "key1", func(current *Entry) bool {
+		return current.CAS == e.CAS
+	})
+	require.NoError(t, err)
+	require.True(t, deleted)
+	require.Equal(t, Usage{}, b.Usage("bucket1"))
+
+	// cond receives nil for a missing key, which cannot be deleted
+	for _, bucket := range []string{"bucket1", "bucket2"} {
+		deleted, err = b.DeleteIf(context.Background(), bucket, "key1", func(current *Entry) bool {
+			require.Nil(t, current)
+			return true
+		})
+		require.NoError(t, err)
+		require.False(t, deleted)
+	}
+
+	_, err = ReadOnly(b).DeleteIf(context.Background(), "bucket1", "key1", func(*Entry) bool { return true })
+	require.ErrorIs(t, err, ErrReadOnly)
+}
+
+func TestFlagsAndCAS(t *testing.T) {
+	b := NewCache()
+	require.NoError(t, b.Set(context.Background(), "bucket1", "key1", []byte("value1"), WithFlags(42)))
+
+	e, err := b.Lookup(context.Background(), "bucket1", "key1")
+	require.NoError(t, err)
+	require.Equal(t, uint32(42), e.Flags)
+	require.NotZero(t, e.CAS)
+	cas := e.CAS
+
+	// returning the current CAS keeps it
+	require.NoError(t, b.Update(context.Background(), "bucket1", "key1", func(current *Entry) (*Entry, error) {
+		next := *current
+		next.Expiry = time.Now().Add(time.Hour)
+		return &next, nil
+	}))
+	e, err = b.Lookup(context.Background(), "bucket1", "key1")
+	require.NoError(t, err)
+	require.Equal(t, cas, e.CAS)
+	require.Equal(t, uint32(42), e.Flags)
+
+	// any other write assigns a new CAS, unique across buckets
+	require.NoError(t, b.Set(context.Background(), "bucket1", "key1", []byte("value2")))
+	require.NoError(t, b.Set(context.Background(), "bucket2", "key1", []byte("value2")))
+	e, err = b.Lookup(context.Background(), "bucket1", "key1")
+	require.NoError(t, err)
+	require.Greater(t, e.CAS, cas)
+	require.Zero(t, e.Flags)
+	e2, err := b.Lookup(context.Background(), "bucket2", "key1")
+	require.NoError(t, err)
+	require.NotEqual(t, e.CAS, e2.CAS)
+
+	require.NoError(t, b.Flush(context.Background(), "bucket1"))
+	e, err = b.Lookup(context.Background(), "bucket1", "key1")
+	require.NoError(t, err)
+	require.Nil(t, e)
+}
+
+func TestBucketsAndKeys(t *testing.T) {
+	b := NewCache()
+	past := time.Now().Add(-time.Minute)
+	require.NoError(t, b.Set(context.Background(), "bucket2", "key2", []byte("value")))
+	require.NoError(t, b.Set(context.Background(), "bucket2", "key1", []byte("value")))
+	require.NoError(t, b.Set(context.Background(), "bucket1", "key1", []byte("value")))
+	require.NoError(t, b.Set(context.Background(), "bucket1", "expired", []byte("value"), WithClock(func() time.Time { return past }), WithTTL(time.Second)))
+	require.NoError(t, b.Set(context.Background(), "bucket3", "expired", []byte("value"), WithClock(func() time.Time { return past }), WithTTL(time.Second)))
+
+	require.Equal(t, []string{"bucket1", "bucket2"}, b.Buckets())
+	require.Equal(t, []string{"key1", "key2"}, b.Keys("bucket2"))
+	require.Equal(t, []string{"key1"}, b.Keys("bucket1"))
+	require.Empty(t, b.Keys("missing"))
+}
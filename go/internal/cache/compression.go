@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Codec compresses values. Values are compressed when they are stored and decompressed when they
+// are read, so compression is invisible to callers, replication and the append-only log.
+type Codec interface {
+	Name() string
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+// Compression configures the compression of the values of a bucket.
+type Compression struct {
+	Codec Codec
+	// MinSize is the value size in bytes below which values are stored raw
+	MinSize int
+}
+
+var Gzip Codec = &gzipCodec{}
+
+// CodecByName returns the codec with the given name, only gzip is supported.
+func CodecByName(name string) (Codec, error) {
+	switch name {
+	case Gzip.Name():
+		return Gzip, nil
+	default:
+		return nil, fmt.Errorf("unknown compression codec %q", name)
+	}
+}
+
+type gzipCodec struct {
+	writers sync.Pool
+}
+
+func (g *gzipCodec) Name() string {
+	return "gzip"
+}
+
+func (g *gzipCodec) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, ok := g.writers.Get().(*gzip.Writer)
+	if ok {
+		w.Reset(&buf)
+	} else {
+		w = gzip.NewWriter(&buf)
+	}
+	defer g.writers.Put(w)
+
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (g *gzipCodec) Decompress(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// compress replaces the value of r with its compressed form when it is large enough and compression
+// makes it smaller.
+func (c Compression) compress(r *record) error {
+	if c.Codec == nil || len(r.value) < c.MinSize || r.codec != nil {
+		return nil
+	}
+
+	b, err := c.Codec.Compress(r.value)
+	if err != nil {
+		return err
+	}
+	if len(b) < len(r.value) {
+		r.value, r.codec, r.size = b, c.Codec, len(r.value)
+	}
+	return nil
+}
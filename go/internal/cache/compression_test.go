@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompression(t *testing.T) {
+	b := NewCache()
+	b.UseCompression("compressed", Compression{Codec: Gzip, MinSize: 64})
+
+	var ops []Operation
+	b.Subscribe(func(op Operation) { ops = append(ops, op) })
+
+	large := bytes.Repeat([]byte(`{"name":"value"}`), 1000)
+	small := []byte(`{"name":"value"}`)
+	require.NoError(t, b.Set(context.Background(), "compressed", "large", large, WithFlags(5)))
+	require.NoError(t, b.Set(context.Background(), "compressed", "small", small))
+	require.NoError(t, b.Set(context.Background(), "raw", "large", large))
+
+	// observers see the uncompressed value
+	require.Equal(t, large, ops[0].Value)
+
+	v, err := b.Get(context.Background(), "compressed", "large")
+	require.NoError(t, err)
+	require.Equal(t, large, v)
+
+	v, err = b.Get(context.Background(), "compressed", "small")
+	require.NoError(t, err)
+	require.Equal(t, small, v)
+
+	e, err := b.Lookup(context.Background(), "compressed", "large")
+	require.NoError(t, err)
+	require.Equal(t, large, e.Value)
+	require.Equal(t, uint32(5), e.Flags)
+
+	s := b.Stats()
+	require.Equal(t, uint64(2*len(large)+len(small)), s.UncompressedBytes)
+	require.Less(t, s.Bytes, uint64(len(large)+len(small)+len(large)/10))
+	require.Greater(t, s.CompressionRatio(), 1.5)
+
+	require.NoError(t, b.Update(context.Background(), "compressed", "large", func(current *Entry) (*Entry, error) {
+		require.Equal(t, large, current.Value)
+		return &Entry{Value: small}, nil
+	}))
+	require.NoError(t, b.Delete(context.Background(), "raw", "large"))
+
+	s = b.Stats()
+	require.Equal(t, uint64(2*len(small)), s.Bytes)
+	require.Equal(t, uint64(2*len(small)), s.UncompressedBytes)
+	require.Equal(t, 1.0, s.CompressionRatio())
+}
+
+func TestCompressionSnapshotAndDiskTier(t *testing.T) {
+	b, d := newTestDiskCache(t, 1, DiskTierConfig{})
+	b.UseCompression("", Compression{Codec: Gzip})
+
+	large := bytes.Repeat([]byte("value"), 1000)
+	require.NoError(t, b.Set(context.Background(), "bucket", "key1", large))
+	require.NoError(t, b.Set(context.Background(), "bucket", "key2", large))
+
+	// the spilled value is written compressed
+	require.Less(t, d.Stats().Bytes, int64(len(large)))
+
+	var values [][]byte
+	require.NoError(t, b.Snapshot(func(op Operation) error {
+		values = append(values, op.Value)
+		return nil
+	}))
+	require.Equal(t, [][]byte{large, large}, values)
+
+	v, err := b.Get(context.Background(), "bucket", "key1")
+	require.NoError(t, err)
+	require.Equal(t, large, v)
+}
+
+func TestCodecByName(t *testing.T) {
+	c, err := CodecByName("gzip")
+	require.NoError(t, err)
+	require.Equal(t, Gzip, c)
+
+	_, err = CodecByName("lz4")
+	require.Error(t, err)
+}
@@ -0,0 +1,413 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+/*
+The disk tier holds records evicted from memory. Records are appended to segment files using the
+append-only log record format, and an in-memory index maps every key to its latest record.
+
+Writing a key again or removing it leaves garbage in its segment. Once the active segment is full a
+new one is started, sealed segments that are mostly garbage are compacted by copying their live
+records to the active segment, and while the tier is over its byte budget the oldest segment is
+dropped along with the records it holds, which are reported as evictions.
+
+The tier is a cache: it starts empty and its files are removed when it is opened.
+*/
+
+const diskSegmentExt = ".seg"
+
+type DiskTierConfig struct {
+	Dir string
+	// MaxBytes is the budget of the segment files
+	MaxBytes int64
+	// SegmentSize is the size at which a new segment is started, at most a quarter of MaxBytes
+	SegmentSize int64
+}
+
+type DiskTier struct {
+	config DiskTierConfig
+
+	mu       sync.Mutex
+	segments []*diskSegment // oldest first, the last one is active
+	index    map[diskKey]*diskRecord
+	size     int64
+	// usage counts the keys and value bytes of every bucket
+	usage  map[string]Usage
+	nextID int
+	// onEvict is called with the lock held for every record dropped to stay within budget
+	onEvict   func(bucket, key string)
+	evictions uint64
+}
+
+type diskKey struct {
+	bucket, key string
+}
+
+type diskSegment struct {
+	id   int
+	file *os.File
+	size int64
+	live int64
+	keys map[diskKey]struct{}
+}
+
+type diskRecord struct {
+	segment *diskSegment
+	offset  int64
+	size    int64
+	expiry  *time.Time
+	cas     uint64
+	// codec and rawSize describe a compressed value, which is written as is
+	codec   Codec
+	rawSize int
+	keyID   string
+	// valueSize is the size of the value before compression, counted in the usage of its bucket
+	valueSize int
+}
+
+func OpenDiskTier(config DiskTierConfig) (*DiskTier, error) {
+	if config.MaxBytes <= 0 {
+		return nil, fmt.Errorf("disk tier max bytes must be positive")
+	}
+	if config.SegmentSize <= 0 || config.SegmentSize > config.MaxBytes/4 {
+		config.SegmentSize = config.MaxBytes / 4
+	}
+
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	stale, err := filepath.Glob(filepath.Join(config.Dir, "*"+diskSegmentExt))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range stale {
+		if err := os.Remove(name); err != nil {
+			return nil, err
+		}
+	}
+
+	d := &DiskTier{
+		config:  config,
+		index:   make(map[diskKey]*diskRecord),
+		usage:   make(map[string]Usage),
+		onEvict: func(string, string) {},
+	}
+	if err := d.rotate(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *DiskTier) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var errs []error
+	for _, s := range d.segments {
+		errs = append(errs, s.file.Close(), os.Remove(s.file.Name()))
+	}
+	d.segments = nil
+	d.index = make(map[diskKey]*diskRecord)
+	d.usage = make(map[string]Usage)
+	d.size = 0
+	return errors.Join(errs...)
+}
+
+type DiskTierStats struct {
+	Keys      int
+	Bytes     int64
+	Evictions uint64
+}
+
+func (d *DiskTier) Stats() DiskTierStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return DiskTierStats{Keys: len(d.index), Bytes: d.size, Evictions: d.evictions}
+}
+
+func (d *DiskTier) active() *diskSegment {
+	return d.segments[len(d.segments)-1]
+}
+
+// rotate starts a new active segment, it must be called with the lock held.
+func (d *DiskTier) rotate() error {
+	name := filepath.Join(d.config.Dir, fmt.Sprintf("%08d%s", d.nextID, diskSegmentExt))
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	d.segments = append(d.segments, &diskSegment{id: d.nextID, file: f, keys: make(map[diskKey]struct{})})
+	d.nextID++
+	return nil
+}
+
+func (d *DiskTier) put(bucket string, r *record) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.write(bucket, r); err != nil {
+		return err
+	}
+	return d.maintain()
+}
+
+// write appends r to the active segment, it must be called with the lock held.
+func (d *DiskTier) write(bucket string, r *record) error {
+	op := r.operation()
+	op.Bucket = bucket
+	b := encodeOperation(op)
+	if int64(len(b)) > d.config.SegmentSize {
+		return fmt.Errorf("record of %d bytes exceeds the disk tier segment size", len(b))
+	}
+
+	if d.active().size+int64(len(b)) > d.config.SegmentSize {
+		if err := d.rotate(); err != nil {
+			return err
+		}
+	}
+
+	s := d.active()
+	if _, err := s.file.Write(b); err != nil {
+		return err
+	}
+
+	k := diskKey{bucket, r.key}
+	d.unindex(k)
+	d.index[k] = &diskRecord{segment: s, offset: s.size, size: int64(len(b)), expiry: r.expiry, cas: r.cas, codec: r.codec, rawSize: r.size, keyID: r.keyID, valueSize: r.rawSize()}
+	u := d.usage[bucket]
+	u.Keys++
+	u.Bytes += uint64(r.rawSize())
+	d.usage[bucket] = u
+	s.keys[k] = struct{}{}
+	s.live += int64(len(b))
+	s.size += int64(len(b))
+	d.size += int64(len(b))
+	return nil
+}
+
+// unindex forgets the record of k, its bytes become garbage. It must be called with the lock held.
+func (d *DiskTier) unindex(k diskKey) bool {
+	rec, ok := d.index[k]
+	if !ok {
+		return false
+	}
+	delete(d.index, k)
+	delete(rec.segment.keys, k)
+	rec.segment.live -= rec.size
+
+	u := d.usage[k.bucket]
+	u.Keys--
+	u.Bytes -= uint64(rec.valueSize)
+	if u.Keys == 0 {
+		delete(d.usage, k.bucket)
+	} else {
+		d.usage[k.bucket] = u
+	}
+	return true
+}
+
+// maintain compacts sealed segments that are mostly garbage and then drops the oldest segments
+// until the tier is within budget. It must be called with the lock held.
+func (d *DiskTier) maintain() error {
+	for i := 0; i < len(d.segments)-1; i++ {
+		s := d.segments[i]
+		if s.live*2 >= s.size {
+			continue
+		}
+		if err := d.compact(s); err != nil {
+			return err
+		}
+		i--
+	}
+
+	for d.size > d.config.MaxBytes && len(d.segments) > 1 {
+		s := d.segments[0]
+		for k := range s.keys {
+			d.unindex(k)
+			d.evictions++
+			d.onEvict(k.bucket, k.key)
+		}
+		if err := d.removeSegment(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compact copies the live records of a sealed segment to the active segment and removes it.
+func (d *DiskTier) compact(s *diskSegment) error {
+	for k := range s.keys {
+		r, err := d.read(k, d.index[k])
+		if err != nil {
+			return err
+		}
+		if err := d.write(k.bucket, r); err != nil {
+			return err
+		}
+	}
+	return d.removeSegment(s)
+}
+
+func (d *DiskTier) removeSegment(s *diskSegment) error {
+	for i, seg := range d.segments {
+		if seg == s {
+			d.segments = append(d.segments[:i], d.segments[i+1:]...)
+			break
+		}
+	}
+	d.size -= s.size
+	s.file.Close()
+	return os.Remove(s.file.Name())
+}
+
+// read loads a record, it must be called with the lock held.
+func (d *DiskTier) read(k diskKey, rec *diskRecord) (*record, error) {
+	op, _, err := readOperation(io.NewSectionReader(rec.segment.file, rec.offset, rec.size), rec.size)
+	if err != nil {
+		return nil, fmt.Errorf("disk tier %s/%s: %w", k.bucket, k.key, err)
+	}
+
+	value := op.Value
+	if value == nil {
+		value = []byte{}
+	}
+	return &record{
+		key:         op.Key,
+		value:       value,
+		expiry:      rec.expiry,
+		flags:       op.Flags,
+		cas:         rec.cas,
+		codec:       rec.codec,
+		size:        rec.rawSize,
+		keyID:       rec.keyID,
+		contentType: op.ContentType,
+		metadata:    op.Metadata,
+	}, nil
+}
+
+// get returns the record of a key without removing it, or nil.
+func (d *DiskTier) get(bucket, key string) (*record, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	k := diskKey{bucket, key}
+	rec, ok := d.index[k]
+	if !ok {
+		return nil, nil
+	}
+	return d.read(k, rec)
+}
+
+// take removes the record of a key and returns it, or nil.
+func (d *DiskTier) take(bucket, key string) (*record, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	k := diskKey{bucket, key}
+	rec, ok := d.index[k]
+	if !ok {
+		return nil, nil
+	}
+	r, err := d.read(k, rec)
+	d.unindex(k)
+	return r, err
+}
+
+func (d *DiskTier) remove(bucket, key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.unindex(diskKey{bucket, key})
+}
+
+// bucketUsage returns the keys and value bytes of a bucket held on disk.
+func (d *DiskTier) bucketUsage(bucket string) Usage {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.usage[bucket]
+}
+
+// flush removes the records of a bucket, or every record when bucket is empty.
+func (d *DiskTier) flush(bucket string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for k := range d.index {
+		if bucket == "" || k.bucket == bucket {
+			d.unindex(k)
+		}
+	}
+}
+
+// records returns the records of a bucket from oldest to newest.
+func (d *DiskTier) records(bucket string) ([]*record, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var records []*record
+	for _, s := range d.segments {
+		for k := range s.keys {
+			if k.bucket != bucket {
+				continue
+			}
+			r, err := d.read(k, d.index[k])
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+// rewrite calls fn with every record of a bucket and writes the records it changed again,
+// returning how many were changed.
+func (d *DiskTier) rewrite(bucket string, fn func(*record) (bool, error)) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var n int
+	for k, rec := range d.index {
+		if k.bucket != bucket {
+			continue
+		}
+		r, err := d.read(k, rec)
+		if err != nil {
+			return n, err
+		}
+		changed, err := fn(r)
+		if err != nil {
+			return n, err
+		}
+		if !changed {
+			continue
+		}
+		if err := d.write(bucket, r); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, d.maintain()
+}
+
+// keys returns the keys of a bucket that have not expired at now.
+func (d *DiskTier) keys(bucket string, now time.Time) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var keys []string
+	for k, rec := range d.index {
+		if k.bucket == bucket && (rec.expiry == nil || !now.After(*rec.expiry)) {
+			keys = append(keys, k.key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDiskCache(t *testing.T, capacity int, config DiskTierConfig) (*buckets, *DiskTier) {
+	t.Helper()
+	config.Dir = t.TempDir()
+	if config.MaxBytes == 0 {
+		config.MaxBytes = 1 << 20
+	}
+	d, err := OpenDiskTier(config)
+	require.NoError(t, err)
+	t.Cleanup(func() { d.Close() })
+
+	b := NewCacheWithCapacity(capacity)
+	b.UseDiskTier(d)
+	return b, d
+}
+
+func TestDiskTierSpillAndPromote(t *testing.T) {
+	b, d := newTestDiskCache(t, 2, DiskTierConfig{})
+
+	var ops []Operation
+	b.Subscribe(func(op Operation) { ops = append(ops, op) })
+
+	require.NoError(t, b.Set(context.Background(), "bucket", "key1", []byte("value1"), WithFlags(3)))
+	e, err := b.Lookup(context.Background(), "bucket", "key1")
+	require.NoError(t, err)
+	cas := e.CAS
+
+	require.NoError(t, b.Set(context.Background(), "bucket", "key2", []byte("value2")))
+	require.NoError(t, b.Set(context.Background(), "bucket", "key3", []byte("value3")))
+	require.Equal(t, 1, d.Stats().Keys)
+	require.Equal(t, []string{"key1", "key2", "key3"}, b.Keys("bucket"))
+	require.Equal(t, Usage{Keys: 3, Bytes: 18}, b.Usage("bucket"))
+
+	// spilling is not an eviction, the key is still in the cache
+	for _, op := range ops {
+		require.Equal(t, OpSet, op.Type)
+	}
+
+	e, err = b.Lookup(context.Background(), "bucket", "key1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("value1"), e.Value)
+	require.Equal(t, uint32(3), e.Flags)
+	require.Equal(t, cas, e.CAS)
+
+	v, err := b.Get(context.Background(), "bucket", "key1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("value1"), v)
+
+	v, err = b.Get(context.Background(), "bucket", "missing")
+	require.NoError(t, err)
+	require.Nil(t, v)
+
+	s := b.Stats()
+	require.Equal(t, uint64(1), s.DiskHits)
+	require.Equal(t, uint64(1), s.DiskMisses)
+	require.Equal(t, uint64(1), s.Hits)
+	require.Equal(t, uint64(1), s.Misses)
+	require.Equal(t, uint64(0), s.Evictions)
+
+	// key1 was promoted and another key spilled to make room for it
+	require.Equal(t, 1, d.Stats().Keys)
+	r, err := d.get("bucket", "key1")
+	require.NoError(t, err)
+	require.Nil(t, r)
+}
+
+func TestDiskTierExpiry(t *testing.T) {
+	b, _ := newTestDiskCache(t, 1, DiskTierConfig{})
+
+	now := time.Now()
+	require.NoError(t, b.Set(context.Background(), "bucket", "key1", []byte("value1"), WithTTL(time.Minute)))
+	require.NoError(t, b.Set(context.Background(), "bucket", "key2", []byte("value2")))
+
+	later := WithClock(func() time.Time { return now.Add(time.Hour) })
+	e, err := b.Lookup(context.Background(), "bucket", "key1", later)
+	require.NoError(t, err)
+	require.Nil(t, e)
+
+	v, err := b.Get(context.Background(), "bucket", "key1", later)
+	require.NoError(t, err)
+	require.Nil(t, v)
+
+	s := b.Stats()
+	require.Equal(t, uint64(1), s.Expired)
+	require.Equal(t, uint64(1), s.DiskMisses)
+}
+
+func TestDiskTierDeleteAndFlush(t *testing.T) {
+	b, d := newTestDiskCache(t, 1, DiskTierConfig{})
+
+	require.NoError(t, b.Set(context.Background(), "bucket1", "key1", []byte("value1")))
+	require.NoError(t, b.Set(context.Background(), "bucket1", "key2", []byte("value2")))
+	require.NoError(t, b.Set(context.Background(), "bucket2", "key1", []byte("value1")))
+	require.NoError(t, b.Set(context.Background(), "bucket2", "key2", []byte("value2")))
+	require.Equal(t, 2, d.Stats().Keys)
+
+	require.NoError(t, b.Delete(context.Background(), "bucket1", "key1"))
+	v, err := b.Get(context.Background(), "bucket1", "key1")
+	require.NoError(t, err)
+	require.Nil(t, v)
+
+	require.NoError(t, b.Flush(context.Background(), "bucket2"))
+	require.Equal(t, 0, d.Stats().Keys)
+	require.Equal(t, []string{"bucket1"}, b.Buckets())
+}
+
+func TestDiskTierSnapshot(t *testing.T) {
+	b, _ := newTestDiskCache(t, 1, DiskTierConfig{})
+
+	require.NoError(t, b.Set(context.Background(), "bucket", "key1", []byte("value1")))
+	require.NoError(t, b.Set(context.Background(), "bucket", "key2", []byte{}))
+
+	var keys []string
+	require.NoError(t, b.Snapshot(func(op Operation) error {
+		require.NotNil(t, op.Value)
+		keys = append(keys, op.Key)
+		return nil
+	}))
+	require.Equal(t, []string{"key1", "key2"}, keys)
+}
+
+func TestDiskTierBudget(t *testing.T) {
+	b, d := newTestDiskCache(t, 1, DiskTierConfig{MaxBytes: 4096, SegmentSize: 1024})
+
+	var evicted []string
+	b.Subscribe(func(op Operation) {
+		if op.Type == OpEvict {
+			evicted = append(evicted, op.Key)
+		}
+	})
+
+	value := make([]byte, 100)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, b.Set(context.Background(), "bucket", fmt.Sprintf("key%d", i), value))
+	}
+
+	s := d.Stats()
+	require.LessOrEqual(t, s.Bytes, int64(4096))
+	require.NotEmpty(t, evicted)
+	require.Equal(t, uint64(len(evicted)), s.Evictions)
+	require.Equal(t, s.Evictions, b.Stats().Evictions)
+	require.Equal(t, 100-len(evicted), len(b.Keys("bucket")))
+
+	// the oldest keys are dropped first
+	v, err := b.Get(context.Background(), "bucket", "key0")
+	require.NoError(t, err)
+	require.Nil(t, v)
+	v, err = b.Get(context.Background(), "bucket", "key98")
+	require.NoError(t, err)
+	require.Equal(t, value, v)
+}
+
+func TestDiskTierCompaction(t *testing.T) {
+	d, err := OpenDiskTier(DiskTierConfig{Dir: t.TempDir(), MaxBytes: 1 << 20, SegmentSize: 1024})
+	require.NoError(t, err)
+	defer d.Close()
+
+	value := make([]byte, 100)
+	for i := 0; i < 50; i++ {
+		require.NoError(t, d.put("bucket", &record{key: fmt.Sprintf("key%d", i%5), value: value, cas: uint64(i + 1)}))
+	}
+
+	// only the last write of each key is live, the rest is compacted away
+	s := d.Stats()
+	require.Equal(t, 5, s.Keys)
+	require.Less(t, s.Bytes, int64(3*1024))
+
+	files, err := os.ReadDir(d.config.Dir)
+	require.NoError(t, err)
+	require.Len(t, files, len(d.segments))
+
+	for i := 0; i < 5; i++ {
+		r, err := d.get("bucket", fmt.Sprintf("key%d", i))
+		require.NoError(t, err)
+		require.Equal(t, value, r.value)
+		require.Equal(t, uint64(45+i+1), r.cas)
+	}
+}
+
+func TestOpenDiskTierRemovesSegments(t *testing.T) {
+	dir := t.TempDir()
+	d, err := OpenDiskTier(DiskTierConfig{Dir: dir, MaxBytes: 1 << 20})
+	require.NoError(t, err)
+	require.NoError(t, d.put("bucket", &record{key: "key", value: []byte("value")}))
+
+	d, err = OpenDiskTier(DiskTierConfig{Dir: dir, MaxBytes: 1 << 20})
+	require.NoError(t, err)
+	defer d.Close()
+
+	r, err := d.get("bucket", "key")
+	require.NoError(t, err)
+	require.Nil(t, r)
+}
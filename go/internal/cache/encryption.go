@@ -0,0 +1,301 @@
+package cache
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+/*
+Values are encrypted with envelope encryption. Every value is encrypted with its own random data
+key, and the data key is encrypted (wrapped) with a key of the keyring. Rotating to a new keyring
+key only rewraps the data keys, values are never re-encrypted. An envelope is:
+
+	| version uint8 | key id len uint8 | key id | nonce | wrapped data key | nonce | encrypted value |
+
+The value is authenticated with its bucket and key so that an envelope cannot be moved to another key.
+
+The keyring file has one key per line, an id and a base64 encoded AES key of 16, 24 or 32 bytes
+separated by a space. Blank lines and lines starting with # are ignored. The last key is the
+newest one and is used to encrypt, older keys are only used to decrypt.
+*/
+
+const envelopeVersion = 1
+
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+type Keyring struct {
+	path string
+
+	mu     sync.RWMutex
+	keys   map[string]cipher.AEAD
+	newest string
+}
+
+func LoadKeyring(path string) (*Keyring, error) {
+	k, err := loadKeyring(path)
+	if err != nil {
+		return nil, err
+	}
+	k.path = path
+	return k, nil
+}
+
+// Reload reads the keyring file again. Keys still used by stored values must be kept in the file
+// until Reencrypt has migrated the values to the newest key.
+func (k *Keyring) Reload() error {
+	if k.path == "" {
+		return fmt.Errorf("keyring was not loaded from a file")
+	}
+
+	loaded, err := loadKeyring(k.path)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys, k.newest = loaded.keys, loaded.newest
+	return nil
+}
+
+func loadKeyring(path string) (*Keyring, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	k := &Keyring{keys: make(map[string]cipher.AEAD)}
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(text, " ")
+		if !ok {
+			return nil, fmt.Errorf("keyring %s line %d: expected an id and a key", path, line)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("keyring %s line %d: %w", path, line, err)
+		}
+		if err := k.add(id, key); err != nil {
+			return nil, fmt.Errorf("keyring %s line %d: %w", path, line, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	if k.newest == "" {
+		return nil, fmt.Errorf("keyring %s has no keys", path)
+	}
+	return k, nil
+}
+
+// NewKeyring creates a keyring from keys ordered from oldest to newest.
+func NewKeyring(ids []string, keys [][]byte) (*Keyring, error) {
+	if len(ids) == 0 || len(ids) != len(keys) {
+		return nil, fmt.Errorf("keyring needs one id per key")
+	}
+
+	k := &Keyring{keys: make(map[string]cipher.AEAD)}
+	for i := range ids {
+		if err := k.add(ids[i], keys[i]); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+func (k *Keyring) add(id string, key []byte) error {
+	if id == "" || len(id) > 255 {
+		return fmt.Errorf("key id must be 1 to 255 bytes")
+	}
+	if _, ok := k.keys[id]; ok {
+		return fmt.Errorf("duplicate key id %q", id)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return fmt.Errorf("key %q: %w", id, err)
+	}
+	k.keys[id] = aead
+	k.newest = id
+	return nil
+}
+
+// Newest returns the id of the key used to encrypt.
+func (k *Keyring) Newest() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.newest
+}
+
+func (k *Keyring) key(id string) (cipher.AEAD, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	aead, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	return aead, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts value for bucket/key and returns the envelope and the id of the key that wraps it.
+func (k *Keyring) seal(bucket, key string, value []byte) ([]byte, string, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	newest := k.Newest()
+	b, err := k.wrap(newest, dataKey, aead.NonceSize()+len(value)+aead.Overhead())
+	if err != nil {
+		return nil, "", err
+	}
+	b, err = appendSealed(b, aead, value, envelopeAAD(bucket, key))
+	return b, newest, err
+}
+
+// wrap starts an envelope with the data key wrapped by the key id, reserving extra bytes.
+func (k *Keyring) wrap(id string, dataKey []byte, extra int) ([]byte, error) {
+	kek, err := k.key(id)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 0, 2+len(id)+kek.NonceSize()+len(dataKey)+kek.Overhead()+extra)
+	b = append(b, envelopeVersion, byte(len(id)))
+	b = append(b, id...)
+	return appendSealed(b, kek, dataKey, []byte(id))
+}
+
+func appendSealed(b []byte, aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	b = append(b, nonce...)
+	return aead.Seal(b, nonce, plaintext, aad), nil
+}
+
+// unwrap parses an envelope and returns the id of the wrapping key, the data key and the
+// encrypted value.
+func (k *Keyring) unwrap(envelope []byte) (string, []byte, []byte, error) {
+	if len(envelope) < 2 || envelope[0] != envelopeVersion {
+		return "", nil, nil, fmt.Errorf("unsupported envelope")
+	}
+	idLen := int(envelope[1])
+	if len(envelope) < 2+idLen {
+		return "", nil, nil, fmt.Errorf("malformed envelope")
+	}
+	id := string(envelope[2 : 2+idLen])
+	kek, err := k.key(id)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	rest := envelope[2+idLen:]
+	wrappedLen := kek.NonceSize() + 32 + kek.Overhead()
+	if len(rest) < wrappedLen {
+		return "", nil, nil, fmt.Errorf("malformed envelope")
+	}
+	dataKey, err := openSealed(kek, rest[:wrappedLen], []byte(id))
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return id, dataKey, rest[wrappedLen:], nil
+}
+
+func openSealed(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("malformed envelope")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], aad)
+}
+
+// open decrypts an envelope sealed for bucket/key.
+func (k *Keyring) open(bucket, key string, envelope []byte) ([]byte, error) {
+	_, dataKey, sealed, err := k.unwrap(envelope)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := openSealed(aead, sealed, envelopeAAD(bucket, key))
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	return value, nil
+}
+
+// rewrap wraps the data key of an envelope with the key id, the encrypted value is unchanged.
+func (k *Keyring) rewrap(envelope []byte, id string) ([]byte, error) {
+	_, dataKey, sealed, err := k.unwrap(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := k.wrap(id, dataKey, len(sealed))
+	if err != nil {
+		return nil, err
+	}
+	return append(b, sealed...), nil
+}
+
+func envelopeAAD(bucket, key string) []byte {
+	return []byte(bucket + "\x00" + key)
+}
+
+// Encryption selects the buckets whose values are encrypted with a keyring.
+type Encryption struct {
+	Keyring *Keyring
+	// Buckets are the encrypted buckets, empty for every bucket
+	Buckets []string
+}
+
+// keyring returns the keyring encrypting bucket, or nil.
+func (e *Encryption) keyring(bucket string) *Keyring {
+	if e == nil || e.Keyring == nil {
+		return nil
+	}
+	if len(e.Buckets) == 0 {
+		return e.Keyring
+	}
+	for _, b := range e.Buckets {
+		if b == bucket {
+			return e.Keyring
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestKeyring(t *testing.T, path string, ids ...string) {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("# test keyring\n\n")
+	for _, id := range ids {
+		key := bytes.Repeat([]byte(id[:1]), 32)
+		fmt.Fprintf(&b, "%s %s\n", id, base64.StdEncoding.EncodeToString(key))
+	}
+	require.NoError(t, os.WriteFile(path, []byte(b.String()), 0o600))
+}
+
+func storedValues(b *buckets, bucket string) [][]byte {
+	c := b.buckets[bucket].(*cacheImplementation)
+	var values [][]byte
+	for e := c.ruList.Front(); e != nil; e = e.Next() {
+		values = append(values, e.Value.(*record).value)
+	}
+	return values
+}
+
+func TestLoadKeyring(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keyring")
+	writeTestKeyring(t, path, "a1", "b2")
+
+	k, err := LoadKeyring(path)
+	require.NoError(t, err)
+	require.Equal(t, "b2", k.Newest())
+
+	for name, content := range map[string]string{
+		"empty":     "# no keys\n",
+		"duplicate": "a MDEyMzQ1Njc4OTAxMjM0NQ==\na MDEyMzQ1Njc4OTAxMjM0NQ==\n",
+		"short key": "a MDEyMw==\n",
+		"no key":    "a\n",
+	} {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "-"))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		_, err := LoadKeyring(path)
+		require.Error(t, err, name)
+	}
+}
+
+func TestEncryption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring")
+	writeTestKeyring(t, path, "a1")
+	k, err := LoadKeyring(path)
+	require.NoError(t, err)
+
+	b := NewCache()
+	b.UseCompression("", Compression{Codec: Gzip})
+	b.UseEncryption(&Encryption{Keyring: k, Buckets: []string{"secret"}})
+
+	secret := bytes.Repeat([]byte("session-data "), 100)
+	require.NoError(t, b.Set(context.Background(), "secret", "key", secret, WithFlags(2)))
+	require.NoError(t, b.Set(context.Background(), "secret", "empty", []byte{}))
+	require.NoError(t, b.Set(context.Background(), "public", "key", []byte("public-data")))
+
+	for _, v := range storedValues(b, "secret") {
+		require.NotContains(t, string(v), "session-data")
+	}
+	require.Equal(t, [][]byte{[]byte("public-data")}, storedValues(b, "public"))
+
+	v, err := b.Get(context.Background(), "secret", "key")
+	require.NoError(t, err)
+	require.Equal(t, secret, v)
+
+	v, err = b.Get(context.Background(), "secret", "empty")
+	require.NoError(t, err)
+	require.Equal(t, []byte{}, v)
+
+	e, err := b.Lookup(context.Background(), "secret", "key")
+	require.NoError(t, err)
+	require.Equal(t, secret, e.Value)
+	require.Equal(t, uint32(2), e.Flags)
+
+	// an envelope is bound to its key
+	c := b.buckets["secret"].(*cacheImplementation)
+	r := c.ruIndex["key"].Value.(*list.Element).Value.(*record)
+	_, err = k.open("secret", "other", r.value)
+	require.Error(t, err)
+}
+
+func TestReencrypt(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keyring")
+	writeTestKeyring(t, path, "a1")
+	k, err := LoadKeyring(path)
+	require.NoError(t, err)
+
+	d, err := OpenDiskTier(DiskTierConfig{Dir: filepath.Join(dir, "disk"), MaxBytes: 1 << 20})
+	require.NoError(t, err)
+	defer d.Close()
+
+	b := NewCacheWithCapacity(2)
+	b.UseDiskTier(d)
+	b.UseEncryption(&Encryption{Keyring: k})
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, b.Set(context.Background(), "bucket", fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i))))
+	}
+	e, err := b.Lookup(context.Background(), "bucket", "key0")
+	require.NoError(t, err)
+
+	n, err := b.Reencrypt()
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	writeTestKeyring(t, path, "a1", "b2")
+	require.NoError(t, k.Reload())
+
+	n, err = b.Reencrypt()
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+
+	// the old key is no longer needed
+	writeTestKeyring(t, path, "b2")
+	require.NoError(t, k.Reload())
+
+	for i := 0; i < 4; i++ {
+		v, err := b.Get(context.Background(), "bucket", fmt.Sprintf("key%d", i))
+		require.NoError(t, err)
+		require.Equal(t, []byte(fmt.Sprintf("value%d", i)), v)
+	}
+
+	cas := e.CAS
+	e, err = b.Lookup(context.Background(), "bucket", "key0")
+	require.NoError(t, err)
+	require.Equal(t, cas, e.CAS)
+}
+
+func TestAppendOnlyLogEncryption(t *testing.T) {
+	dir := t.TempDir()
+	keyringPath := filepath.Join(dir, "keyring")
+	writeTestKeyring(t, keyringPath, "a1")
+	k, err := LoadKeyring(keyringPath)
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "cache.aof")
+	open := func(e *Encryption) (*AppendOnlyLog, *buckets, error) {
+		aof, err := OpenAppendOnlyLog(newTestLogger(), AppendOnlyLogConfig{Path: path, Fsync: FsyncAlways, Encryption: e})
+		require.NoError(t, err)
+		b := NewCache()
+		if err := aof.Replay(context.Background(), b); err != nil {
+			aof.Close()
+			return nil, nil, err
+		}
+		aof.Attach(b)
+		return aof, b, nil
+	}
+
+	e := &Encryption{Keyring: k, Buckets: []string{"secret"}}
+	aof, b, err := open(e)
+	require.NoError(t, err)
+	require.NoError(t, b.Set(context.Background(), "secret", "key", []byte("session-data")))
+	require.NoError(t, b.Set(context.Background(), "public", "key", []byte("public-data")))
+	require.NoError(t, aof.Rewrite())
+	require.NoError(t, b.Set(context.Background(), "secret", "key2", []byte("more-session-data")))
+	require.NoError(t, aof.Close())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NotContains(t, string(content), "session-data")
+	require.Contains(t, string(content), "public-data")
+
+	_, _, err = open(nil)
+	require.ErrorIs(t, err, ErrCorruptLog)
+
+	aof, b, err = open(e)
+	require.NoError(t, err)
+	defer aof.Close()
+
+	v, err := b.Get(context.Background(), "secret", "key2")
+	require.NoError(t, err)
+	require.Equal(t, []byte("more-session-data"), v)
+}
@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// ErrorDomain is the domain of the google.rpc.ErrorInfo detail of the errors of the cache services.
+const ErrorDomain = "cache-api"
+
+// Reasons of the google.rpc.ErrorInfo detail of the errors of the cache services, stable codes
+// callers can branch on.
+const (
+	ReasonReadOnly      = "READ_ONLY"
+	ReasonKeyNotFound   = "KEY_NOT_FOUND"
+	ReasonQuotaExceeded = "QUOTA_EXCEEDED"
+	ReasonValueTooLarge = "VALUE_TOO_LARGE"
+)
+
+// withReason returns the error of st with details followed by an ErrorInfo detail holding reason.
+func withReason(st *status.Status, reason string, details ...protoadapt.MessageV1) error {
+	details = append(details, &errdetails.ErrorInfo{Reason: reason, Domain: ErrorDomain})
+	detailed, err := st.WithDetails(details...)
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// readOnlyError returns the error of a write rejected by a read-only store.
+func readOnlyError(err error) error {
+	return withReason(status.New(codes.FailedPrecondition, err.Error()), ReasonReadOnly)
+}
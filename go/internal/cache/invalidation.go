@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"sync"
+
+	cacheapiv1 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v1"
+)
+
+const invalidationBufferSize = 1024
+
+// invalidationHub fans the operations of a store out to the clients watching for invalidations.
+type invalidationHub struct {
+	mu       sync.Mutex
+	watchers map[*invalidationWatcher]struct{}
+}
+
+type invalidationWatcher struct {
+	buckets map[string]bool
+	ch      chan *cacheapiv1.Invalidation
+	// overflowed is closed when the watcher falls too far behind and stops receiving invalidations
+	overflowed chan struct{}
+}
+
+func newInvalidationHub(store Store) *invalidationHub {
+	h := &invalidationHub{watchers: make(map[*invalidationWatcher]struct{})}
+	store.Subscribe(h.publish)
+	return h
+}
+
+func (h *invalidationHub) watch(buckets []string) *invalidationWatcher {
+	w := &invalidationWatcher{
+		ch:         make(chan *cacheapiv1.Invalidation, invalidationBufferSize),
+		overflowed: make(chan struct{}),
+	}
+	if len(buckets) > 0 {
+		w.buckets = make(map[string]bool, len(buckets))
+		for _, b := range buckets {
+			w.buckets[b] = true
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.watchers[w] = struct{}{}
+	return w
+}
+
+func (h *invalidationHub) unwatch(w *invalidationWatcher) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.watchers, w)
+}
+
+// publish is called with the bucket lock held, so it never blocks on a watcher.
+func (h *invalidationHub) publish(op Operation) {
+	inv := &cacheapiv1.Invalidation{Bucket: op.Bucket, Key: op.Key}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for w := range h.watchers {
+		if w.buckets != nil && op.Bucket != "" && !w.buckets[op.Bucket] {
+			continue
+		}
+
+		select {
+		case w.ch <- inv:
+		default:
+			delete(h.watchers, w)
+			close(w.overflowed)
+		}
+	}
+}
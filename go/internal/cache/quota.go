@@ -0,0 +1,332 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// QuotaLimits bounds the resources of a principal, a zero limit is not enforced.
+type QuotaLimits struct {
+	MaxBuckets        int
+	MaxKeys           int
+	MaxBytes          uint64
+	RequestsPerSecond float64
+}
+
+// QuotaUsage is the usage of the buckets owned by a principal and its limits.
+type QuotaUsage struct {
+	Principal string
+	Buckets   int
+	Keys      int
+	Bytes     uint64
+	Limits    QuotaLimits
+}
+
+/*
+Quotas bound the buckets, keys, value bytes and request rate of every principal, keyed by the user
+id of the authenticated caller. Callers that are not authenticated share the quota of the empty
+principal.
+
+A bucket is owned by the principal that first writes to it, and its keys and bytes count against
+the quota of its owner whoever writes them. A bucket that becomes empty is released. Ownership is
+not persisted, buckets replayed on startup are claimed by the next principal that writes to them.
+
+Usage is read from the store when a key is set. The keys and bytes of a set are reserved from
+its check until the write completes, so that concurrent sets cannot overshoot a limit together and a
+bucket claimed by a set is not released before the set lands.
+*/
+type Quotas struct {
+	path  string
+	store Store
+
+	mu       sync.Mutex
+	limits   map[string]QuotaLimits
+	owners   map[string]string
+	reserved map[string]*reservation
+	limiters map[string]*rate.Limiter
+}
+
+// reservation is the usage of the sets of a bucket that were checked but not written yet.
+type reservation struct {
+	sets  int
+	keys  int
+	bytes uint64
+}
+
+// LoadQuotas reads a file with one principal per line followed by its limits, such as
+// `checkout buckets=10 keys=100000 bytes=1073741824 rps=500`. The limits of the principal *
+// apply to every principal without a line of its own. Blank lines and lines starting with # are ignored.
+func LoadQuotas(path string, store Store) (*Quotas, error) {
+	q := &Quotas{path: path, store: store, owners: map[string]string{}, reserved: map[string]*reservation{}}
+	if err := q.Reload(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Reload reads the quota file again, the limits in use are kept when it is invalid. Request rates
+// start over with a full burst.
+func (q *Quotas) Reload() error {
+	f, err := os.Open(q.path)
+	if err != nil {
+		return fmt.Errorf("quotas: %w", err)
+	}
+	defer f.Close()
+
+	limits := map[string]QuotaLimits{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		l, err := parseQuotaLimits(fields[1:])
+		if err != nil {
+			return fmt.Errorf("quotas: %s:%d: %w", q.path, n, err)
+		}
+		limits[fields[0]] = l
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("quotas: %w", err)
+	}
+
+	q.mu.Lock()
+	q.limits = limits
+	q.limiters = map[string]*rate.Limiter{}
+	q.mu.Unlock()
+	return nil
+}
+
+func parseQuotaLimits(fields []string) (QuotaLimits, error) {
+	var l QuotaLimits
+	for _, f := range fields {
+		name, value, ok := strings.Cut(f, "=")
+		if !ok {
+			return l, fmt.Errorf("expected name=value, got %q", f)
+		}
+
+		var err error
+		switch name {
+		case "buckets":
+			l.MaxBuckets, err = strconv.Atoi(value)
+		case "keys":
+			l.MaxKeys, err = strconv.Atoi(value)
+		case "bytes":
+			l.MaxBytes, err = strconv.ParseUint(value, 10, 64)
+		case "rps":
+			l.RequestsPerSecond, err = strconv.ParseFloat(value, 64)
+		default:
+			return l, fmt.Errorf("unknown limit %q", name)
+		}
+		if err != nil {
+			return l, fmt.Errorf("invalid %s limit %q", name, value)
+		}
+	}
+	if l.MaxBuckets < 0 || l.MaxKeys < 0 || l.RequestsPerSecond < 0 {
+		return l, fmt.Errorf("limits must not be negative")
+	}
+	return l, nil
+}
+
+// limitsOf returns the limits of principal, it must be called with the lock held.
+func (q *Quotas) limitsOf(principal string) QuotaLimits {
+	if l, ok := q.limits[principal]; ok {
+		return l
+	}
+	return q.limits["*"]
+}
+
+// Allow takes a request of principal from its request rate.
+func (q *Quotas) Allow(principal string) error {
+	q.mu.Lock()
+	l := q.limitsOf(principal)
+	limiter, ok := q.limiters[principal]
+	if !ok && l.RequestsPerSecond > 0 {
+		limiter = rate.NewLimiter(rate.Limit(l.RequestsPerSecond), int(math.Max(1, math.Ceil(l.RequestsPerSecond))))
+		q.limiters[principal] = limiter
+	}
+	q.mu.Unlock()
+
+	if limiter == nil || limiter.Allow() {
+		return nil
+	}
+	return quotaFailure(principal, fmt.Sprintf("request rate of %g per second exceeded", l.RequestsPerSecond))
+}
+
+// CheckSet checks that principal may set a value of size bytes to key, and claims the bucket for
+// principal when it has no owner. The usage of the set is reserved until release is called, which
+// must be once the write completed or failed.
+func (q *Quotas) CheckSet(ctx context.Context, principal, bucket, key string, size int) (release func(), err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	owner, owned := q.owners[bucket]
+	if owned && q.empty(bucket) {
+		delete(q.owners, bucket)
+		owned = false
+	}
+	if !owned {
+		owner = principal
+	}
+
+	u := q.usage(owner)
+	l := u.Limits
+	var violations []string
+	if !owned && l.MaxBuckets > 0 && u.Buckets >= l.MaxBuckets {
+		violations = append(violations, fmt.Sprintf("bucket quota of %d exceeded", l.MaxBuckets))
+	}
+
+	// the keys and bytes added by the set
+	setKeys, setBytes := 1, uint64(size)
+	if l.MaxKeys > 0 || l.MaxBytes > 0 {
+		if !owned {
+			b := q.bucketUsage(bucket)
+			u.Keys += b.Keys
+			u.Bytes += b.Bytes
+		}
+
+		exceeded := func() bool {
+			return (l.MaxKeys > 0 && u.Keys+setKeys > l.MaxKeys) || (l.MaxBytes > 0 && u.Bytes+setBytes > l.MaxBytes)
+		}
+		// a key that is overwritten frees its current value
+		if exceeded() {
+			if e, err := q.store.Lookup(ctx, bucket, key); err == nil && e != nil {
+				setKeys = 0
+				setBytes -= min(setBytes, uint64(len(e.Value)))
+			}
+		}
+
+		if l.MaxKeys > 0 && u.Keys+setKeys > l.MaxKeys {
+			violations = append(violations, fmt.Sprintf("key quota of %d exceeded", l.MaxKeys))
+		}
+		if l.MaxBytes > 0 && u.Bytes+setBytes > l.MaxBytes {
+			violations = append(violations, fmt.Sprintf("byte quota of %d exceeded", l.MaxBytes))
+		}
+	}
+
+	if len(violations) > 0 {
+		return nil, quotaFailure(owner, violations...)
+	}
+	if !owned {
+		q.owners[bucket] = owner
+	}
+	return q.reserve(bucket, setKeys, setBytes), nil
+}
+
+// reserve adds the usage of a set to bucket until the returned func is called, it must be called
+// with the lock held.
+func (q *Quotas) reserve(bucket string, keys int, bytes uint64) func() {
+	r, ok := q.reserved[bucket]
+	if !ok {
+		r = &reservation{}
+		q.reserved[bucket] = r
+	}
+	r.sets++
+	r.keys += keys
+	r.bytes += bytes
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+
+			r.sets--
+			r.keys -= keys
+			r.bytes -= bytes
+			if r.sets == 0 {
+				delete(q.reserved, bucket)
+			}
+		})
+	}
+}
+
+// bucketUsage is the usage of bucket including its reserved sets, it must be called with the lock held.
+func (q *Quotas) bucketUsage(bucket string) Usage {
+	b := q.store.Usage(bucket)
+	if r, ok := q.reserved[bucket]; ok {
+		b.Keys += r.keys
+		b.Bytes += r.bytes
+	}
+	return b
+}
+
+// empty reports whether bucket has no keys and no sets in flight, it must be called with the lock held.
+func (q *Quotas) empty(bucket string) bool {
+	_, reserved := q.reserved[bucket]
+	return !reserved && q.store.Usage(bucket).Keys == 0
+}
+
+// Usage returns the usage of principal.
+func (q *Quotas) Usage(principal string) QuotaUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.usage(principal)
+}
+
+// Usages returns the usage of every principal with limits of its own or owning a bucket, sorted by principal.
+func (q *Quotas) Usages() []QuotaUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var principals []string
+	for p := range q.limits {
+		if p != "*" {
+			principals = append(principals, p)
+		}
+	}
+	for _, p := range q.owners {
+		principals = append(principals, p)
+	}
+	slices.Sort(principals)
+
+	var usages []QuotaUsage
+	for _, p := range slices.Compact(principals) {
+		usages = append(usages, q.usage(p))
+	}
+	return usages
+}
+
+// usage sums the usage of the buckets owned by principal, including their reserved sets, and releases
+// the empty ones, it must be called with the lock held.
+func (q *Quotas) usage(principal string) QuotaUsage {
+	u := QuotaUsage{Principal: principal, Limits: q.limitsOf(principal)}
+	for bucket, owner := range q.owners {
+		if owner != principal {
+			continue
+		}
+		if q.empty(bucket) {
+			delete(q.owners, bucket)
+			continue
+		}
+		b := q.bucketUsage(bucket)
+		u.Buckets++
+		u.Keys += b.Keys
+		u.Bytes += b.Bytes
+	}
+	return u
+}
+
+func quotaFailure(principal string, descriptions ...string) error {
+	var violations []*errdetails.QuotaFailure_Violation
+	for _, d := range descriptions {
+		violations = append(violations, &errdetails.QuotaFailure_Violation{Subject: "user:" + principal, Description: d})
+	}
+
+	st := status.Newf(codes.ResourceExhausted, "quota exceeded: %s", descriptions[0])
+	return withReason(st, ReasonQuotaExceeded, &errdetails.QuotaFailure{Violations: violations})
+}
@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func loadTestQuotas(t *testing.T, store Store, content string) *Quotas {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "quotas")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	q, err := LoadQuotas(path, store)
+	require.NoError(t, err)
+	return q
+}
+
+// set checks the quota of a set and then applies it, as the cache service does.
+func set(t *testing.T, q *Quotas, b Store, principal, bucket, key, value string) error {
+	t.Helper()
+	release, err := q.CheckSet(context.Background(), principal, bucket, key, len(value))
+	if err != nil {
+		return err
+	}
+	defer release()
+	require.NoError(t, b.Set(context.Background(), bucket, key, []byte(value)))
+	return nil
+}
+
+func requireQuotaFailure(t *testing.T, err error, subject, description string) {
+	t.Helper()
+	st := status.Convert(err)
+	require.Equal(t, codes.ResourceExhausted, st.Code())
+	require.Len(t, st.Details(), 2)
+	require.Equal(t, ReasonQuotaExceeded, st.Details()[1].(*errdetails.ErrorInfo).GetReason())
+	violations := st.Details()[0].(*errdetails.QuotaFailure).GetViolations()
+	require.Len(t, violations, 1)
+	require.Equal(t, subject, violations[0].Subject)
+	require.Equal(t, description, violations[0].Description)
+}
+
+func TestQuotas(t *testing.T) {
+	b := NewCache()
+	q := loadTestQuotas(t, b, `# principal limits
+checkout buckets=2 keys=3 bytes=10
+* buckets=1
+`)
+
+	require.NoError(t, set(t, q, b, "checkout", "cart", "k1", "12345"))
+	require.NoError(t, set(t, q, b, "checkout", "orders", "k1", "1"))
+	requireQuotaFailure(t, set(t, q, b, "checkout", "sessions", "k1", "1"), "user:checkout", "bucket quota of 2 exceeded")
+
+	// writes to a bucket count against its owner
+	require.NoError(t, set(t, q, b, "search", "cart", "k2", "1234"))
+	requireQuotaFailure(t, set(t, q, b, "search", "cart", "k3", ""), "user:checkout", "key quota of 3 exceeded")
+
+	// overwriting a key frees its value
+	requireQuotaFailure(t, set(t, q, b, "checkout", "cart", "k2", "123456"), "user:checkout", "byte quota of 10 exceeded")
+	require.NoError(t, set(t, q, b, "checkout", "cart", "k2", "1234"))
+
+	require.Equal(t, QuotaUsage{
+		Principal: "checkout",
+		Buckets:   2,
+		Keys:      3,
+		Bytes:     10,
+		Limits:    QuotaLimits{MaxBuckets: 2, MaxKeys: 3, MaxBytes: 10},
+	}, q.Usage("checkout"))
+
+	// principals without limits of their own get the limits of *
+	require.NoError(t, set(t, q, b, "search", "catalog", "k1", "1"))
+	requireQuotaFailure(t, set(t, q, b, "search", "index", "k1", "1"), "user:search", "bucket quota of 1 exceeded")
+
+	// an emptied bucket is released
+	require.NoError(t, b.Delete(context.Background(), "orders", "k1"))
+	require.NoError(t, set(t, q, b, "checkout", "sessions", "k1", "1"))
+
+	var principals []string
+	for _, u := range q.Usages() {
+		principals = append(principals, u.Principal)
+	}
+	require.Equal(t, []string{"checkout", "search"}, principals)
+}
+
+func TestQuotasReserveSets(t *testing.T) {
+	ctx := context.Background()
+	b := NewCache()
+	q := loadTestQuotas(t, b, "checkout buckets=1 keys=2 bytes=10\n")
+
+	// the bucket stays claimed while its first set is in flight
+	release1, err := q.CheckSet(ctx, "checkout", "cart", "k1", 5)
+	require.NoError(t, err)
+	_, err = q.CheckSet(ctx, "checkout", "orders", "k1", 0)
+	requireQuotaFailure(t, err, "user:checkout", "bucket quota of 1 exceeded")
+
+	// sets that were checked but not written count against the quota
+	release2, err := q.CheckSet(ctx, "checkout", "cart", "k2", 5)
+	require.NoError(t, err)
+	_, err = q.CheckSet(ctx, "checkout", "cart", "k3", 0)
+	requireQuotaFailure(t, err, "user:checkout", "key quota of 2 exceeded")
+	_, err = q.CheckSet(ctx, "search", "cart", "k3", 0)
+	requireQuotaFailure(t, err, "user:checkout", "key quota of 2 exceeded")
+
+	require.NoError(t, b.Set(ctx, "cart", "k1", []byte("12345")))
+	release1()
+	release2()
+	require.Equal(t, 1, q.Usage("checkout").Keys)
+
+	// an empty bucket is released once no set is in flight
+	require.NoError(t, b.Delete(ctx, "cart", "k1"))
+	release, err := q.CheckSet(ctx, "checkout", "orders", "k1", 0)
+	require.NoError(t, err)
+	release()
+}
+
+func TestQuotasConcurrentSets(t *testing.T) {
+	b := NewCache()
+	q := loadTestQuotas(t, b, "checkout buckets=1 keys=10\n")
+
+	var wg sync.WaitGroup
+	for i := range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = set(t, q, b, "checkout", fmt.Sprintf("bucket%d", i%3), fmt.Sprintf("k%d", i), "v")
+		}()
+	}
+	wg.Wait()
+
+	// a single bucket was claimed and it holds no more keys than the quota
+	var buckets, keys int
+	for i := range 3 {
+		if n := b.Usage(fmt.Sprintf("bucket%d", i)).Keys; n > 0 {
+			buckets++
+			keys += n
+		}
+	}
+	require.Equal(t, 1, buckets)
+	require.Equal(t, 10, keys)
+}
+
+func TestQuotasRequestRate(t *testing.T) {
+	q := loadTestQuotas(t, NewCache(), "checkout rps=2\n")
+
+	require.NoError(t, q.Allow("checkout"))
+	require.NoError(t, q.Allow("checkout"))
+	requireQuotaFailure(t, q.Allow("checkout"), "user:checkout", "request rate of 2 per second exceeded")
+
+	// principals without a rate are not limited
+	for range 10 {
+		require.NoError(t, q.Allow("search"))
+	}
+
+	require.NoError(t, os.WriteFile(q.path, []byte("checkout rps=-1\n"), 0o600))
+	require.ErrorContains(t, q.Reload(), "limits must not be negative")
+
+	require.NoError(t, os.WriteFile(q.path, []byte("checkout rps=100\n"), 0o600))
+	require.NoError(t, q.Reload())
+	require.NoError(t, q.Allow("checkout"))
+}
@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrReadOnly = errors.New("cache is read-only")
+
+// ReadOnly wraps a store so that it only changes through Apply, as a replica does.
+// Gets do not evict so that the replica stays identical to its primary.
+func ReadOnly(s Store) Store {
+	return &readOnly{s}
+}
+
+type readOnly struct {
+	Store
+}
+
+func (r *readOnly) Set(ctx context.Context, bucket, key string, value []byte, opts ...Option) error {
+	return ErrReadOnly
+}
+
+func (r *readOnly) Get(ctx context.Context, bucket, key string, opts ...Option) ([]byte, error) {
+	return r.Store.Get(ctx, bucket, key, append(opts, withoutEvictOnGet())...)
+}
+
+func (r *readOnly) GetEntry(ctx context.Context, bucket, key string, opts ...Option) (*Entry, error) {
+	return r.Store.GetEntry(ctx, bucket, key, append(opts, withoutEvictOnGet())...)
+}
+
+func (r *readOnly) Delete(ctx context.Context, bucket, key string, opts ...Option) error {
+	return ErrReadOnly
+}
+
+func (r *readOnly) DeleteIf(ctx context.Context, bucket, key string, cond DeleteFunc, opts ...Option) (bool, error) {
+	return false, ErrReadOnly
+}
+
+func (r *readOnly) Update(ctx context.Context, bucket, key string, fn UpdateFunc, opts ...Option) error {
+	return ErrReadOnly
+}
+
+func (r *readOnly) Flush(ctx context.Context, bucket string) error {
+	return ErrReadOnly
+}
@@ -2,31 +2,191 @@ package cache
 
 import (
 	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/ahmedalhulaibi/cache-api/internal/auth"
 	cacheapiv1 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v1"
+	cacheapiv2 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v2"
 	"github.com/ahmedalhulaibi/loggy"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 type cacheService struct {
-	logger  *loggy.Logger
-	buckets *buckets
+	logger           *loggy.Logger
+	buckets          Store
+	replicationStats func() *cacheapiv1.ReplicationStats
+	router           Router
+	invalidations    *invalidationHub
+	limits           Limits
+	quotas           *Quotas
 	cacheapiv1.UnimplementedCacheServiceServer
 }
 
+// Router locates the instance that owns a key when the cache is sharded across a cluster.
+type Router interface {
+	// Route returns a connection to the owner of bucket/key, or nil when this instance owns it.
+	Route(bucket, key string) (grpc.ClientConnInterface, error)
+	// Peers returns a connection to every other instance.
+	Peers() ([]grpc.ClientConnInterface, error)
+}
+
+// ForwardedMetadataKey marks a request forwarded by another instance, it is always served locally
+// so that members with a different view of the ring cannot forward a request back and forth.
+const ForwardedMetadataKey = "x-cache-forwarded"
+
+type ServiceOption func(*cacheService)
+
+// WithRouter forwards requests for keys owned by other instances, and merges the buckets, keys and
+// stats of every instance.
+func WithRouter(router Router) ServiceOption {
+	return func(c *cacheService) {
+		c.router = router
+	}
+}
+
+// WithReplicationStats reports the replication state of this instance in GetStats.
+func WithReplicationStats(fn func() *cacheapiv1.ReplicationStats) ServiceOption {
+	return func(c *cacheService) {
+		c.replicationStats = fn
+	}
+}
+
+// WithQuotas rejects sets that exceed the quota of the caller with ResourceExhausted.
+func WithQuotas(quotas *Quotas) ServiceOption {
+	return func(c *cacheService) {
+		c.quotas = quotas
+	}
+}
+
 func NewCacheService(
 	logger *loggy.Logger,
+	store Store,
+	opts ...ServiceOption,
 ) *cacheService {
-	return &cacheService{
+	c := newService(logger, store, opts...)
+	c.invalidations = newInvalidationHub(store)
+	return c
+}
+
+func newService(logger *loggy.Logger, store Store, opts ...ServiceOption) *cacheService {
+	c := &cacheService{
 		logger:  logger,
-		buckets: NewCache(),
+		buckets: store,
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
 }
 
 var _ cacheapiv1.CacheServiceServer = (*cacheService)(nil)
 
+// MethodPermissions are the permissions required by the RPCs of the cache services on the buckets
+// of their request.
+var MethodPermissions = auth.MethodPermissions{
+	cacheapiv1.CacheService_Set_FullMethodName:                auth.PermissionWrite,
+	cacheapiv1.CacheService_Get_FullMethodName:                auth.PermissionRead,
+	cacheapiv1.CacheService_Delete_FullMethodName:             auth.PermissionWrite,
+	cacheapiv1.CacheService_ListKeys_FullMethodName:           auth.PermissionRead,
+	cacheapiv1.CacheService_WatchInvalidations_FullMethodName: auth.PermissionRead,
+	cacheapiv1.CacheService_ListBuckets_FullMethodName:        auth.PermissionAdmin,
+	cacheapiv1.CacheService_GetStats_FullMethodName:           auth.PermissionAdmin,
+	cacheapiv1.CacheService_GetQuotaUsage_FullMethodName:      auth.PermissionAdmin,
+	cacheapiv2.CacheService_Set_FullMethodName:                auth.PermissionWrite,
+	cacheapiv2.CacheService_Get_FullMethodName:                auth.PermissionRead,
+	cacheapiv2.CacheService_GetValue_FullMethodName:           auth.PermissionRead,
+	cacheapiv2.CacheService_Delete_FullMethodName:             auth.PermissionWrite,
+}
+
+// route returns a connection and outgoing context when the request must be forwarded to another instance.
+func (c *cacheService) route(ctx context.Context, bucket, key string) (grpc.ClientConnInterface, context.Context, error) {
+	if c.router == nil {
+		return nil, nil, nil
+	}
+
+	if forwarded(ctx) {
+		return nil, nil, nil
+	}
+
+	conn, err := c.router.Route(bucket, key)
+	if err != nil || conn == nil {
+		return nil, nil, err
+	}
+	return conn, forwardContext(ctx), nil
+}
+
+// fanOut calls fn concurrently with a client of every other instance, so that requests that are not
+// for a key see the whole cluster. It returns the first error of a call.
+func (c *cacheService) fanOut(ctx context.Context, fn func(ctx context.Context, client cacheapiv1.CacheServiceClient) error) error {
+	if c.router == nil || forwarded(ctx) {
+		return nil
+	}
+
+	conns, err := c.router.Peers()
+	if err != nil {
+		return err
+	}
+
+	errg, ctx := errgroup.WithContext(forwardContext(ctx))
+	for _, conn := range conns {
+		errg.Go(func() error {
+			return fn(ctx, cacheapiv1.NewCacheServiceClient(conn))
+		})
+	}
+	return errg.Wait()
+}
+
+func forwarded(ctx context.Context) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return len(md.Get(ForwardedMetadataKey)) > 0
+}
+
+// forwardContext returns the outgoing context of a request forwarded to another instance.
+func forwardContext(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	md = md.Copy()
+	md.Set(ForwardedMetadataKey, "true")
+	// only a certificate verified here is forwarded, the owner trusts it when this instance presents its certificate
+	md.Delete(auth.ClientCertHeader)
+	if id, ok := auth.FromContext(ctx); ok && id.Certificate != nil {
+		md.Set(auth.ClientCertHeader, auth.EncodeCertificate(id.Certificate))
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
 func (c *cacheService) Set(ctx context.Context, r *cacheapiv1.SetRequest) (*cacheapiv1.SetResponse, error) {
-	c.logger.Infow(ctx, "setting key", "key", r.Key, "bucket", r.Bucket, "value", r.Value)
+	var v violations
+	c.limits.checkBucket(&v, "bucket", r.Bucket)
+	c.limits.checkKey(&v, "key", r.Key)
+	c.limits.checkValue(&v, "value", len(r.Value))
+	c.limits.checkTTL(&v, "options.ttlSeconds", r.GetOptions().GetTtlSeconds())
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	conn, fctx, err := c.route(ctx, r.Bucket, r.Key)
+	if err != nil {
+		return nil, err
+	}
+	if conn != nil {
+		return cacheapiv1.NewCacheServiceClient(conn).Set(fctx, r)
+	}
+
+	c.logger.Infow(ctx, "setting key", "key", r.Key, "bucket", r.Bucket, "size", len(r.Value))
+
+	release, err := c.checkQuota(ctx, r.Bucket, r.Key, len(r.Value))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
 	ttl := time.Duration(-1)
 	evictionPolicy := EvictLRU
@@ -35,30 +195,218 @@ func (c *cacheService) Set(ctx context.Context, r *cacheapiv1.SetRequest) (*cach
 		evictionPolicy = getEvictionPolicy(r.Options.EvictionPolicy)
 	}
 
-	if err := c.buckets.Set(r.Bucket, r.Key, []byte(r.Value), WithTTL(ttl), WithEvictionPolicy(evictionPolicy)); err != nil {
+	if err := c.buckets.Set(ctx, r.Bucket, r.Key, []byte(r.Value), WithTTL(ttl), WithEvictionPolicy(evictionPolicy)); err != nil {
 		c.logger.Errorf(ctx, "failed to set key: %v", err)
+		if errors.Is(err, ErrReadOnly) {
+			return nil, readOnlyError(err)
+		}
 		return nil, err
 	}
 	return &cacheapiv1.SetResponse{}, nil
 }
 
 func (c *cacheService) Get(ctx context.Context, r *cacheapiv1.GetRequest) (*cacheapiv1.GetResponse, error) {
-	record, err := c.buckets.Get(r.Bucket, r.Key)
+	if err := c.validateKey(r.Bucket, r.Key); err != nil {
+		return nil, err
+	}
+
+	conn, fctx, err := c.route(ctx, r.Bucket, r.Key)
+	if err != nil {
+		return nil, err
+	}
+	if conn != nil {
+		return cacheapiv1.NewCacheServiceClient(conn).Get(fctx, r)
+	}
+
+	record, err := c.buckets.Get(ctx, r.Bucket, r.Key)
 	if err != nil {
 		c.logger.Errorf(ctx, "failed to get key: %v", err)
 		return nil, err
 	}
-	return &cacheapiv1.GetResponse{Value: string(record)}, nil
+	return &cacheapiv1.GetResponse{Value: string(record), Found: record != nil}, nil
+}
+
+func (c *cacheService) Delete(ctx context.Context, r *cacheapiv1.DeleteRequest) (*cacheapiv1.DeleteResponse, error) {
+	if err := c.validateKey(r.Bucket, r.Key); err != nil {
+		return nil, err
+	}
+
+	conn, fctx, err := c.route(ctx, r.Bucket, r.Key)
+	if err != nil {
+		return nil, err
+	}
+	if conn != nil {
+		return cacheapiv1.NewCacheServiceClient(conn).Delete(fctx, r)
+	}
+
+	c.logger.Infow(ctx, "deleting key", "key", r.Key, "bucket", r.Bucket)
+
+	e, err := c.buckets.Lookup(ctx, r.Bucket, r.Key)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.buckets.Delete(ctx, r.Bucket, r.Key); err != nil {
+		c.logger.Errorf(ctx, "failed to delete key: %v", err)
+		if errors.Is(err, ErrReadOnly) {
+			return nil, readOnlyError(err)
+		}
+		return nil, err
+	}
+	return &cacheapiv1.DeleteResponse{Deleted: e != nil}, nil
+}
+
+func (c *cacheService) ListBuckets(ctx context.Context, r *cacheapiv1.ListBucketsRequest) (*cacheapiv1.ListBucketsResponse, error) {
+	var mu sync.Mutex
+	buckets := c.buckets.Buckets()
+	err := c.fanOut(ctx, func(ctx context.Context, client cacheapiv1.CacheServiceClient) error {
+		resp, err := client.ListBuckets(ctx, r)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		buckets = append(buckets, resp.Buckets...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(buckets)
+	return &cacheapiv1.ListBucketsResponse{Buckets: slices.Compact(buckets)}, nil
+}
+
+func (c *cacheService) ListKeys(ctx context.Context, r *cacheapiv1.ListKeysRequest) (*cacheapiv1.ListKeysResponse, error) {
+	var mu sync.Mutex
+	var keys []string
+	for _, key := range c.buckets.Keys(r.Bucket) {
+		if strings.HasPrefix(key, r.Prefix) {
+			keys = append(keys, key)
+		}
+	}
+	err := c.fanOut(ctx, func(ctx context.Context, client cacheapiv1.CacheServiceClient) error {
+		resp, err := client.ListKeys(ctx, r)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		keys = append(keys, resp.Keys...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(keys)
+	return &cacheapiv1.ListKeysResponse{Keys: slices.Compact(keys)}, nil
+}
+
+// WatchInvalidations streams the keys changed on this instance. Headers are sent once the stream
+// is registered, so that clients know that no later change will be missed.
+func (c *cacheService) WatchInvalidations(r *cacheapiv1.WatchInvalidationsRequest, stream cacheapiv1.CacheService_WatchInvalidationsServer) error {
+	w := c.invalidations.watch(r.Buckets)
+	defer c.invalidations.unwatch(w)
+
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-w.overflowed:
+			return status.Error(codes.ResourceExhausted, "invalidation stream fell behind")
+		case inv := <-w.ch:
+			if err := stream.Send(inv); err != nil {
+				return err
+			}
+		}
+	}
 }
 
+// GetStats sums the stats of every instance, replication stats are those of this instance.
 func (c *cacheService) GetStats(ctx context.Context, r *cacheapiv1.GetStatsRequest) (*cacheapiv1.GetStatsResponse, error) {
+	var mu sync.Mutex
 	s := c.buckets.Stats()
-	return &cacheapiv1.GetStatsResponse{
-		Hits:      s.Hits,
-		Misses:    s.Misses,
-		Evictions: s.Evictions,
-		Expired:   s.Expired,
-	}, nil
+	err := c.fanOut(ctx, func(ctx context.Context, client cacheapiv1.CacheServiceClient) error {
+		resp, err := client.GetStats(ctx, r)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		s.Hits += resp.Hits
+		s.Misses += resp.Misses
+		s.Evictions += resp.Evictions
+		s.Expired += resp.Expired
+		s.DiskHits += resp.DiskHits
+		s.DiskMisses += resp.DiskMisses
+		s.Bytes += resp.Bytes
+		s.UncompressedBytes += resp.UncompressedBytes
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &cacheapiv1.GetStatsResponse{
+		Hits:              s.Hits,
+		Misses:            s.Misses,
+		Evictions:         s.Evictions,
+		Expired:           s.Expired,
+		DiskHits:          s.DiskHits,
+		DiskMisses:        s.DiskMisses,
+		Bytes:             s.Bytes,
+		UncompressedBytes: s.UncompressedBytes,
+		CompressionRatio:  s.CompressionRatio(),
+	}
+	if c.replicationStats != nil {
+		resp.Replication = c.replicationStats()
+	}
+	return resp, nil
+}
+
+// checkQuota checks a set against the quota of the caller, when quotas are enforced. release must be
+// called once the set is written.
+func (c *cacheService) checkQuota(ctx context.Context, bucket, key string, size int) (release func(), err error) {
+	if c.quotas == nil {
+		return func() {}, nil
+	}
+	release, err = c.quotas.CheckSet(ctx, auth.Principal(ctx), bucket, key, size)
+	if err != nil {
+		c.logger.Infow(ctx, "quota exceeded", "key", key, "bucket", bucket, "err", err)
+		return nil, err
+	}
+	return release, nil
+}
+
+func (c *cacheService) GetQuotaUsage(ctx context.Context, r *cacheapiv1.GetQuotaUsageRequest) (*cacheapiv1.GetQuotaUsageResponse, error) {
+	if c.quotas == nil {
+		return nil, status.Error(codes.FailedPrecondition, "quotas are not enforced")
+	}
+
+	usages := c.quotas.Usages()
+	if r.Principal != "" {
+		usages = []QuotaUsage{c.quotas.Usage(r.Principal)}
+	}
+
+	resp := &cacheapiv1.GetQuotaUsageResponse{}
+	for _, u := range usages {
+		resp.Usages = append(resp.Usages, &cacheapiv1.QuotaUsage{
+			Principal:            u.Principal,
+			Buckets:              uint32(u.Buckets),
+			Keys:                 uint64(u.Keys),
+			Bytes:                u.Bytes,
+			MaxBuckets:           uint32(u.Limits.MaxBuckets),
+			MaxKeys:              uint64(u.Limits.MaxKeys),
+			MaxBytes:             u.Limits.MaxBytes,
+			MaxRequestsPerSecond: u.Limits.RequestsPerSecond,
+		})
+	}
+	return resp, nil
 }
 
 /*
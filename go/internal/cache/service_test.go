@@ -0,0 +1,23 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	cacheapiv1 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v1"
+	cacheapiv2 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v2"
+)
+
+func TestMethodPermissions(t *testing.T) {
+	// the authz interceptor denies the methods of the cache services that have no permission
+	for _, desc := range []grpc.ServiceDesc{cacheapiv1.CacheService_ServiceDesc, cacheapiv2.CacheService_ServiceDesc} {
+		for _, m := range desc.Methods {
+			require.Contains(t, MethodPermissions, "/"+desc.ServiceName+"/"+m.MethodName)
+		}
+		for _, s := range desc.Streams {
+			require.Contains(t, MethodPermissions, "/"+desc.ServiceName+"/"+s.StreamName)
+		}
+	}
+}
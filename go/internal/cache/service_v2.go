@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	cacheapiv2 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v2"
+)
+
+const defaultContentType = "application/octet-stream"
+
+// cacheServiceV2 serves binary values with their content type and metadata over the same store,
+// router and options as the v1 service.
+type cacheServiceV2 struct {
+	*cacheService
+	cacheapiv2.UnimplementedCacheServiceServer
+}
+
+var _ cacheapiv2.CacheServiceServer = (*cacheServiceV2)(nil)
+
+func NewCacheServiceV2(
+	logger *loggy.Logger,
+	store Store,
+	opts ...ServiceOption,
+) *cacheServiceV2 {
+	return &cacheServiceV2{cacheService: newService(logger, store, opts...)}
+}
+
+func (c *cacheServiceV2) Set(ctx context.Context, r *cacheapiv2.SetRequest) (*cacheapiv2.SetResponse, error) {
+	var v violations
+	c.limits.checkBucket(&v, "bucket", r.Bucket)
+	c.limits.checkKey(&v, "key", r.Key)
+	c.limits.checkValue(&v, "record.value", len(r.GetRecord().GetValue()))
+	c.limits.checkTTL(&v, "ttl_seconds", r.TtlSeconds)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	conn, fctx, err := c.route(ctx, r.Bucket, r.Key)
+	if err != nil {
+		return nil, err
+	}
+	if conn != nil {
+		return cacheapiv2.NewCacheServiceClient(conn).Set(fctx, r)
+	}
+
+	record := r.GetRecord()
+	c.logger.Infow(ctx, "setting key", "key", r.Key, "bucket", r.Bucket, "content_type", record.GetContentType(), "size", len(record.GetValue()))
+
+	// an empty value is still a value, a nil value would read as a miss
+	value := record.GetValue()
+	if value == nil {
+		value = []byte{}
+	}
+
+	release, err := c.checkQuota(ctx, r.Bucket, r.Key, len(value))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	err = c.buckets.Set(ctx, r.Bucket, r.Key, value,
+		WithTTL(time.Duration(r.TtlSeconds)*time.Second),
+		WithEvictionPolicy(getEvictionPolicyV2(r.EvictionPolicy)),
+		WithContentType(record.GetContentType()),
+		WithMetadata(record.GetMetadata()),
+	)
+	if err != nil {
+		c.logger.Errorf(ctx, "failed to set key: %v", err)
+		if errors.Is(err, ErrReadOnly) {
+			return nil, readOnlyError(err)
+		}
+		return nil, err
+	}
+	return &cacheapiv2.SetResponse{}, nil
+}
+
+func (c *cacheServiceV2) Get(ctx context.Context, r *cacheapiv2.GetRequest) (*cacheapiv2.GetResponse, error) {
+	if err := c.validateKey(r.Bucket, r.Key); err != nil {
+		return nil, err
+	}
+
+	conn, fctx, err := c.route(ctx, r.Bucket, r.Key)
+	if err != nil {
+		return nil, err
+	}
+	if conn != nil {
+		return cacheapiv2.NewCacheServiceClient(conn).Get(fctx, r)
+	}
+
+	e, err := c.get(ctx, r.Bucket, r.Key)
+	if err != nil {
+		c.logger.Errorf(ctx, "failed to get key: %v", err)
+		return nil, err
+	}
+	if e == nil {
+		return &cacheapiv2.GetResponse{}, nil
+	}
+	return &cacheapiv2.GetResponse{
+		Record: &cacheapiv2.Record{Value: e.Value, ContentType: e.ContentType, Metadata: e.Metadata},
+		Found:  true,
+	}, nil
+}
+
+func (c *cacheServiceV2) GetValue(ctx context.Context, r *cacheapiv2.GetValueRequest) (*httpbody.HttpBody, error) {
+	if err := c.validateKey(r.Bucket, r.Key); err != nil {
+		return nil, err
+	}
+
+	conn, fctx, err := c.route(ctx, r.Bucket, r.Key)
+	if err != nil {
+		return nil, err
+	}
+	if conn != nil {
+		return cacheapiv2.NewCacheServiceClient(conn).GetValue(fctx, r)
+	}
+
+	e, err := c.get(ctx, r.Bucket, r.Key)
+	if err != nil {
+		c.logger.Errorf(ctx, "failed to get key: %v", err)
+		return nil, err
+	}
+	if e == nil {
+		return nil, withReason(status.Newf(codes.NotFound, "key %q not found in bucket %q", r.Key, r.Bucket), ReasonKeyNotFound)
+	}
+
+	contentType := e.ContentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	return &httpbody.HttpBody{ContentType: contentType, Data: e.Value}, nil
+}
+
+// get returns the entry of a key, or nil, counting the hit or miss and promoting the key from the
+// disk tier.
+func (c *cacheServiceV2) get(ctx context.Context, bucket, key string) (*Entry, error) {
+	return c.buckets.GetEntry(ctx, bucket, key)
+}
+
+func (c *cacheServiceV2) Delete(ctx context.Context, r *cacheapiv2.DeleteRequest) (*cacheapiv2.DeleteResponse, error) {
+	if err := c.validateKey(r.Bucket, r.Key); err != nil {
+		return nil, err
+	}
+
+	conn, fctx, err := c.route(ctx, r.Bucket, r.Key)
+	if err != nil {
+		return nil, err
+	}
+	if conn != nil {
+		return cacheapiv2.NewCacheServiceClient(conn).Delete(fctx, r)
+	}
+
+	c.logger.Infow(ctx, "deleting key", "key", r.Key, "bucket", r.Bucket)
+
+	e, err := c.buckets.Lookup(ctx, r.Bucket, r.Key)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.buckets.Delete(ctx, r.Bucket, r.Key); err != nil {
+		c.logger.Errorf(ctx, "failed to delete key: %v", err)
+		if errors.Is(err, ErrReadOnly) {
+			return nil, readOnlyError(err)
+		}
+		return nil, err
+	}
+	return &cacheapiv2.DeleteResponse{Deleted: e != nil}, nil
+}
+
+func getEvictionPolicyV2(ep cacheapiv2.EvictionPolicy) EvictionPolicy {
+	switch ep {
+	case cacheapiv2.EvictionPolicy_EVICTION_POLICY_OLDEST:
+		return EvictOldest
+	case cacheapiv2.EvictionPolicy_EVICTION_POLICY_MRU:
+		return EvictMRU
+	case cacheapiv2.EvictionPolicy_EVICTION_POLICY_NEWEST:
+		return EvictNewest
+	default:
+		return EvictLRU
+	}
+}
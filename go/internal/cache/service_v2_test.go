@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/stretchr/testify/require"
+
+	cacheapiv2 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v2"
+)
+
+func TestCacheServiceV2Gateway(t *testing.T) {
+	mux := runtime.NewServeMux()
+	svc := NewCacheServiceV2(newTestLogger(), NewCache())
+	require.NoError(t, cacheapiv2.RegisterCacheServiceHandlerServer(context.Background(), mux, svc))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	png := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0x0d, 0x0a}
+	_, err := svc.Set(context.Background(), &cacheapiv2.SetRequest{
+		Bucket: "images",
+		Key:    "logo",
+		Record: &cacheapiv2.Record{
+			Value:       png,
+			ContentType: "image/png",
+			Metadata:    map[string]string{"owner": "web"},
+		},
+	})
+	require.NoError(t, err)
+
+	// the value is served raw with its stored content type
+	resp, err := http.Get(server.URL + "/v2/buckets/images/keys/logo")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+	require.Equal(t, png, body)
+
+	// the record carries the value as base64 along with its metadata
+	resp, err = http.Get(server.URL + "/v2/buckets/images/keys/logo/record")
+	require.NoError(t, err)
+	var got struct {
+		Record struct {
+			Value       []byte            `json:"value"`
+			ContentType string            `json:"contentType"`
+			Metadata    map[string]string `json:"metadata"`
+		} `json:"record"`
+		Found bool `json:"found"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	resp.Body.Close()
+	require.True(t, got.Found)
+	require.Equal(t, png, got.Record.Value)
+	require.Equal(t, "image/png", got.Record.ContentType)
+	require.Equal(t, map[string]string{"owner": "web"}, got.Record.Metadata)
+
+	// values set over REST default to application/octet-stream
+	req, err := http.NewRequest(http.MethodPut, server.URL+"/v2/buckets/images/keys/blob",
+		strings.NewReader(`{"record":{"value":"AAEC"}}`))
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/v2/buckets/images/keys/blob")
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, "application/octet-stream", resp.Header.Get("Content-Type"))
+	require.Equal(t, []byte{0, 1, 2}, body)
+
+	resp, err = http.Get(server.URL + "/v2/buckets/images/keys/missing")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestCacheServiceV2GetAtCapacity(t *testing.T) {
+	store := NewCacheWithCapacity(1)
+	svc := NewCacheServiceV2(newTestLogger(), store)
+	ctx := context.Background()
+
+	set := func(key string) {
+		_, err := svc.Set(ctx, &cacheapiv2.SetRequest{
+			Bucket: "images",
+			Key:    key,
+			Record: &cacheapiv2.Record{Value: []byte(key), ContentType: "text/plain"},
+		})
+		require.NoError(t, err)
+	}
+
+	// a get from a full bucket evicts the oldest key, which is the key read
+	set("logo")
+	got, err := svc.Get(ctx, &cacheapiv2.GetRequest{Bucket: "images", Key: "logo"})
+	require.NoError(t, err)
+	require.True(t, got.Found)
+	require.Equal(t, []byte("logo"), got.Record.Value)
+	require.Equal(t, "text/plain", got.Record.ContentType)
+
+	set("icon")
+	value, err := svc.GetValue(ctx, &cacheapiv2.GetValueRequest{Bucket: "images", Key: "icon"})
+	require.NoError(t, err)
+	require.Equal(t, "text/plain", value.ContentType)
+	require.Equal(t, []byte("icon"), value.Data)
+
+	require.Equal(t, uint64(2), store.Stats().Hits)
+}
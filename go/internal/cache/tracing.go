@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records the spans of cache operations with the global tracer provider, as children of the
+// span of the call they serve.
+var tracer = otel.Tracer("github.com/ahmedalhulaibi/cache-api/internal/cache")
+
+const (
+	attrBucket         = attribute.Key("cache.bucket")
+	attrKey            = attribute.Key("cache.key")
+	attrValueSize      = attribute.Key("cache.value_size")
+	attrHit            = attribute.Key("cache.hit")
+	attrTier           = attribute.Key("cache.tier")
+	attrLock           = attribute.Key("cache.lock")
+	attrLockWait       = attribute.Key("cache.lock_wait_ns")
+	attrVictimKey      = attribute.Key("cache.victim_key")
+	attrEvictionPolicy = attribute.Key("cache.eviction_policy")
+	attrSpilled        = attribute.Key("cache.spilled")
+)
+
+// startSpan starts the span of an operation on a key of a bucket, key is omitted when empty.
+func startSpan(ctx context.Context, name, bucket, key string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attrBucket.String(bucket)}
+	if key != "" {
+		attrs = append(attrs, attrKey.String(key))
+	}
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// acquire calls lock and records how long it waited for the lock called name as an event of the
+// span of ctx.
+func acquire(ctx context.Context, name string, lock func()) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		lock()
+		return
+	}
+
+	start := time.Now()
+	lock()
+	span.AddEvent("lock acquired", trace.WithAttributes(
+		attrLock.String(name),
+		attrLockWait.Int64(time.Since(start).Nanoseconds()),
+	))
+}
+
+// recordLookup records whether a get found a live value, and in which tier.
+func recordLookup(ctx context.Context, hit bool, tier string) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attrHit.Bool(hit))
+	if hit {
+		span.SetAttributes(attrTier.String(tier))
+	}
+}
+
+// recordExpiry records the removal of an expired key.
+func recordExpiry(ctx context.Context, key string) {
+	trace.SpanFromContext(ctx).AddEvent("expired", trace.WithAttributes(attrKey.String(key)))
+}
+
+// recordEviction records the eviction of a key by policy, spilled when it moved to the disk tier.
+func recordEviction(ctx context.Context, victim string, policy EvictionPolicy, spilled bool) {
+	trace.SpanFromContext(ctx).AddEvent("evicted", trace.WithAttributes(
+		attrVictimKey.String(victim),
+		attrEvictionPolicy.String(string(policy)),
+		attrSpilled.Bool(spilled),
+	))
+}
@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanAttrs(s tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range s.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, s := range spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	require.Failf(t, "span not found", "no %s span in %d spans", name, len(spans))
+	return tracetest.SpanStub{}
+}
+
+func findEvent(t *testing.T, s tracetest.SpanStub, name string) map[attribute.Key]attribute.Value {
+	t.Helper()
+	for _, e := range s.Events {
+		if e.Name == name {
+			attrs := make(map[attribute.Key]attribute.Value)
+			for _, kv := range e.Attributes {
+				attrs[kv.Key] = kv.Value
+			}
+			return attrs
+		}
+	}
+	require.Failf(t, "event not found", "no %s event on the %s span", name, s.Name)
+	return nil
+}
+
+// The tracer of the package delegates to the first global tracer provider, so every case shares it.
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+	otel.SetTracerProvider(tp)
+
+	t.Run("hit and miss", func(t *testing.T) {
+		exporter.Reset()
+		b := NewCacheWithCapacity(2)
+		ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+		require.NoError(t, b.Set(ctx, "bucket", "key", []byte("value")))
+		_, err := b.Get(ctx, "bucket", "key")
+		require.NoError(t, err)
+		_, err = b.Get(ctx, "bucket", "missing")
+		require.NoError(t, err)
+		parent.End()
+
+		spans := exporter.GetSpans()
+		set := findSpan(t, spans, "cache.Set")
+		require.Equal(t, parent.SpanContext().SpanID(), set.Parent.SpanID())
+		attrs := spanAttrs(set)
+		require.Equal(t, "bucket", attrs[attrBucket].AsString())
+		require.Equal(t, "key", attrs[attrKey].AsString())
+		require.Equal(t, int64(5), attrs[attrValueSize].AsInt64())
+		lock := findEvent(t, set, "lock acquired")
+		require.Equal(t, "buckets", lock[attrLock].AsString())
+
+		var hits, misses int
+		for _, s := range spans {
+			if s.Name != "cache.Get" {
+				continue
+			}
+			attrs := spanAttrs(s)
+			if attrs[attrHit].AsBool() {
+				hits++
+				require.Equal(t, "key", attrs[attrKey].AsString())
+				require.Equal(t, "memory", attrs[attrTier].AsString())
+				require.Equal(t, int64(5), attrs[attrValueSize].AsInt64())
+			} else {
+				misses++
+				require.Equal(t, "missing", attrs[attrKey].AsString())
+			}
+		}
+		require.Equal(t, 1, hits)
+		require.Equal(t, 1, misses)
+	})
+
+	t.Run("eviction", func(t *testing.T) {
+		exporter.Reset()
+		b := NewCacheWithCapacity(1)
+		require.NoError(t, b.Set(context.Background(), "bucket", "key1", []byte("value1")))
+		require.NoError(t, b.Set(context.Background(), "bucket", "key2", []byte("value2"), WithEvictionPolicy(EvictOldest)))
+
+		var set tracetest.SpanStub
+		for _, s := range exporter.GetSpans() {
+			if s.Name == "cache.Set" && spanAttrs(s)[attrKey].AsString() == "key2" {
+				set = s
+			}
+		}
+		evicted := findEvent(t, set, "evicted")
+		require.Equal(t, "key1", evicted[attrVictimKey].AsString())
+		require.Equal(t, string(EvictOldest), evicted[attrEvictionPolicy].AsString())
+		require.False(t, evicted[attrSpilled].AsBool())
+	})
+
+	t.Run("disk load", func(t *testing.T) {
+		b, _ := newTestDiskCache(t, 1, DiskTierConfig{})
+		require.NoError(t, b.Set(context.Background(), "bucket", "key1", []byte("value1")))
+		require.NoError(t, b.Set(context.Background(), "bucket", "key2", []byte("value2")))
+
+		exporter.Reset()
+		v, err := b.Get(context.Background(), "bucket", "key1")
+		require.NoError(t, err)
+		require.Equal(t, []byte("value1"), v)
+
+		spans := exporter.GetSpans()
+		get := findSpan(t, spans, "cache.Get")
+		require.Equal(t, "disk", spanAttrs(get)[attrTier].AsString())
+		load := findSpan(t, spans, "cache.load")
+		require.Equal(t, get.SpanContext.SpanID(), load.Parent.SpanID())
+		require.Equal(t, "key1", spanAttrs(load)[attrKey].AsString())
+	})
+}
@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Limits bounds the requests served by the cache services. A zero limit is not enforced, empty
+// buckets and keys and negative TTLs are always rejected.
+type Limits struct {
+	MaxKeyLength int
+	MaxValueSize int
+	// MaxTTL bounds the TTL of a key, keys set without a TTL never expire and are still accepted.
+	MaxTTL time.Duration
+	// BucketPattern is the pattern every bucket name must match.
+	BucketPattern *regexp.Regexp
+}
+
+// WithLimits rejects requests that exceed the limits with InvalidArgument before the cache is touched.
+func WithLimits(limits Limits) ServiceOption {
+	return func(c *cacheService) {
+		c.limits = limits
+	}
+}
+
+// violations collects the invalid fields of a request, reported as google.rpc.BadRequest details.
+type violations struct {
+	fields []*errdetails.BadRequest_FieldViolation
+	// valueTooLarge is set when the value exceeds the max value size
+	valueTooLarge bool
+}
+
+func (v *violations) add(field, format string, args ...any) {
+	v.fields = append(v.fields, &errdetails.BadRequest_FieldViolation{
+		Field:       field,
+		Description: fmt.Sprintf(format, args...),
+	})
+}
+
+// err returns an InvalidArgument status carrying every violation, or nil. A value too large that is
+// the only violation is reported with the VALUE_TOO_LARGE reason.
+func (v violations) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+
+	st := status.Newf(codes.InvalidArgument, "invalid %s: %s", v.fields[0].Field, v.fields[0].Description)
+	badRequest := &errdetails.BadRequest{FieldViolations: v.fields}
+	if v.valueTooLarge && len(v.fields) == 1 {
+		return withReason(st, ReasonValueTooLarge, badRequest)
+	}
+	detailed, err := st.WithDetails(badRequest)
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// validateKey validates the bucket and key of a request that reads or deletes a key.
+func (c *cacheService) validateKey(bucket, key string) error {
+	var v violations
+	c.limits.checkBucket(&v, "bucket", bucket)
+	c.limits.checkKey(&v, "key", key)
+	return v.err()
+}
+
+func (l Limits) checkBucket(v *violations, field, bucket string) {
+	switch {
+	case bucket == "":
+		v.add(field, "must not be empty")
+	case l.BucketPattern != nil && !l.BucketPattern.MatchString(bucket):
+		v.add(field, "must match %s", l.BucketPattern)
+	}
+}
+
+func (l Limits) checkKey(v *violations, field, key string) {
+	switch {
+	case key == "":
+		v.add(field, "must not be empty")
+	case l.MaxKeyLength > 0 && len(key) > l.MaxKeyLength:
+		v.add(field, "must be at most %d bytes, got %d", l.MaxKeyLength, len(key))
+	}
+}
+
+func (l Limits) checkValue(v *violations, field string, size int) {
+	if l.MaxValueSize > 0 && size > l.MaxValueSize {
+		v.add(field, "must be at most %d bytes, got %d", l.MaxValueSize, size)
+		v.valueTooLarge = true
+	}
+}
+
+func (l Limits) checkTTL(v *violations, field string, ttlSeconds int64) {
+	switch {
+	case ttlSeconds < 0:
+		v.add(field, "must not be negative")
+	case l.MaxTTL > 0 && ttlSeconds > int64(l.MaxTTL/time.Second):
+		v.add(field, "must be at most %d seconds", int64(l.MaxTTL/time.Second))
+	}
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	cacheapiv1 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v1"
+)
+
+func TestValidation(t *testing.T) {
+	b := NewCache()
+	svc := NewCacheService(newTestLogger(), b, WithLimits(Limits{
+		MaxKeyLength:  8,
+		MaxValueSize:  16,
+		MaxTTL:        time.Hour,
+		BucketPattern: regexp.MustCompile(`^[a-z]+$`),
+	}))
+	ctx := context.Background()
+
+	fields := func(err error) []string {
+		t.Helper()
+		st := status.Convert(err)
+		require.Equal(t, codes.InvalidArgument, st.Code())
+		require.Len(t, st.Details(), 1)
+		var got []string
+		for _, v := range st.Details()[0].(*errdetails.BadRequest).GetFieldViolations() {
+			got = append(got, v.Field)
+		}
+		return got
+	}
+
+	_, err := svc.Set(ctx, &cacheapiv1.SetRequest{})
+	require.Equal(t, []string{"bucket", "key"}, fields(err))
+
+	_, err = svc.Set(ctx, &cacheapiv1.SetRequest{
+		Bucket:  "Bad-Bucket",
+		Key:     "a-very-long-key",
+		Value:   strings.Repeat("x", 17),
+		Options: &cacheapiv1.Options{TtlSeconds: -1},
+	})
+	require.Equal(t, []string{"bucket", "key", "value", "options.ttlSeconds"}, fields(err))
+
+	_, err = svc.Set(ctx, &cacheapiv1.SetRequest{Bucket: "b", Key: "k", Options: &cacheapiv1.Options{TtlSeconds: 7200}})
+	require.Equal(t, []string{"options.ttlSeconds"}, fields(err))
+
+	_, err = svc.Get(ctx, &cacheapiv1.GetRequest{Bucket: "b"})
+	require.Equal(t, []string{"key"}, fields(err))
+
+	_, err = svc.Delete(ctx, &cacheapiv1.DeleteRequest{Key: "k"})
+	require.Equal(t, []string{"bucket"}, fields(err))
+
+	// nothing was stored by the rejected requests
+	require.Empty(t, b.Buckets())
+
+	_, err = svc.Set(ctx, &cacheapiv1.SetRequest{Bucket: "b", Key: "k", Value: "v", Options: &cacheapiv1.Options{TtlSeconds: 60}})
+	require.NoError(t, err)
+}
+
+func TestValidationGateway(t *testing.T) {
+	mux := runtime.NewServeMux()
+	svc := NewCacheService(newTestLogger(), NewCache(), WithLimits(Limits{MaxKeyLength: 4}))
+	require.NoError(t, cacheapiv1.RegisterCacheServiceHandlerServer(context.Background(), mux, svc))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/v1/set", "application/json", strings.NewReader(`{"bucket":"b","key":"too-long"}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	var body struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Details []struct {
+			Type            string `json:"@type"`
+			FieldViolations []struct {
+				Field       string `json:"field"`
+				Description string `json:"description"`
+			} `json:"fieldViolations"`
+		} `json:"details"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, int(codes.InvalidArgument), body.Code)
+	require.Len(t, body.Details, 1)
+	require.Equal(t, "type.googleapis.com/google.rpc.BadRequest", body.Details[0].Type)
+	require.Len(t, body.Details[0].FieldViolations, 1)
+	require.Equal(t, "key", body.Details[0].FieldViolations[0].Field)
+	require.Equal(t, "must be at most 4 bytes, got 8", body.Details[0].FieldViolations[0].Description)
+}
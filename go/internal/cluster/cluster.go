@@ -0,0 +1,279 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/auth"
+	cacheapiv1 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v1"
+)
+
+const (
+	ShardByKey    = "key"
+	ShardByBucket = "bucket"
+)
+
+type Config struct {
+	// SelfAddr is the grpc address other members use to reach this instance
+	SelfAddr string
+	// Peers is a static list of member grpc addresses
+	Peers []string
+	// DNSName is resolved periodically and every address is a member listening on DNSPort
+	DNSName            string
+	DNSPort            string
+	DNSRefreshInterval time.Duration
+	VirtualNodes       int
+	ShardBy            string
+}
+
+// Cluster maintains the ring of members and the connections used to forward requests to them.
+type Cluster struct {
+	logger      *loggy.Logger
+	config      Config
+	dialOptions []grpc.DialOption
+	lookupHost  func(ctx context.Context, host string) ([]string, error)
+
+	ring atomic.Pointer[Ring]
+	// resolved is set once the members were looked up from DNS
+	resolved atomic.Bool
+
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+
+	cacheapiv1.UnimplementedClusterServiceServer
+}
+
+var _ cacheapiv1.ClusterServiceServer = (*Cluster)(nil)
+
+// MethodPermissions are the permissions required by the RPCs of the cluster service, the ring spans
+// every bucket.
+var MethodPermissions = auth.MethodPermissions{
+	cacheapiv1.ClusterService_GetRing_FullMethodName:  auth.PermissionAdmin,
+	cacheapiv1.ClusterService_GetOwner_FullMethodName: auth.PermissionRead,
+}
+
+func New(logger *loggy.Logger, config Config, dialOptions ...grpc.DialOption) (*Cluster, error) {
+	if config.SelfAddr == "" {
+		return nil, fmt.Errorf("cluster self address is required")
+	}
+	if len(config.Peers) == 0 && config.DNSName == "" {
+		return nil, fmt.Errorf("cluster peers or dns name is required")
+	}
+
+	switch config.ShardBy {
+	case ShardByKey, ShardByBucket:
+	case "":
+		config.ShardBy = ShardByKey
+	default:
+		return nil, fmt.Errorf("unknown cluster shard by %q", config.ShardBy)
+	}
+
+	if config.DNSRefreshInterval <= 0 {
+		config.DNSRefreshInterval = 10 * time.Second
+	}
+
+	if len(dialOptions) == 0 {
+		dialOptions = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+
+	c := &Cluster{
+		logger:      logger,
+		config:      config,
+		dialOptions: dialOptions,
+		lookupHost:  net.DefaultResolver.LookupHost,
+		conns:       make(map[string]*grpc.ClientConn),
+	}
+	c.setMembers(context.Background(), config.Peers)
+
+	return c, nil
+}
+
+// Run refreshes the members from DNS until ctx is done and then closes peer connections.
+func (c *Cluster) Run(ctx context.Context) error {
+	defer c.closeConns()
+
+	if c.config.DNSName == "" {
+		c.resolved.Store(true)
+		<-ctx.Done()
+		return nil
+	}
+
+	ticker := time.NewTicker(c.config.DNSRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		c.refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Cluster) refresh(ctx context.Context) {
+	hosts, err := c.lookupHost(ctx, c.config.DNSName)
+	if err != nil {
+		c.logger.Warnw(ctx, "cluster dns lookup failed", "name", c.config.DNSName, "err", err)
+		return
+	}
+
+	members := append([]string(nil), c.config.Peers...)
+	for _, h := range hosts {
+		members = append(members, net.JoinHostPort(h, c.config.DNSPort))
+	}
+	c.setMembers(ctx, members)
+	c.resolved.Store(true)
+}
+
+// Ready returns an error until the members were resolved, requests would otherwise be routed by
+// a ring missing most members.
+func (c *Cluster) Ready() error {
+	if !c.resolved.Load() {
+		return fmt.Errorf("cluster members of %s not resolved", c.config.DNSName)
+	}
+	return nil
+}
+
+func (c *Cluster) setMembers(ctx context.Context, members []string) {
+	seen := map[string]bool{c.config.SelfAddr: true}
+	unique := []string{c.config.SelfAddr}
+	for _, m := range members {
+		if !seen[m] {
+			seen[m] = true
+			unique = append(unique, m)
+		}
+	}
+
+	if r := c.ring.Load(); r != nil && r.equal(unique) {
+		return
+	}
+
+	c.ring.Store(NewRing(unique, c.config.VirtualNodes))
+	c.logger.Infow(ctx, "cluster membership changed", "members", unique)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for addr, conn := range c.conns {
+		if !seen[addr] {
+			conn.Close()
+			delete(c.conns, addr)
+		}
+	}
+}
+
+func (c *Cluster) Ring() *Ring {
+	return c.ring.Load()
+}
+
+func (c *Cluster) shardKey(bucket, key string) string {
+	if c.config.ShardBy == ShardByBucket {
+		return bucket
+	}
+	return bucket + "\x00" + key
+}
+
+// Owner returns the address of the member owning bucket/key.
+func (c *Cluster) Owner(bucket, key string) string {
+	return c.Ring().Owner(c.shardKey(bucket, key))
+}
+
+// Route returns a connection to the member owning bucket/key, or nil when this instance owns it.
+func (c *Cluster) Route(bucket, key string) (grpc.ClientConnInterface, error) {
+	owner := c.Owner(bucket, key)
+	if owner == c.config.SelfAddr {
+		return nil, nil
+	}
+
+	conn, err := c.conn(owner)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Peers returns a connection to every member but this instance.
+func (c *Cluster) Peers() ([]grpc.ClientConnInterface, error) {
+	var conns []grpc.ClientConnInterface
+	for _, m := range c.Ring().Members() {
+		if m == c.config.SelfAddr {
+			continue
+		}
+		conn, err := c.conn(m)
+		if err != nil {
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
+
+func (c *Cluster) conn(addr string) (*grpc.ClientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if conn, ok := c.conns[addr]; ok {
+		return conn, nil
+	}
+
+	conn, err := grpc.NewClient(addr, c.dialOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("cluster peer %s: %w", addr, err)
+	}
+	c.conns[addr] = conn
+	return conn, nil
+}
+
+func (c *Cluster) closeConns() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for addr, conn := range c.conns {
+		conn.Close()
+		delete(c.conns, addr)
+	}
+}
+
+func (c *Cluster) member(addr string, ownership map[string]float64) *cacheapiv1.RingMember {
+	return &cacheapiv1.RingMember{
+		Addr:      addr,
+		Self:      addr == c.config.SelfAddr,
+		Ownership: ownership[addr],
+	}
+}
+
+func (c *Cluster) GetRing(ctx context.Context, r *cacheapiv1.GetRingRequest) (*cacheapiv1.GetRingResponse, error) {
+	ring := c.Ring()
+	ownership := ring.Ownership()
+
+	resp := &cacheapiv1.GetRingResponse{
+		ShardBy:      c.config.ShardBy,
+		VirtualNodes: uint32(c.config.VirtualNodes),
+	}
+	for _, m := range ring.Members() {
+		resp.Members = append(resp.Members, c.member(m, ownership))
+	}
+	return resp, nil
+}
+
+func (c *Cluster) GetOwner(ctx context.Context, r *cacheapiv1.GetOwnerRequest) (*cacheapiv1.GetOwnerResponse, error) {
+	if r.Bucket == "" || (r.Key == "" && c.config.ShardBy == ShardByKey) {
+		return nil, status.Error(codes.InvalidArgument, "bucket and key are required")
+	}
+
+	ring := c.Ring()
+	return &cacheapiv1.GetOwnerResponse{
+		Owner: c.member(ring.Owner(c.shardKey(r.Bucket, r.Key)), ring.Ownership()),
+	}, nil
+}
@@ -0,0 +1,190 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/cache"
+	cacheapiv1 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v1"
+)
+
+type member struct {
+	addr    string
+	store   cache.Store
+	cluster *Cluster
+	client  cacheapiv1.CacheServiceClient
+}
+
+func newTestLogger() *loggy.Logger {
+	l := loggy.New(zap.NewNop().Sugar())
+	return &l
+}
+
+func startMembers(t *testing.T, n int, shardBy string) []*member {
+	t.Helper()
+	listeners := make([]net.Listener, n)
+	addrs := make([]string, n)
+	for i := range listeners {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		listeners[i] = lis
+		addrs[i] = lis.Addr().String()
+	}
+
+	members := make([]*member, n)
+	for i, lis := range listeners {
+		cl, err := New(newTestLogger(), Config{SelfAddr: addrs[i], Peers: addrs, VirtualNodes: 64, ShardBy: shardBy})
+		require.NoError(t, err)
+		t.Cleanup(cl.closeConns)
+
+		store := cache.NewCache()
+		srv := grpc.NewServer()
+		cacheapiv1.RegisterCacheServiceServer(srv, cache.NewCacheService(newTestLogger(), store, cache.WithRouter(cl)))
+		cacheapiv1.RegisterClusterServiceServer(srv, cl)
+		go srv.Serve(lis)
+		t.Cleanup(srv.Stop)
+
+		conn, err := grpc.NewClient(addrs[i], grpc.WithTransportCredentials(insecure.NewCredentials()))
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+
+		members[i] = &member{addr: addrs[i], store: store, cluster: cl, client: cacheapiv1.NewCacheServiceClient(conn)}
+	}
+	return members
+}
+
+func TestClusterForwarding(t *testing.T) {
+	ctx := context.Background()
+	members := startMembers(t, 3, ShardByKey)
+
+	owners := map[string]int{}
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		// write through one member and read through another
+		_, err := members[i%3].client.Set(ctx, &cacheapiv1.SetRequest{Bucket: "bucket1", Key: key, Value: key})
+		require.NoError(t, err)
+		resp, err := members[(i+1)%3].client.Get(ctx, &cacheapiv1.GetRequest{Bucket: "bucket1", Key: key})
+		require.NoError(t, err)
+		require.Equal(t, key, resp.Value)
+
+		owner := members[0].cluster.Owner("bucket1", key)
+		owners[owner]++
+		for _, m := range members {
+			v, err := m.store.Get(context.Background(), "bucket1", key)
+			require.NoError(t, err)
+			if m.addr == owner {
+				require.Equal(t, []byte(key), v)
+			} else {
+				require.Nil(t, v)
+			}
+		}
+	}
+	require.Len(t, owners, 3)
+}
+
+func TestClusterShardByBucket(t *testing.T) {
+	ctx := context.Background()
+	members := startMembers(t, 2, ShardByBucket)
+
+	owner := members[0].cluster.Owner("bucket1", "")
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		require.Equal(t, owner, members[1].cluster.Owner("bucket1", key))
+		_, err := members[i%2].client.Set(ctx, &cacheapiv1.SetRequest{Bucket: "bucket1", Key: key, Value: key})
+		require.NoError(t, err)
+	}
+
+	for _, m := range members {
+		v, err := m.store.Get(context.Background(), "bucket1", "key-0")
+		require.NoError(t, err)
+		require.Equal(t, m.addr == owner, v != nil)
+	}
+}
+
+func TestClusterMergesUnkeyedRequests(t *testing.T) {
+	ctx := context.Background()
+	members := startMembers(t, 3, ShardByKey)
+
+	var keys []string
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key-%02d", i)
+		keys = append(keys, key)
+		_, err := members[0].client.Set(ctx, &cacheapiv1.SetRequest{Bucket: fmt.Sprintf("bucket%d", i%2), Key: key, Value: key})
+		require.NoError(t, err)
+	}
+
+	// every member answers for the whole cluster
+	for _, m := range members {
+		buckets, err := m.client.ListBuckets(ctx, &cacheapiv1.ListBucketsRequest{})
+		require.NoError(t, err)
+		require.Equal(t, []string{"bucket0", "bucket1"}, buckets.Buckets)
+
+		var listed []string
+		for _, bucket := range buckets.Buckets {
+			resp, err := m.client.ListKeys(ctx, &cacheapiv1.ListKeysRequest{Bucket: bucket})
+			require.NoError(t, err)
+			listed = append(listed, resp.Keys...)
+		}
+		require.ElementsMatch(t, keys, listed)
+
+		resp, err := m.client.ListKeys(ctx, &cacheapiv1.ListKeysRequest{Bucket: "bucket0", Prefix: "key-1"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"key-10", "key-12", "key-14", "key-16", "key-18"}, resp.Keys)
+	}
+
+	for _, key := range keys[:5] {
+		_, err := members[1].client.Get(ctx, &cacheapiv1.GetRequest{Bucket: "bucket0", Key: key})
+		require.NoError(t, err)
+	}
+	stats, err := members[2].client.GetStats(ctx, &cacheapiv1.GetStatsRequest{})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), stats.Hits)
+	require.Equal(t, uint64(2), stats.Misses)
+}
+
+func TestClusterRingAPI(t *testing.T) {
+	ctx := context.Background()
+	members := startMembers(t, 2, ShardByKey)
+
+	ring, err := members[0].cluster.GetRing(ctx, &cacheapiv1.GetRingRequest{})
+	require.NoError(t, err)
+	require.Len(t, ring.Members, 2)
+	require.Equal(t, ShardByKey, ring.ShardBy)
+	for _, m := range ring.Members {
+		require.Equal(t, m.Addr == members[0].addr, m.Self)
+		require.Greater(t, m.Ownership, 0.0)
+	}
+
+	owner, err := members[1].cluster.GetOwner(ctx, &cacheapiv1.GetOwnerRequest{Bucket: "bucket1", Key: "key1"})
+	require.NoError(t, err)
+	require.Equal(t, members[0].cluster.Owner("bucket1", "key1"), owner.Owner.Addr)
+}
+
+func TestClusterDNSMembership(t *testing.T) {
+	cl, err := New(newTestLogger(), Config{SelfAddr: "10.0.0.1:8090", DNSName: "cache-api-peers", DNSPort: "8090", VirtualNodes: 8})
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.1:8090"}, cl.Ring().Members())
+
+	cl.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		require.Equal(t, "cache-api-peers", host)
+		return []string{"10.0.0.1", "10.0.0.2"}, nil
+	}
+	cl.refresh(context.Background())
+	require.Equal(t, []string{"10.0.0.1:8090", "10.0.0.2:8090"}, cl.Ring().Members())
+}
+
+func TestMethodPermissions(t *testing.T) {
+	desc := cacheapiv1.ClusterService_ServiceDesc
+	for _, m := range desc.Methods {
+		require.Contains(t, MethodPermissions, "/"+desc.ServiceName+"/"+m.MethodName)
+	}
+	require.Empty(t, desc.Streams)
+}
@@ -0,0 +1,109 @@
+package cluster
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// Ring is an immutable consistent-hash ring. Each member is placed on the ring at several
+// virtual nodes so that keys spread evenly and only move to or from a member that joins or leaves.
+type Ring struct {
+	members []string
+	points  []point
+}
+
+type point struct {
+	hash   uint64
+	member string
+}
+
+func NewRing(members []string, virtualNodes int) *Ring {
+	if virtualNodes < 1 {
+		virtualNodes = 1
+	}
+
+	r := &Ring{
+		members: append([]string(nil), members...),
+		points:  make([]point, 0, len(members)*virtualNodes),
+	}
+	sort.Strings(r.members)
+
+	for _, m := range r.members {
+		for i := 0; i < virtualNodes; i++ {
+			r.points = append(r.points, point{hash: hash(m + "#" + strconv.Itoa(i)), member: m})
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool {
+		if r.points[i].hash == r.points[j].hash {
+			return r.points[i].member < r.points[j].member
+		}
+		return r.points[i].hash < r.points[j].hash
+	})
+
+	return r
+}
+
+// Owner returns the member owning key, or "" for an empty ring.
+func (r *Ring) Owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+
+	h := hash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].member
+}
+
+func (r *Ring) Members() []string {
+	return append([]string(nil), r.members...)
+}
+
+// Ownership returns the fraction of the hash space owned by each member.
+func (r *Ring) Ownership() map[string]float64 {
+	ownership := make(map[string]float64, len(r.members))
+	if len(r.points) == 0 {
+		return ownership
+	}
+
+	const space = float64(1<<64 - 1)
+	for i, p := range r.points {
+		// a point owns the arc from the previous point, the first point also owns the wrap-around arc
+		prev := r.points[(i+len(r.points)-1)%len(r.points)].hash
+		ownership[p.member] += float64(p.hash-prev) / space
+	}
+	if len(r.points) == 1 {
+		ownership[r.points[0].member] = 1
+	}
+	return ownership
+}
+
+func (r *Ring) equal(members []string) bool {
+	if len(members) != len(r.members) {
+		return false
+	}
+	sorted := append([]string(nil), members...)
+	sort.Strings(sorted)
+	for i := range sorted {
+		if sorted[i] != r.members[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// hash is FNV-1a with a murmur3 finalizer, FNV alone clusters keys that only differ in their last bytes.
+func hash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,50 @@
+package cluster
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRingOwnership(t *testing.T) {
+	r := NewRing([]string{"a:8090", "b:8090", "c:8090"}, 128)
+
+	ownership := r.Ownership()
+	require.Len(t, ownership, 3)
+	var total float64
+	for member, share := range ownership {
+		require.InDelta(t, 1.0/3, share, 0.1, member)
+		total += share
+	}
+	require.InDelta(t, 1.0, total, 0.0001)
+
+	require.Equal(t, map[string]float64{"a:8090": 1}, NewRing([]string{"a:8090"}, 1).Ownership())
+	require.Equal(t, "", NewRing(nil, 128).Owner("key"))
+}
+
+func TestRingMinimalMovement(t *testing.T) {
+	before := NewRing([]string{"a:8090", "b:8090", "c:8090"}, 128)
+	after := NewRing([]string{"a:8090", "b:8090", "c:8090", "d:8090"}, 128)
+
+	moved := 0
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if o := after.Owner(key); o != before.Owner(key) {
+			// keys only move to the new member
+			require.Equal(t, "d:8090", o)
+			moved++
+		}
+	}
+	require.InDelta(t, 2500, moved, 800)
+}
+
+func TestRingIsDeterministic(t *testing.T) {
+	r1 := NewRing([]string{"b:8090", "a:8090"}, 16)
+	r2 := NewRing([]string{"a:8090", "b:8090"}, 16)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		require.Equal(t, r1.Owner(key), r2.Owner(key))
+	}
+	require.True(t, r1.equal([]string{"a:8090", "b:8090"}))
+}
@@ -0,0 +1,62 @@
+package authn
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/auth"
+)
+
+// AuthnUnaryServerInterceptor returns a new unary server interceptor that rejects calls whose credentials
+// cannot be verified and injects the identity of the caller into the context.
+func AuthnUnaryServerInterceptor(logger *loggy.Logger, authenticator auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, logger, authenticator, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// AuthnStreamServerInterceptor returns a new stream server interceptor that rejects streams whose credentials
+// cannot be verified and injects the identity of the caller into the stream context.
+func AuthnStreamServerInterceptor(logger *loggy.Logger, authenticator auth.Authenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(stream.Context(), logger, authenticator, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+func authenticate(ctx context.Context, logger *loggy.Logger, authenticator auth.Authenticator, method string) (context.Context, error) {
+	id, err := authenticator.Authenticate(ctx, auth.CredentialsFromContext(ctx))
+	if err == nil && id == nil {
+		err = auth.ErrMissingCredentials
+	}
+	if err != nil {
+		logger.Infow(ctx, "authentication failed", "method", method, "err", err)
+		if errors.Is(err, auth.ErrMissingCredentials) || errors.Is(err, auth.ErrInvalidCredentials) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return nil, err
+	}
+	return auth.NewContext(ctx, id), nil
+}
+
+// serverStream overrides the context of a stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,126 @@
+package authz
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/auth"
+)
+
+// AuthzUnaryServerInterceptor returns a new unary server interceptor that rejects calls to the methods
+// listed in methods unless the access control list grants their permission on the buckets of the request.
+// Calls to the other methods of the services with listed methods are rejected.
+func AuthzUnaryServerInterceptor(logger *loggy.Logger, acl *auth.ACL, methods auth.MethodPermissions) grpc.UnaryServerInterceptor {
+	services := guardedServices(methods)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		p, ok := methods[info.FullMethod]
+		if !ok {
+			if err := unlisted(ctx, logger, services, info.FullMethod); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}
+		if err := authorize(ctx, logger, acl, info.FullMethod, p, req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// AuthzStreamServerInterceptor returns a new stream server interceptor that checks the first message of
+// streams to the methods listed in methods against the access control list. Streams to the other methods
+// of the services with listed methods are rejected.
+func AuthzStreamServerInterceptor(logger *loggy.Logger, acl *auth.ACL, methods auth.MethodPermissions) grpc.StreamServerInterceptor {
+	services := guardedServices(methods)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		p, ok := methods[info.FullMethod]
+		if !ok {
+			if err := unlisted(stream.Context(), logger, services, info.FullMethod); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}
+		return handler(srv, &serverStream{
+			ServerStream: stream,
+			authorize: func(m interface{}) error {
+				return authorize(stream.Context(), logger, acl, info.FullMethod, p, m)
+			},
+		})
+	}
+}
+
+// guardedServices returns the services of the methods, from their full method names.
+func guardedServices(methods auth.MethodPermissions) map[string]struct{} {
+	services := make(map[string]struct{}, len(methods))
+	for method := range methods {
+		services[service(method)] = struct{}{}
+	}
+	return services
+}
+
+// unlisted rejects a method missing from the method permissions of its service, so that a method
+// added to a guarded service is not left open until it is given a permission.
+func unlisted(ctx context.Context, logger *loggy.Logger, services map[string]struct{}, method string) error {
+	if _, ok := services[service(method)]; !ok {
+		return nil
+	}
+	logger.Warnw(ctx, "permission denied, method has no permission", "method", method, "principal", auth.Principal(ctx))
+	return status.Errorf(codes.PermissionDenied, "method %s is not allowed", method)
+}
+
+// service returns the service of a full method name such as /package.Service/Method.
+func service(method string) string {
+	if i := strings.LastIndex(method, "/"); i > 0 {
+		return method[:i]
+	}
+	return method
+}
+
+func authorize(ctx context.Context, logger *loggy.Logger, acl *auth.ACL, method string, p auth.Permission, req interface{}) error {
+	principal := auth.Principal(ctx)
+	for _, bucket := range buckets(req) {
+		if !acl.Allowed(principal, bucket, p) {
+			logger.Infow(ctx, "permission denied", "method", method, "principal", principal, "bucket", bucket, "permission", p)
+			if bucket == "" {
+				return status.Errorf(codes.PermissionDenied, "%s permission required on every bucket", p)
+			}
+			return status.Errorf(codes.PermissionDenied, "%s permission required on bucket %q", p, bucket)
+		}
+	}
+	return nil
+}
+
+// buckets returns the buckets a request operates on, an empty bucket stands for every bucket.
+func buckets(req interface{}) []string {
+	switch r := req.(type) {
+	case interface{ GetBucket() string }:
+		return []string{r.GetBucket()}
+	case interface{ GetBuckets() []string }:
+		if len(r.GetBuckets()) > 0 {
+			return r.GetBuckets()
+		}
+	}
+	return []string{""}
+}
+
+// serverStream authorizes the first message received on a stream.
+type serverStream struct {
+	grpc.ServerStream
+	authorize func(m interface{}) error
+	once      sync.Once
+	err       error
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	s.once.Do(func() { s.err = s.authorize(m) })
+	return s.err
+}
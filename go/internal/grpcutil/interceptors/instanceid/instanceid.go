@@ -16,3 +16,22 @@ func InstanceIdUnaryServerInterceptor(logger *loggy.Logger, instanceID string) g
 		return handler(ctx, req)
 	}
 }
+
+// InstanceIdStreamServerInterceptor returns a new stream server interceptor that injects the instance id into the
+// stream context.
+func InstanceIdStreamServerInterceptor(logger *loggy.Logger, instanceID string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, _ := logger.With(stream.Context(), ContextKey, instanceID)
+		return handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// serverStream overrides the context of a stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,277 @@
+package interceptors_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/auth"
+	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/authn"
+	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/authz"
+	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/instanceid"
+	logmw "github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/log"
+	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/requestid"
+	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/shutdown"
+	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/userid"
+	"github.com/ahmedalhulaibi/cache-api/internal/tracing"
+)
+
+// testService echoes every request of a stream and logs with the context of the stream.
+type testService struct {
+	testpb.UnimplementedTestServiceServer
+	logger *loggy.Logger
+}
+
+func (s *testService) StreamingOutputCall(req *testpb.StreamingOutputCallRequest, stream testpb.TestService_StreamingOutputCallServer) error {
+	s.logger.Infow(stream.Context(), "streaming")
+	for _, p := range req.GetResponseParameters() {
+		if err := stream.Send(&testpb.StreamingOutputCallResponse{Payload: &testpb.Payload{Body: make([]byte, p.GetSize())}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *testService) FullDuplexCall(stream testpb.TestService_FullDuplexCallServer) error {
+	s.logger.Infow(stream.Context(), "streaming")
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&testpb.StreamingOutputCallResponse{Payload: req.GetPayload()}); err != nil {
+			return err
+		}
+	}
+}
+
+type staticAuthenticator struct{}
+
+func (staticAuthenticator) Authenticate(ctx context.Context, creds auth.Credentials) (*auth.Identity, error) {
+	if creds.APIKey != "secret" {
+		return nil, auth.ErrInvalidCredentials
+	}
+	return &auth.Identity{Subject: "alice", Method: auth.MethodAPIKey}, nil
+}
+
+func TestStreamServerInterceptors(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	logger := loggy.New(zap.New(core).Sugar())
+
+	server := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler(otelgrpc.WithTracerProvider(sdktrace.NewTracerProvider()))),
+		grpc.ChainStreamInterceptor(
+			requestid.RequestIdStreamServerInterceptor(&logger),
+			instanceid.InstanceIdStreamServerInterceptor(&logger, "instance-1"),
+			authn.AuthnStreamServerInterceptor(&logger, staticAuthenticator{}),
+			userid.UserIdStreamServerInterceptor(&logger),
+			tracing.TraceStreamServerInterceptor(&logger),
+			logmw.LoggerStreamServerInterceptor(&logger),
+		),
+	)
+	testpb.RegisterTestServiceServer(server, &testService{logger: &logger})
+
+	lis := bufconn.Listen(1 << 20)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithPerRPCCredentials(auth.APIKeyCredentials("secret")),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	client := testpb.NewTestServiceClient(conn)
+
+	// fields injected by the interceptors are logged by the handler and by the log interceptor
+	requireFields := func(t *testing.T, method, requestID string) {
+		t.Helper()
+		entries := logs.TakeAll()
+		require.Len(t, entries, 3)
+		for _, entry := range entries {
+			fields := entry.ContextMap()
+			require.Equal(t, "instance-1", fields[instanceid.ContextKey])
+			require.Equal(t, "alice", fields[userid.ContextKey])
+			require.NotEmpty(t, fields["trace_id"])
+			if requestID != "" {
+				require.Equal(t, requestID, fields[requestid.ContextKey])
+			} else {
+				require.NotEmpty(t, fields[requestid.ContextKey])
+			}
+		}
+		require.Equal(t, method, entries[0].ContextMap()["method"])
+		require.Equal(t, "streaming", entries[1].Message)
+		require.Contains(t, entries[2].ContextMap(), "duration")
+	}
+
+	t.Run("server streaming", func(t *testing.T) {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), requestid.ContextKey, "req-1")
+		stream, err := client.StreamingOutputCall(ctx, &testpb.StreamingOutputCallRequest{
+			ResponseParameters: []*testpb.ResponseParameters{{Size: 1}, {Size: 2}},
+		})
+		require.NoError(t, err)
+
+		var sizes []int
+		for {
+			resp, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			sizes = append(sizes, len(resp.GetPayload().GetBody()))
+		}
+		require.Equal(t, []int{1, 2}, sizes)
+		requireFields(t, "/grpc.testing.TestService/StreamingOutputCall", "req-1")
+	})
+
+	t.Run("bidirectional streaming", func(t *testing.T) {
+		stream, err := client.FullDuplexCall(context.Background())
+		require.NoError(t, err)
+
+		for _, body := range []string{"a", "b"} {
+			require.NoError(t, stream.Send(&testpb.StreamingOutputCallRequest{Payload: &testpb.Payload{Body: []byte(body)}}))
+			resp, err := stream.Recv()
+			require.NoError(t, err)
+			require.Equal(t, body, string(resp.GetPayload().GetBody()))
+		}
+		require.NoError(t, stream.CloseSend())
+		_, err = stream.Recv()
+		require.Equal(t, io.EOF, err)
+		requireFields(t, "/grpc.testing.TestService/FullDuplexCall", "")
+	})
+}
+
+// watchService streams until the stream is cancelled, as watches and replication do.
+type watchService struct {
+	testpb.UnimplementedTestServiceServer
+}
+
+func (s *watchService) StreamingOutputCall(req *testpb.StreamingOutputCallRequest, stream testpb.TestService_StreamingOutputCallServer) error {
+	if err := stream.Send(&testpb.StreamingOutputCallResponse{}); err != nil {
+		return err
+	}
+	<-stream.Context().Done()
+	return nil
+}
+
+func TestShutdownStreamServerInterceptor(t *testing.T) {
+	logger := loggy.New(zap.NewNop().Sugar())
+	done := make(chan struct{})
+
+	server := grpc.NewServer(grpc.ChainStreamInterceptor(shutdown.ShutdownStreamServerInterceptor(&logger, done)))
+	testpb.RegisterTestServiceServer(server, &watchService{})
+
+	lis := bufconn.Listen(1 << 20)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	stream, err := testpb.NewTestServiceClient(conn).StreamingOutputCall(context.Background(), &testpb.StreamingOutputCallRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.NoError(t, err)
+
+	// the open stream no longer holds up a graceful stop
+	close(done)
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("graceful stop waited for the open stream")
+	}
+
+	_, err = stream.Recv()
+	require.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+// unaryService answers the unary calls of the test service.
+type unaryService struct {
+	testpb.UnimplementedTestServiceServer
+}
+
+func (s *unaryService) EmptyCall(ctx context.Context, req *testpb.Empty) (*testpb.Empty, error) {
+	return &testpb.Empty{}, nil
+}
+
+func (s *unaryService) UnaryCall(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+	return &testpb.SimpleResponse{}, nil
+}
+
+func TestAuthzDeniesUnlistedMethods(t *testing.T) {
+	logger := loggy.New(zap.NewNop().Sugar())
+	path := filepath.Join(t.TempDir(), "acl")
+	require.NoError(t, os.WriteFile(path, []byte("* * admin\n"), 0o600))
+	acl, err := auth.LoadACL(path)
+	require.NoError(t, err)
+	methods := auth.MethodPermissions{"/grpc.testing.TestService/UnaryCall": auth.PermissionRead}
+
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(authz.AuthzUnaryServerInterceptor(&logger, acl, methods)),
+		grpc.ChainStreamInterceptor(authz.AuthzStreamServerInterceptor(&logger, acl, methods)),
+	)
+	testpb.RegisterTestServiceServer(server, &unaryService{})
+	healthpb.RegisterHealthServer(server, health.NewServer())
+
+	lis := bufconn.Listen(1 << 20)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	client := testpb.NewTestServiceClient(conn)
+	ctx := context.Background()
+
+	_, err = client.UnaryCall(ctx, &testpb.SimpleRequest{})
+	require.NoError(t, err)
+
+	// methods of a guarded service without a permission are denied even to admins
+	_, err = client.EmptyCall(ctx, &testpb.Empty{})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	stream, err := client.StreamingOutputCall(ctx, &testpb.StreamingOutputCallRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// services without listed methods are not guarded
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+}
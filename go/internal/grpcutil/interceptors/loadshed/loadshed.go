@@ -0,0 +1,31 @@
+package loadshed
+
+import (
+	"context"
+	"time"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/limit"
+)
+
+// LoadShedUnaryServerInterceptor returns a new unary server interceptor that sheds calls over the adaptive
+// limit on calls in flight with Unavailable and retry-after metadata. Streams are long lived and are not limited.
+func LoadShedUnaryServerInterceptor(logger *loggy.Logger, limiter *limit.AdaptiveLimiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		release, err := limiter.Acquire()
+		if err != nil {
+			logger.Infow(ctx, "load shed", "method", info.FullMethod, "limit", limiter.Limit())
+			_ = grpc.SetHeader(ctx, limit.RetryAfter(limit.RetryDelay(err)))
+			return nil, err
+		}
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		release(time.Since(start), status.Code(err) == codes.DeadlineExceeded || ctx.Err() == context.DeadlineExceeded)
+		return resp, err
+	}
+}
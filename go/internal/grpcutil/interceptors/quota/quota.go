@@ -0,0 +1,35 @@
+package quota
+
+import (
+	"context"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"google.golang.org/grpc"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/auth"
+	"github.com/ahmedalhulaibi/cache-api/internal/cache"
+)
+
+// QuotaUnaryServerInterceptor returns a new unary server interceptor that rejects calls once the caller
+// exceeds its request rate.
+func QuotaUnaryServerInterceptor(logger *loggy.Logger, quotas *cache.Quotas) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := quotas.Allow(auth.Principal(ctx)); err != nil {
+			logger.Infow(ctx, "request rate exceeded", "method", info.FullMethod, "err", err)
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// QuotaStreamServerInterceptor returns a new stream server interceptor that rejects streams once the caller
+// exceeds its request rate.
+func QuotaStreamServerInterceptor(logger *loggy.Logger, quotas *cache.Quotas) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := quotas.Allow(auth.Principal(stream.Context())); err != nil {
+			logger.Infow(stream.Context(), "request rate exceeded", "method", info.FullMethod, "err", err)
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/auth"
+	"github.com/ahmedalhulaibi/cache-api/internal/limit"
+)
+
+// RateLimitUnaryServerInterceptor returns a new unary server interceptor that rejects calls over the
+// rate limits with ResourceExhausted and retry-after metadata.
+func RateLimitUnaryServerInterceptor(logger *loggy.Logger, limiter *limit.RateLimiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := allow(ctx, logger, limiter, info.FullMethod); err != nil {
+			_ = grpc.SetHeader(ctx, limit.RetryAfter(limit.RetryDelay(err)))
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// RateLimitStreamServerInterceptor returns a new stream server interceptor that rejects streams over the
+// rate limits with ResourceExhausted and retry-after metadata.
+func RateLimitStreamServerInterceptor(logger *loggy.Logger, limiter *limit.RateLimiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := allow(stream.Context(), logger, limiter, info.FullMethod); err != nil {
+			_ = stream.SetHeader(limit.RetryAfter(limit.RetryDelay(err)))
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
+
+func allow(ctx context.Context, logger *loggy.Logger, limiter *limit.RateLimiter, method string) error {
+	err := limiter.Allow(method, caller(ctx))
+	if err != nil {
+		logger.Infow(ctx, "rate limited", "method", method, "err", err)
+	}
+	return err
+}
+
+// caller identifies authenticated callers by user id and the others by address, calls through the
+// gateway share the address of the gateway.
+func caller(ctx context.Context) string {
+	if principal := auth.Principal(ctx); principal != "" {
+		return "user:" + principal
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return "addr:" + host
+		}
+		return "addr:" + p.Addr.String()
+	}
+	return ""
+}
@@ -0,0 +1,36 @@
+package ready
+
+import (
+	"context"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/health"
+)
+
+// ReadyUnaryServerInterceptor returns a new unary server interceptor that rejects calls with Unavailable
+// while check fails.
+func ReadyUnaryServerInterceptor(logger *loggy.Logger, check health.Check) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := check(); err != nil {
+			logger.Infow(ctx, "not ready", "method", info.FullMethod, "err", err)
+			return nil, status.Errorf(codes.Unavailable, "not ready: %v", err)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// ReadyStreamServerInterceptor returns a new stream server interceptor that rejects streams with Unavailable
+// while check fails.
+func ReadyStreamServerInterceptor(logger *loggy.Logger, check health.Check) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := check(); err != nil {
+			logger.Infow(stream.Context(), "not ready", "method", info.FullMethod, "err", err)
+			return status.Errorf(codes.Unavailable, "not ready: %v", err)
+		}
+		return handler(srv, stream)
+	}
+}
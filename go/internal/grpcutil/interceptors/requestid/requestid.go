@@ -14,20 +14,41 @@ const ContextKey = "request_id"
 // RequestIdUnaryServerInterceptor returns a new unary server interceptors that injects a request id into the context.
 func RequestIdUnaryServerInterceptor(logger *loggy.Logger) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		var requestId string
+		return handler(withRequestId(ctx, logger), req)
+	}
+}
 
-		if md, ok := metadata.FromIncomingContext(ctx); ok {
-			requestIdMd := md.Get(ContextKey)
+// RequestIdStreamServerInterceptor returns a new stream server interceptor that injects a request id into the
+// stream context.
+func RequestIdStreamServerInterceptor(logger *loggy.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &serverStream{ServerStream: stream, ctx: withRequestId(stream.Context(), logger)})
+	}
+}
 
-			if len(requestIdMd) == 0 {
-				requestId = uuid.NewString()
-			} else {
-				requestId = requestIdMd[0]
-			}
-		}
+func withRequestId(ctx context.Context, logger *loggy.Logger) context.Context {
+	var requestId string
 
-		ctx, _ = logger.With(ctx, ContextKey, requestId)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		requestIdMd := md.Get(ContextKey)
 
-		return handler(ctx, req)
+		if len(requestIdMd) == 0 {
+			requestId = uuid.NewString()
+		} else {
+			requestId = requestIdMd[0]
+		}
 	}
+
+	ctx, _ = logger.With(ctx, ContextKey, requestId)
+	return ctx
+}
+
+// serverStream overrides the context of a stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
 }
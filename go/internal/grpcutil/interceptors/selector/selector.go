@@ -0,0 +1,50 @@
+package selector
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// Match reports whether the interceptors of a selector apply to a method.
+type Match func(fullMethod string) bool
+
+// SelectUnaryServerInterceptor returns a new unary server interceptor that runs interceptors in order for
+// the calls whose method matches, and skips them for the others.
+func SelectUnaryServerInterceptor(match Match, interceptors ...grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !match(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		return chainUnary(interceptors, 0, info, handler)(ctx, req)
+	}
+}
+
+func chainUnary(interceptors []grpc.UnaryServerInterceptor, i int, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) grpc.UnaryHandler {
+	if i == len(interceptors) {
+		return handler
+	}
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		return interceptors[i](ctx, req, info, chainUnary(interceptors, i+1, info, handler))
+	}
+}
+
+// SelectStreamServerInterceptor returns a new stream server interceptor that runs interceptors in order for
+// the streams whose method matches, and skips them for the others.
+func SelectStreamServerInterceptor(match Match, interceptors ...grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !match(info.FullMethod) {
+			return handler(srv, stream)
+		}
+		return chainStream(interceptors, 0, info, handler)(srv, stream)
+	}
+}
+
+func chainStream(interceptors []grpc.StreamServerInterceptor, i int, info *grpc.StreamServerInfo, handler grpc.StreamHandler) grpc.StreamHandler {
+	if i == len(interceptors) {
+		return handler
+	}
+	return func(srv interface{}, stream grpc.ServerStream) error {
+		return interceptors[i](srv, stream, info, chainStream(interceptors, i+1, info, handler))
+	}
+}
@@ -0,0 +1,48 @@
+package shutdown
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ShutdownStreamServerInterceptor returns a new stream server interceptor that cancels the context of
+// every open stream once done is closed, so that long lived streams do not hold up a graceful stop.
+// A stream ended this way fails with Unavailable, so that clients retry it.
+func ShutdownStreamServerInterceptor(logger *loggy.Logger, done <-chan struct{}) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, cancel := context.WithCancel(stream.Context())
+		defer cancel()
+
+		var ended atomic.Bool
+		go func() {
+			select {
+			case <-done:
+				logger.Infow(ctx, "ending stream, server is shutting down", "method", info.FullMethod)
+				ended.Store(true)
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		err := handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+		if ended.Load() && (err == nil || status.Code(err) == codes.Canceled) {
+			return status.Error(codes.Unavailable, "server is shutting down")
+		}
+		return err
+	}
+}
+
+// serverStream overrides the context of a stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
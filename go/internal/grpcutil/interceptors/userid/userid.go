@@ -5,22 +5,41 @@ import (
 
 	"github.com/ahmedalhulaibi/loggy"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/metadata"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/auth"
 )
 
 const ContextKey = "user_id"
 
-// UserIdUnaryServerInterceptor returns a new unary server interceptor that extracts the user id from the context.
+// UserIdUnaryServerInterceptor returns a new unary server interceptor that injects the user id of the
+// authenticated caller into the context. The user_id metadata sent by callers is not trusted.
 func UserIdUnaryServerInterceptor(logger *loggy.Logger) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		if md, ok := metadata.FromIncomingContext(ctx); ok {
-			userIdMd := md.Get(ContextKey)
-
-			if len(userIdMd) != 0 {
-				userId := userIdMd[0]
-				ctx, _ = logger.With(ctx, ContextKey, userId)
-			}
-		}
-		return handler(ctx, req)
+		return handler(withUserId(ctx, logger), req)
+	}
+}
+
+// UserIdStreamServerInterceptor returns a new stream server interceptor that injects the user id of the
+// authenticated caller into the stream context.
+func UserIdStreamServerInterceptor(logger *loggy.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &serverStream{ServerStream: stream, ctx: withUserId(stream.Context(), logger)})
 	}
 }
+
+func withUserId(ctx context.Context, logger *loggy.Logger) context.Context {
+	if id, ok := auth.FromContext(ctx); ok {
+		ctx, _ = logger.With(ctx, ContextKey, id.Subject)
+	}
+	return ctx
+}
+
+// serverStream overrides the context of a stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
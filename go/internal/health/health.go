@@ -0,0 +1,163 @@
+// Package health reports whether an instance is alive and ready to serve traffic, over
+// grpc.health.v1 and HTTP probes.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// ServiceName is the name of the health service, its methods are exempt from authentication and limits.
+const ServiceName = "grpc.health.v1.Health"
+
+// ErrShuttingDown is reported once the instance starts shutting down.
+var ErrShuttingDown = errors.New("shutting down")
+
+// Check returns an error while a component is not ready to serve traffic.
+type Check func() error
+
+// Checker is ready when all of its checks pass and it is not shutting down. It is always alive
+// while the process serves probes.
+type Checker struct {
+	server   *health.Server
+	services []string
+
+	mu           sync.Mutex
+	names        []string
+	checks       map[string]Check
+	shuttingDown bool
+}
+
+// NewChecker returns a checker that reports the status of the server, and of each of services,
+// over grpc.health.v1.
+func NewChecker(services ...string) *Checker {
+	c := &Checker{
+		server:   health.NewServer(),
+		services: services,
+		checks:   map[string]Check{},
+	}
+	c.update()
+	return c
+}
+
+// AddCheck adds a check that keeps the instance not ready while it fails.
+func (c *Checker) AddCheck(name string, check Check) {
+	c.mu.Lock()
+	c.names = append(c.names, name)
+	c.checks[name] = check
+	c.mu.Unlock()
+	c.update()
+}
+
+// Shutdown reports the instance as not ready for good, so that traffic drains before the servers stop.
+func (c *Checker) Shutdown() {
+	c.mu.Lock()
+	c.shuttingDown = true
+	c.mu.Unlock()
+	c.server.Shutdown()
+}
+
+// Failures returns the errors of the checks that fail, keyed by name.
+func (c *Checker) Failures() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	failures := map[string]string{}
+	if c.shuttingDown {
+		failures["shutdown"] = ErrShuttingDown.Error()
+	}
+	for _, name := range c.names {
+		if err := c.checks[name](); err != nil {
+			failures[name] = err.Error()
+		}
+	}
+	return failures
+}
+
+// Ready returns an error listing the failing checks, nil when the instance is ready.
+func (c *Checker) Ready() error {
+	failures := c.Failures()
+	if len(failures) == 0 {
+		return nil
+	}
+
+	var reasons []string
+	for name, reason := range failures {
+		reasons = append(reasons, name+": "+reason)
+	}
+	sort.Strings(reasons)
+	return errors.New("not ready: " + strings.Join(reasons, ", "))
+}
+
+// Server returns the grpc.health.v1 service.
+func (c *Checker) Server() healthpb.HealthServer {
+	return c.server
+}
+
+// update publishes the readiness of the instance to the grpc.health.v1 service, which ignores
+// updates once shut down.
+func (c *Checker) update() {
+	status := healthpb.HealthCheckResponse_SERVING
+	if c.Ready() != nil {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	c.server.SetServingStatus("", status)
+	for _, s := range c.services {
+		c.server.SetServingStatus(s, status)
+	}
+}
+
+// Run publishes the readiness of the instance every interval until ctx is done, so that
+// grpc.health.v1 watchers see checks change.
+func (c *Checker) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			c.update()
+		}
+	}
+}
+
+type probeResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// LivenessHandler answers 200 while the process serves HTTP.
+func (c *Checker) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeProbe(w, http.StatusOK, probeResponse{Status: "ok"})
+	})
+}
+
+// ReadinessHandler answers 200 when the instance is ready and 503 with the failing checks otherwise.
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures := c.Failures(); len(failures) > 0 {
+			writeProbe(w, http.StatusServiceUnavailable, probeResponse{Status: "not ready", Checks: failures})
+			return
+		}
+		writeProbe(w, http.StatusOK, probeResponse{Status: "ready"})
+	})
+}
+
+func writeProbe(w http.ResponseWriter, status int, resp probeResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,61 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestChecker(t *testing.T) {
+	ctx := context.Background()
+
+	var restoring error = errors.New("replaying append-only log")
+	c := NewChecker("cacheapi.v2.CacheService")
+	c.AddCheck("restore", func() error { return restoring })
+
+	status := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := c.Server().Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		return resp.GetStatus()
+	}
+	probe := func(h http.Handler) (int, probeResponse) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		var resp probeResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+		return rec.Code, resp
+	}
+
+	require.EqualError(t, c.Ready(), "not ready: restore: replaying append-only log")
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(""))
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status("cacheapi.v2.CacheService"))
+
+	code, resp := probe(c.ReadinessHandler())
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, map[string]string{"restore": "replaying append-only log"}, resp.Checks)
+
+	code, _ = probe(c.LivenessHandler())
+	require.Equal(t, http.StatusOK, code)
+
+	restoring = nil
+	c.update()
+	require.NoError(t, c.Ready())
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, status("cacheapi.v2.CacheService"))
+
+	code, resp = probe(c.ReadinessHandler())
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "ready", resp.Status)
+
+	c.Shutdown()
+	require.Equal(t, ErrShuttingDown.Error(), c.Failures()["shutdown"])
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(""))
+
+	code, _ = probe(c.LivenessHandler())
+	require.Equal(t, http.StatusOK, code)
+}
@@ -2,32 +2,71 @@ package errors
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/httputil"
 )
 
+// httpError is the JSON envelope of every error response of the gateway.
 type httpError struct {
-	Status  int    `json:"status"`
+	// Status is the HTTP status of the response
+	Status int `json:"status"`
+	// Code is a stable upper snake case code, the name of a GRPC code or a more precise reason
+	Code    string `json:"code"`
 	Message string `json:"message"`
+	// RequestID is the X-Request-ID of the request
+	RequestID string `json:"request_id"`
+	// Details are the google.rpc details of the error, such as google.rpc.BadRequest, never null
+	Details []json.RawMessage `json:"details"`
+}
+
+// New returns an error with the given HTTP status, code and message.
+func New(status int, code, message string) httpError {
+	return httpError{Status: status, Code: code, Message: message}
+}
+
+// WithDetails returns a copy of err with details appended to its details.
+func (err httpError) WithDetails(details ...json.RawMessage) httpError {
+	err.Details = append(append([]json.RawMessage(nil), err.Details...), details...)
+	return err
 }
 
+// WriteError writes err with its status. Its request id defaults to the X-Request-ID response
+// header, set by the request id middleware.
 func WriteError(w http.ResponseWriter, err httpError) error {
-	w.Header().Add("Content-Type", "application/json")
+	if err.RequestID == "" {
+		err.RequestID = w.Header().Get(httputil.XRequestID)
+	}
+	if err.Details == nil {
+		err.Details = []json.RawMessage{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(err.Status)
 	return json.NewEncoder(w).Encode(err)
 }
 
 func NotImplementedError() httpError {
-	return httpError{http.StatusNotImplemented, "Not implemented"}
+	return httpError{Status: http.StatusNotImplemented, Code: "UNIMPLEMENTED", Message: "Not implemented"}
 }
 
 func InternalServerError(msg string) httpError {
-	return httpError{http.StatusInternalServerError, "Internal server error" + msg}
+	return httpError{Status: http.StatusInternalServerError, Code: "INTERNAL", Message: "Internal server error" + msg}
 }
 
 func BadRequest(msg string) httpError {
-	return httpError{http.StatusBadRequest, "Bad request - " + msg}
+	return httpError{Status: http.StatusBadRequest, Code: "INVALID_ARGUMENT", Message: "Bad request - " + msg}
 }
 
 func Unauthorized() httpError {
-	return httpError{http.StatusUnauthorized, "Unauthorized"}
+	return httpError{Status: http.StatusUnauthorized, Code: "UNAUTHENTICATED", Message: "Unauthorized"}
+}
+
+func RequestEntityTooLarge(limit int64) httpError {
+	return httpError{
+		Status:  http.StatusRequestEntityTooLarge,
+		Code:    "REQUEST_TOO_LARGE",
+		Message: fmt.Sprintf("Request body must not be larger than %d bytes", limit),
+	}
 }
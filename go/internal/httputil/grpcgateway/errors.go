@@ -0,0 +1,94 @@
+package httputilgrpcgateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/cache"
+	"github.com/ahmedalhulaibi/cache-api/internal/httputil"
+	httperrors "github.com/ahmedalhulaibi/cache-api/internal/httputil/errors"
+)
+
+// reasonStatus maps the reasons of cache errors to HTTP statuses more precise than those of their
+// GRPC codes.
+var reasonStatus = map[string]int{
+	cache.ReasonReadOnly:      http.StatusConflict,
+	cache.ReasonKeyNotFound:   http.StatusNotFound,
+	cache.ReasonQuotaExceeded: http.StatusTooManyRequests,
+	cache.ReasonValueTooLarge: http.StatusRequestEntityTooLarge,
+}
+
+// ErrorHandler renders the errors of the gateway in the JSON envelope of the httputil errors package.
+// The code of a cache error is the reason of its ErrorInfo detail, other errors have the name of
+// their GRPC code, such as NOT_FOUND.
+func ErrorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	var customStatus *runtime.HTTPStatusError
+	if errors.As(err, &customStatus) {
+		err = customStatus.Err
+	}
+	st := status.Convert(err)
+
+	httpStatus := runtime.HTTPStatusFromCode(st.Code())
+	if customStatus != nil {
+		httpStatus = customStatus.HTTPStatus
+	}
+	httpErr := httperrors.New(httpStatus, code.Code(st.Code()).String(), st.Message())
+	// set by the request id middleware when the caller did not send one
+	httpErr.RequestID = r.Header.Get(httputil.XRequestID)
+
+	for _, detail := range st.Proto().GetDetails() {
+		if m, err := detail.UnmarshalNew(); err == nil {
+			if info, ok := m.(*errdetails.ErrorInfo); ok && info.GetDomain() == cache.ErrorDomain {
+				httpErr.Code = info.GetReason()
+				if s, ok := reasonStatus[info.GetReason()]; ok && customStatus == nil {
+					httpErr.Status = s
+				}
+			}
+		}
+		if b, err := marshaler.Marshal(detail); err == nil {
+			httpErr = httpErr.WithDetails(json.RawMessage(b))
+		}
+	}
+
+	// headers such as Retry-After are forwarded as they are for successful calls
+	if md, ok := runtime.ServerMetadataFromContext(ctx); ok {
+		for k, vs := range md.HeaderMD {
+			if h, ok := OutgoingMatcher(k); ok {
+				for _, v := range vs {
+					w.Header().Add(h, v)
+				}
+			}
+		}
+	}
+	if st.Code() == codes.Unauthenticated {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="cache-api"`)
+	}
+	w.Header().Del("Trailer")
+	w.Header().Del("Transfer-Encoding")
+
+	_ = httperrors.WriteError(w, httpErr)
+}
+
+// RoutingErrorHandler renders routing errors with ErrorHandler, keeping their HTTP status, such as
+// 405 Method Not Allowed, that has no GRPC code.
+func RoutingErrorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, httpStatus int) {
+	c := codes.Internal
+	switch httpStatus {
+	case http.StatusBadRequest:
+		c = codes.InvalidArgument
+	case http.StatusMethodNotAllowed:
+		c = codes.Unimplemented
+	case http.StatusNotFound:
+		c = codes.NotFound
+	}
+	err := &runtime.HTTPStatusError{HTTPStatus: httpStatus, Err: status.Error(c, http.StatusText(httpStatus))}
+	ErrorHandler(ctx, mux, marshaler, w, r, err)
+}
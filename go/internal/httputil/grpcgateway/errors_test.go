@@ -0,0 +1,143 @@
+package httputilgrpcgateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/cache"
+	cacheapiv1 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v1"
+	cacheapiv2 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v2"
+	"github.com/ahmedalhulaibi/cache-api/internal/httputil"
+)
+
+type errorBody struct {
+	Status    int    `json:"status"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id"`
+	Details   []struct {
+		Type   string `json:"@type"`
+		Reason string `json:"reason"`
+	} `json:"details"`
+}
+
+func newTestGateway(t *testing.T, store cache.Store) *httptest.Server {
+	t.Helper()
+	logger := loggy.New(zap.NewNop().Sugar())
+	limits := cache.WithLimits(cache.Limits{MaxKeyLength: 8, MaxValueSize: 4})
+
+	mux := runtime.NewServeMux(runtime.WithErrorHandler(ErrorHandler), runtime.WithRoutingErrorHandler(RoutingErrorHandler))
+	ctx := context.Background()
+	require.NoError(t, cacheapiv1.RegisterCacheServiceHandlerServer(ctx, mux, cache.NewCacheService(&logger, store, limits)))
+	require.NoError(t, cacheapiv2.RegisterCacheServiceHandlerServer(ctx, mux, cache.NewCacheServiceV2(&logger, store, limits)))
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func doRequest(t *testing.T, method, url, body string) (*http.Response, errorBody) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set(httputil.XRequestID, "test-request")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var e errorBody
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&e))
+	return resp, e
+}
+
+func TestErrorHandler(t *testing.T) {
+	server := newTestGateway(t, cache.NewCache())
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		status     int
+		code       string
+		detailType string
+	}{
+		{
+			name:       "invalid argument",
+			method:     http.MethodPost,
+			path:       "/v1/set",
+			body:       `{"bucket":"b","key":"too-long-key"}`,
+			status:     http.StatusBadRequest,
+			code:       "INVALID_ARGUMENT",
+			detailType: "type.googleapis.com/google.rpc.BadRequest",
+		},
+		{
+			name:       "value too large",
+			method:     http.MethodPost,
+			path:       "/v1/set",
+			body:       `{"bucket":"b","key":"k","value":"too large"}`,
+			status:     http.StatusRequestEntityTooLarge,
+			code:       cache.ReasonValueTooLarge,
+			detailType: "type.googleapis.com/google.rpc.BadRequest",
+		},
+		{
+			name:       "key not found",
+			method:     http.MethodGet,
+			path:       "/v2/buckets/b/keys/missing",
+			status:     http.StatusNotFound,
+			code:       cache.ReasonKeyNotFound,
+			detailType: "type.googleapis.com/google.rpc.ErrorInfo",
+		},
+		{
+			name:   "unknown route",
+			method: http.MethodGet,
+			path:   "/v1/unknown",
+			status: http.StatusNotFound,
+			code:   "NOT_FOUND",
+		},
+		{
+			name:   "method not allowed",
+			method: http.MethodDelete,
+			path:   "/v1/set",
+			status: http.StatusMethodNotAllowed,
+			code:   "UNIMPLEMENTED",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, e := doRequest(t, tt.method, server.URL+tt.path, tt.body)
+			require.Equal(t, tt.status, resp.StatusCode)
+			require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+			require.Equal(t, tt.status, e.Status)
+			require.Equal(t, tt.code, e.Code)
+			require.NotEmpty(t, e.Message)
+			require.Equal(t, "test-request", e.RequestID)
+			if tt.detailType == "" {
+				require.Empty(t, e.Details)
+			} else {
+				require.Equal(t, tt.detailType, e.Details[0].Type)
+			}
+		})
+	}
+}
+
+func TestErrorHandlerReadOnly(t *testing.T) {
+	server := newTestGateway(t, cache.ReadOnly(cache.NewCache()))
+
+	resp, e := doRequest(t, http.MethodPost, server.URL+"/v1/set", `{"bucket":"b","key":"k","value":"v"}`)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	require.Equal(t, cache.ReasonReadOnly, e.Code)
+	require.Equal(t, cache.ErrReadOnly.Error(), e.Message)
+	require.Len(t, e.Details, 1)
+	require.Equal(t, cache.ReasonReadOnly, e.Details[0].Reason)
+}
@@ -1,30 +1,59 @@
 package httputilgrpcgateway
 
 import (
+	"context"
+	"net/http"
 	"strings"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
 
+	"github.com/ahmedalhulaibi/cache-api/internal/auth"
 	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/requestid"
-	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/userid"
 	"github.com/ahmedalhulaibi/cache-api/internal/httputil"
-	"github.com/ahmedalhulaibi/cache-api/internal/tracing"
+	"github.com/ahmedalhulaibi/cache-api/internal/limit"
 )
 
 func CustomMatcher(key string) (string, bool) {
 	switch strings.ToLower(key) {
-	case strings.ToLower(httputil.XUserUUID):
-		return userid.ContextKey, true
+	// the client certificate is only forwarded by ClientCertAnnotator
+	case strings.ToLower(runtime.MetadataHeaderPrefix + auth.ClientCertHeader):
+		return "", false
+	case strings.ToLower(httputil.XAPIKey):
+		return auth.APIKeyHeader, true
 	case strings.ToLower(httputil.XRequestID):
 		return requestid.ContextKey, true
-		// Match B3 headers
-	case strings.ToLower(tracing.TraceIDHeader):
-		return tracing.B3TraceID, true
-	case strings.ToLower(tracing.SpanIDHeader):
-		return tracing.B3SpanID, true
-	case strings.ToLower(tracing.SampledHeader):
-		return tracing.B3Sampled, true
 	}
 
 	return runtime.DefaultHeaderMatcher(key)
 }
+
+// OutgoingMatcher maps the retry-after metadata of rejected calls to the Retry-After header.
+func OutgoingMatcher(key string) (string, bool) {
+	if key == limit.RetryAfterHeader {
+		return "Retry-After", true
+	}
+	return runtime.MetadataHeaderPrefix + key, true
+}
+
+// ClientCertAnnotator forwards the client certificate verified by the TLS handshake of a request,
+// so that the GRPC server can verify the caller by it.
+func ClientCertAnnotator(ctx context.Context, r *http.Request) metadata.MD {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return metadata.Pairs(auth.ClientCertHeader, auth.EncodeCertificate(r.TLS.VerifiedChains[0][0]))
+}
+
+// RouteAnnotator names the span of a request, started by the otelhttp handler of the gateway, after
+// the method and path pattern it matched, such as GET /v1/cache/{bucket}/{key}.
+func RouteAnnotator(ctx context.Context, r *http.Request) metadata.MD {
+	if pattern, ok := runtime.HTTPPathPattern(ctx); ok {
+		span := trace.SpanFromContext(ctx)
+		span.SetName(r.Method + " " + pattern)
+		span.SetAttributes(attribute.String("http.route", pattern))
+	}
+	return nil
+}
@@ -3,7 +3,7 @@ package httputil
 import "net/http"
 
 const (
-	XUserUUID  = "X-User-UUID"
+	XAPIKey    = "X-API-Key"
 	XRequestID = "X-Request-ID"
 )
 
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/ahmedalhulaibi/loggy"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/auth"
+	httperrors "github.com/ahmedalhulaibi/cache-api/internal/httputil/errors"
+)
+
+// NewAuthenticator middleware rejects requests whose credentials cannot be verified with 401 Unauthorized
+// and injects the identity of the caller into the request context.
+func NewAuthenticator(logger *loggy.Logger, authenticator auth.Authenticator) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			id, err := authenticator.Authenticate(ctx, auth.CredentialsFromRequest(r))
+			if err == nil && id == nil {
+				err = auth.ErrMissingCredentials
+			}
+			if err != nil {
+				logger.Infow(ctx, "authentication failed", "method", r.Method, "uri", r.RequestURI, "err", err)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="cache-api"`)
+				_ = httperrors.WriteError(w, httperrors.Unauthorized())
+				return
+			}
+
+			h.ServeHTTP(w, r.WithContext(auth.NewContext(ctx, id)))
+		})
+	}
+}
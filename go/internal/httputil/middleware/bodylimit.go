@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+
+	httperrors "github.com/ahmedalhulaibi/cache-api/internal/httputil/errors"
+)
+
+// NewMaxBodySize middleware rejects requests whose body is declared larger than limit bytes with 413
+// Request Entity Too Large, and fails reads past limit bytes of the others. A limit of 0 or less
+// disables it.
+func NewMaxBodySize(limit int64) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		if limit <= 0 {
+			return h
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				_ = httperrors.WriteError(w, httperrors.RequestEntityTooLarge(limit))
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			h.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,11 @@
+package middleware
+
+import "net/http"
+
+// Chain wraps h in middlewares, the first middleware is the outermost and sees requests first.
+func Chain(h http.Handler, middlewares ...func(http.Handler) http.Handler) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
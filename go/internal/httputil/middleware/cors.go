@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig configures the cross-origin requests allowed by the CORS middleware.
+type CORSConfig struct {
+	// AllowedOrigins are the origins allowed to call the API, * allows any origin
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts of allowed origins can read
+	ExposedHeaders []string
+	// AllowCredentials allows cookies and Authorization headers, browsers ignore it for any origin
+	AllowCredentials bool
+	// MaxAge is how long browsers cache the result of a preflight request, 0 to not cache it
+	MaxAge time.Duration
+}
+
+// NewCORS middleware answers the preflight requests of allowed origins and sets the CORS headers of
+// their requests. Requests of other origins are served without CORS headers, so browsers block
+// their responses. No origin is allowed when AllowedOrigins is empty.
+func NewCORS(config CORSConfig) func(http.Handler) http.Handler {
+	anyOrigin := slices.Contains(config.AllowedOrigins, "*")
+	allowedMethods := strings.Join(config.AllowedMethods, ", ")
+	allowedHeaders := strings.Join(config.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(config.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(config.MaxAge.Seconds()))
+
+	allowed := func(origin string) bool {
+		return anyOrigin || slices.Contains(config.AllowedOrigins, origin)
+	}
+
+	return func(h http.Handler) http.Handler {
+		if len(config.AllowedOrigins) == 0 {
+			return h
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			w.Header().Add("Vary", "Origin")
+			if origin == "" || !allowed(origin) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			if anyOrigin {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if config.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if !preflight {
+				if exposedHeaders != "" {
+					w.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
+				}
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+			if allowedHeaders != "" {
+				w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+			}
+			if config.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
@@ -7,10 +7,15 @@ import (
 	"github.com/ahmedalhulaibi/loggy"
 )
 
+// redactedValue replaces the values of redacted headers.
+const redactedValue = "[REDACTED]"
+
 // Logger middleware.
 type Logger struct {
 	h      http.Handler
 	logger *loggy.Logger
+	// redacted are the canonical names of the headers whose values are not logged
+	redacted map[string]bool
 }
 
 // SetLogger sets the logger to `log`. If you have used logger.New(), you can use this to set your
@@ -39,12 +44,30 @@ func (w *wrapper) Write(b []byte) (int, error) {
 	return n, err
 }
 
-// NewLogger logger middleware with the given log.Logger.
-func NewLogger(logger *loggy.Logger) func(http.Handler) http.Handler {
+// flush streamed responses.
+func (w *wrapper) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *wrapper) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// NewLogger logger middleware with the given log.Logger. The values of redactedHeaders, such as
+// Authorization, are replaced by [REDACTED] in the logged headers.
+func NewLogger(logger *loggy.Logger, redactedHeaders ...string) func(http.Handler) http.Handler {
+	redacted := make(map[string]bool, len(redactedHeaders))
+	for _, name := range redactedHeaders {
+		redacted[http.CanonicalHeaderKey(name)] = true
+	}
+
 	return func(h http.Handler) http.Handler {
 		return &Logger{
-			logger: logger,
-			h:      h,
+			logger:   logger,
+			h:        h,
+			redacted: redacted,
 		}
 	}
 }
@@ -65,10 +88,22 @@ func (l *Logger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		"request ended",
 		"method", r.Method,
 		"uri", r.RequestURI,
-		"headers", r.Header,
+		"headers", l.redact(r.Header),
 		"status", res.status,
 		"size", res.written,
 		"duration", time.Since(start),
 		"evt", "request.end",
 	)
 }
+
+// redact returns a copy of header without the values of the redacted headers.
+func (l *Logger) redact(header http.Header) http.Header {
+	logged := make(http.Header, len(header))
+	for name, values := range header {
+		if l.redacted[name] {
+			values = []string{redactedValue}
+		}
+		logged[name] = values
+	}
+	return logged
+}
@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/httputil"
+)
+
+func TestChain(t *testing.T) {
+	var order []string
+	mw := func(name string) func(http.Handler) http.Handler {
+		return func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				h.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { order = append(order, "handler") }), mw("first"), mw("second"))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, []string{"first", "second", "handler"}, order)
+}
+
+func TestRequestIDAndLogger(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	logger := loggy.New(zap.New(core).Sugar())
+
+	var forwarded string
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get(httputil.XRequestID)
+		w.WriteHeader(http.StatusTeapot)
+	}), NewRequestID(&logger), NewLogger(&logger, "authorization"))
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/get", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	require.NotEmpty(t, forwarded)
+	require.Equal(t, forwarded, w.Header().Get(httputil.XRequestID))
+	entries := logs.FilterMessage("request ended").All()
+	require.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	require.Equal(t, forwarded, fields["request_id"])
+	require.Equal(t, int64(http.StatusTeapot), fields["status"])
+	require.Equal(t, []string{redactedValue}, fields["headers"].(http.Header)["Authorization"])
+
+	// the id of the caller is kept
+	r = httptest.NewRequest(http.MethodGet, "/v1/get", nil)
+	r.Header.Set(httputil.XRequestID, "caller-id")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, "caller-id", forwarded)
+	require.Equal(t, "caller-id", w.Header().Get(httputil.XRequestID))
+}
+
+func TestRecoverer(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	logger := loggy.New(zap.New(core).Sugar())
+	h := NewRecoverer(&logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("boom") }))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Equal(t, 1, logs.FilterMessage("handler panicked").Len())
+}
+
+func TestMaxBodySize(t *testing.T) {
+	h := NewMaxBodySize(4)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("1234")))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("12345")))
+	require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// a body of unknown length is cut at the limit
+	r := httptest.NewRequest(http.MethodPost, "/", io.MultiReader(strings.NewReader("12345")))
+	r.ContentLength = -1
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCORS(t *testing.T) {
+	h := NewCORS(CORSConfig{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Content-Type"},
+		ExposedHeaders: []string{"X-Request-ID"},
+		MaxAge:         time.Minute,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodOptions, "/v1/set", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "GET, POST", w.Header().Get("Access-Control-Allow-Methods"))
+	require.Equal(t, "Content-Type", w.Header().Get("Access-Control-Allow-Headers"))
+	require.Equal(t, "60", w.Header().Get("Access-Control-Max-Age"))
+
+	r = httptest.NewRequest(http.MethodGet, "/v1/get", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "X-Request-ID", w.Header().Get("Access-Control-Expose-Headers"))
+
+	r = httptest.NewRequest(http.MethodGet, "/v1/get", nil)
+	r.Header.Set("Origin", "https://evil.example.com")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestGzip(t *testing.T) {
+	large := strings.Repeat("value", 100)
+	h := NewGzip(gzip.DefaultCompression, 64)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, r.URL.Query().Get("body"))
+	}))
+
+	get := func(body string, acceptGzip bool) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/?body="+body, nil)
+		if acceptGzip {
+			r.Header.Set("Accept-Encoding", "br, gzip")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get(large, true)
+	require.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	zr, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	b, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	require.Equal(t, large, string(b))
+
+	w = get("small", true)
+	require.Empty(t, w.Header().Get("Content-Encoding"))
+	require.Equal(t, "small", w.Body.String())
+
+	w = get(large, false)
+	require.Empty(t, w.Header().Get("Content-Encoding"))
+	require.Equal(t, large, w.Body.String())
+}
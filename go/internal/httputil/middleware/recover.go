@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"github.com/ahmedalhulaibi/loggy"
+
+	httperrors "github.com/ahmedalhulaibi/cache-api/internal/httputil/errors"
+)
+
+// NewRecoverer middleware logs the panics of a handler with their stack and responds with 500
+// Internal Server Error instead of dropping the connection.
+func NewRecoverer(logger *loggy.Logger) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				// ErrAbortHandler aborts the response on purpose
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+
+				logger.Errorw(r.Context(), "handler panicked", "method", r.Method, "uri", r.RequestURI, "panic", p, "stack", string(debug.Stack()))
+				_ = httperrors.WriteError(w, httperrors.InternalServerError(""))
+			}()
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"github.com/google/uuid"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/requestid"
+	"github.com/ahmedalhulaibi/cache-api/internal/httputil"
+)
+
+// maxRequestIDLength is the length above which the request id of a caller is replaced.
+const maxRequestIDLength = 128
+
+// NewRequestID middleware keeps the X-Request-ID header of a request, or sets a new one when it is
+// missing or malformed, so that the gateway forwards it to the GRPC server. The id is echoed in
+// the response and logged with every log line of the request.
+func NewRequestID(logger *loggy.Logger) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(httputil.XRequestID)
+			if !validRequestID(id) {
+				id = uuid.NewString()
+				r.Header.Set(httputil.XRequestID, id)
+			}
+			w.Header().Set(httputil.XRequestID, id)
+
+			ctx, _ := logger.With(r.Context(), requestid.ContextKey, id)
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package limit
+
+import (
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// AdaptiveConfig configures an AdaptiveLimiter.
+type AdaptiveConfig struct {
+	InitialLimit, MinLimit, MaxLimit int
+	// LatencyThreshold is the latency above which a request is taken as a sign of overload.
+	LatencyThreshold time.Duration
+	// Backoff is the factor the limit is multiplied by on overload, 0.9 when zero.
+	Backoff float64
+	// RetryAfter is the delay after which shed requests are told to retry.
+	RetryAfter time.Duration
+}
+
+/*
+AdaptiveLimiter sheds requests once too many are in flight. The limit follows additive increase,
+multiplicative decrease: it grows by one every limit requests that complete within the latency
+threshold while at least half of it is in use, and is multiplied by the backoff when a request is
+slower or dropped. Requests that started before the last decrease do not decrease it again, so that
+a single burst of slow requests backs off once.
+*/
+type AdaptiveLimiter struct {
+	config AdaptiveConfig
+
+	mu           sync.Mutex
+	limit        float64
+	inFlight     int
+	lastDecrease time.Time
+}
+
+func NewAdaptiveLimiter(config AdaptiveConfig) *AdaptiveLimiter {
+	if config.Backoff <= 0 || config.Backoff >= 1 {
+		config.Backoff = 0.9
+	}
+	config.MinLimit = max(config.MinLimit, 1)
+	config.MaxLimit = max(config.MaxLimit, config.MinLimit)
+	return &AdaptiveLimiter{
+		config: config,
+		limit:  float64(min(max(config.InitialLimit, config.MinLimit), config.MaxLimit)),
+	}
+}
+
+// Acquire admits a request, or fails with Unavailable when the limit is reached. release must be
+// called once the request completes with its latency and whether it was dropped, such as by a deadline.
+func (l *AdaptiveLimiter) Acquire() (release func(latency time.Duration, dropped bool), err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inFlight >= int(l.limit) {
+		return nil, rejected(codes.Unavailable, l.config.RetryAfter, "server overloaded, %d requests in flight", l.inFlight)
+	}
+	l.inFlight++
+
+	started := time.Now()
+	inFlight := l.inFlight
+	var once sync.Once
+	return func(latency time.Duration, dropped bool) {
+		once.Do(func() { l.release(started, inFlight, latency, dropped) })
+	}, nil
+}
+
+func (l *AdaptiveLimiter) release(started time.Time, inFlight int, latency time.Duration, dropped bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	switch {
+	case dropped || (l.config.LatencyThreshold > 0 && latency > l.config.LatencyThreshold):
+		if started.After(l.lastDecrease) {
+			l.limit = max(l.limit*l.config.Backoff, float64(l.config.MinLimit))
+			l.lastDecrease = time.Now()
+		}
+	case float64(inFlight)*2 >= l.limit:
+		l.limit = min(l.limit+1/l.limit, float64(l.config.MaxLimit))
+	}
+}
+
+// Limit returns the number of requests allowed in flight.
+func (l *AdaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// InFlight returns the number of requests in flight.
+func (l *AdaptiveLimiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
@@ -0,0 +1,44 @@
+// Package limit protects the server from more traffic than it can serve, with token bucket rate
+// limits and an adaptive limit on the requests in flight.
+package limit
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// RetryAfterHeader is the metadata key of the seconds a rejected caller should wait before retrying.
+const RetryAfterHeader = "retry-after"
+
+// RetryAfter returns the metadata telling a caller to wait d before retrying, rounded up to a second.
+func RetryAfter(d time.Duration) metadata.MD {
+	seconds := int64(math.Ceil(max(d, time.Second).Seconds()))
+	return metadata.Pairs(RetryAfterHeader, strconv.FormatInt(seconds, 10))
+}
+
+// rejected returns an error with code c and a RetryInfo detail holding retryAfter.
+func rejected(c codes.Code, retryAfter time.Duration, format string, a ...any) error {
+	st := status.Newf(c, format, a...)
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// RetryDelay returns the delay of the RetryInfo detail of err, zero when it has none.
+func RetryDelay(err error) time.Duration {
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok {
+			return info.GetRetryDelay().AsDuration()
+		}
+	}
+	return 0
+}
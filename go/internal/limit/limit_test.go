@@ -0,0 +1,84 @@
+package limit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRateLimiter(t *testing.T) {
+	r := NewRateLimiter(RateLimits{
+		Methods:   map[string]float64{"Set": 2, "/cacheapi.v1.CacheService/Get": 1},
+		PerCaller: 3,
+	})
+
+	// Set of every service shares a limit
+	require.NoError(t, r.Allow("/cacheapi.v1.CacheService/Set", "a"))
+	require.NoError(t, r.Allow("/cacheapi.v2.CacheService/Set", "a"))
+	err := r.Allow("/cacheapi.v1.CacheService/Set", "b")
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.Contains(t, err.Error(), "method rate limit of 2 per second exceeded")
+	require.Greater(t, RetryDelay(err), time.Duration(0))
+
+	// a rejected call takes nothing from the other limits, a has one request left
+	require.NoError(t, r.Allow("/cacheapi.v1.CacheService/Get", "a"))
+	require.NoError(t, r.Allow("/cacheapi.v2.CacheService/Get", "b"), "full method names only match their service")
+	require.NoError(t, r.Allow("/cacheapi.v2.CacheService/Delete", "b"))
+
+	err = r.Allow("/cacheapi.v1.CacheService/Delete", "a")
+	require.ErrorContains(t, err, "caller rate limit of 3 per second exceeded")
+	require.NoError(t, r.Allow("/cacheapi.v1.CacheService/Delete", "c"))
+}
+
+func TestAdaptiveLimiter(t *testing.T) {
+	l := NewAdaptiveLimiter(AdaptiveConfig{
+		InitialLimit:     4,
+		MinLimit:         2,
+		MaxLimit:         5,
+		LatencyThreshold: 100 * time.Millisecond,
+		Backoff:          0.5,
+		RetryAfter:       2 * time.Second,
+	})
+
+	var releases []func(time.Duration, bool)
+	for range 4 {
+		release, err := l.Acquire()
+		require.NoError(t, err)
+		releases = append(releases, release)
+	}
+	_, err := l.Acquire()
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Equal(t, 2*time.Second, RetryDelay(err))
+
+	// requests that started before a decrease back off once
+	releases[0](time.Second, false)
+	releases[1](0, true)
+	require.Equal(t, 2, l.Limit())
+	require.Equal(t, 2, l.InFlight())
+	releases[2](0, false)
+	releases[3](0, false)
+	releases[3](0, false)
+	require.Equal(t, 0, l.InFlight())
+
+	// the limit grows while it is used and fast
+	for range 20 {
+		releases = releases[:0]
+		for range l.Limit() {
+			release, err := l.Acquire()
+			require.NoError(t, err)
+			releases = append(releases, release)
+		}
+		for _, release := range releases {
+			release(0, false)
+		}
+	}
+	require.Equal(t, 5, l.Limit())
+
+	release, err := l.Acquire()
+	require.NoError(t, err)
+	release(0, true)
+	require.Equal(t, 2, l.Limit(), "the limit never drops below the minimum")
+}
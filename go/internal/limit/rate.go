@@ -0,0 +1,129 @@
+package limit
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+)
+
+// maxCallers is the number of per caller buckets above which the full ones are dropped.
+const maxCallers = 10000
+
+// RateLimits are the requests per second allowed, a zero limit is not enforced. Every limit
+// allows a burst of a second of requests.
+type RateLimits struct {
+	// Global bounds every request to the server.
+	Global float64
+	// Methods bounds the requests to a method, keyed by full method name such as
+	// /cacheapi.v1.CacheService/Set, or by method name such as Set for a limit shared by the method
+	// of every service.
+	Methods map[string]float64
+	// PerCaller bounds the requests of every caller.
+	PerCaller float64
+}
+
+// RateLimiter enforces RateLimits with token buckets.
+type RateLimiter struct {
+	limits RateLimits
+	global *rate.Limiter
+
+	mu      sync.Mutex
+	methods map[string]*rate.Limiter
+	callers map[string]*rate.Limiter
+}
+
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	return &RateLimiter{
+		limits:  limits,
+		global:  newLimiter(limits.Global),
+		methods: map[string]*rate.Limiter{},
+		callers: map[string]*rate.Limiter{},
+	}
+}
+
+// newLimiter returns nil for a zero limit.
+func newLimiter(rps float64) *rate.Limiter {
+	if rps <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(rps), int(math.Max(1, math.Ceil(rps))))
+}
+
+// Allow takes a request to method by caller from every limit that applies to it. A rejected
+// request takes nothing, and fails with ResourceExhausted and the delay after which it would be allowed.
+func (r *RateLimiter) Allow(method, caller string) error {
+	now := time.Now()
+	limiters := []struct {
+		name    string
+		limiter *rate.Limiter
+	}{
+		{"global", r.global},
+		{"method", r.method(method)},
+		{"caller", r.caller(caller, now)},
+	}
+
+	var reservations []*rate.Reservation
+	cancel := func() {
+		for _, res := range reservations {
+			res.CancelAt(now)
+		}
+	}
+	for _, l := range limiters {
+		if l.limiter == nil {
+			continue
+		}
+		res := l.limiter.ReserveN(now, 1)
+		reservations = append(reservations, res)
+		if delay := res.DelayFrom(now); delay > 0 {
+			cancel()
+			return rejected(codes.ResourceExhausted, delay, "%s rate limit of %g per second exceeded", l.name, float64(l.limiter.Limit()))
+		}
+	}
+	return nil
+}
+
+func (r *RateLimiter) method(method string) *rate.Limiter {
+	rps, ok := r.limits.Methods[method]
+	if !ok {
+		method = method[strings.LastIndex(method, "/")+1:]
+		if rps, ok = r.limits.Methods[method]; !ok {
+			return nil
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l, ok := r.methods[method]
+	if !ok {
+		l = newLimiter(rps)
+		r.methods[method] = l
+	}
+	return l
+}
+
+func (r *RateLimiter) caller(caller string, now time.Time) *rate.Limiter {
+	if r.limits.PerCaller <= 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l, ok := r.callers[caller]
+	if !ok {
+		// the buckets of callers that are not limited would be created anew with the same tokens
+		if len(r.callers) >= maxCallers {
+			for c, cl := range r.callers {
+				if cl.TokensAt(now) >= float64(cl.Burst()) {
+					delete(r.callers, c)
+				}
+			}
+		}
+		l = newLimiter(r.limits.PerCaller)
+		r.callers[caller] = l
+	}
+	return l
+}
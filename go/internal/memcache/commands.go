@@ -0,0 +1,458 @@
+package memcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/cache"
+)
+
+// connError is a failure reading from the connection, the connection is closed after it is reported.
+type connError struct {
+	err error
+}
+
+func (e connError) Error() string {
+	return e.err.Error()
+}
+
+func (e connError) Unwrap() error {
+	return e.err
+}
+
+type handler func(s *Server, c *client, args []string) error
+
+var commands map[string]handler
+
+func init() {
+	commands = map[string]handler{
+		"get":       getCommand(false),
+		"gets":      getCommand(true),
+		"set":       storeCommand(modeSet),
+		"add":       storeCommand(modeAdd),
+		"replace":   storeCommand(modeReplace),
+		"append":    storeCommand(modeAppend),
+		"prepend":   storeCommand(modePrepend),
+		"cas":       storeCommand(modeCAS),
+		"delete":    cmdDelete,
+		"incr":      arithmeticCommand(true),
+		"decr":      arithmeticCommand(false),
+		"touch":     cmdTouch,
+		"flush_all": cmdFlushAll,
+		"stats":     cmdStats,
+		"version":   cmdVersion,
+		"verbosity": cmdVerbosity,
+		"quit":      cmdQuit,
+		"mg":        cmdMetaGet,
+		"ms":        cmdMetaSet,
+		"md":        cmdMetaDelete,
+		"mn":        cmdMetaNoop,
+	}
+}
+
+// execute runs a command line, only errors that leave the connection unusable are returned.
+func (s *Server) execute(c *client, line string) error {
+	fields := strings.Fields(line)
+	c.noreply = false
+	if len(fields) == 0 {
+		c.reply("ERROR")
+		return nil
+	}
+
+	cmd, ok := commands[fields[0]]
+	if !ok {
+		c.reply("ERROR")
+		return nil
+	}
+
+	err := cmd(s, c, fields[1:])
+	if err == nil {
+		return nil
+	}
+
+	// errors are always replied, even to noreply commands
+	c.noreply = false
+	var ce clientError
+	var connErr connError
+	switch {
+	case errors.As(err, &connErr):
+		if errors.Is(err, errBadChunk) {
+			c.reply("CLIENT_ERROR %s", errBadChunk)
+		}
+		return err
+	case errors.As(err, &ce):
+		c.reply("CLIENT_ERROR %s", ce)
+	case errors.Is(err, cache.ErrReadOnly):
+		c.reply("SERVER_ERROR read only replica")
+	default:
+		c.reply("SERVER_ERROR %s", err)
+	}
+	return nil
+}
+
+// stripNoreply strips a trailing noreply argument and marks the command as not expecting a reply.
+func (c *client) stripNoreply(args []string) []string {
+	if len(args) > 0 && args[len(args)-1] == "noreply" {
+		c.noreply = true
+		return args[:len(args)-1]
+	}
+	return args
+}
+
+// getCommand implements get and gets <key>*, gets also returns the CAS of every item.
+func getCommand(withCAS bool) handler {
+	return func(s *Server, c *client, args []string) error {
+		if len(args) == 0 {
+			return errBadFormat
+		}
+		for _, key := range args {
+			if !validKey(key) {
+				return errBadFormat
+			}
+		}
+
+		for _, key := range args {
+			s.stats.cmdGet.Add(1)
+			e, err := s.store.GetEntry(context.Background(), s.bucket, key)
+			if err != nil {
+				return err
+			}
+			if e == nil {
+				s.stats.getMisses.Add(1)
+				continue
+			}
+			s.stats.getHits.Add(1)
+
+			if withCAS {
+				fmt.Fprintf(c.w, "VALUE %s %d %d %d\r\n", key, e.Flags, len(e.Value), e.CAS)
+			} else {
+				fmt.Fprintf(c.w, "VALUE %s %d %d\r\n", key, e.Flags, len(e.Value))
+			}
+			c.value(e.Value)
+		}
+		c.reply("END")
+		return nil
+	}
+}
+
+type storeMode int
+
+const (
+	modeSet storeMode = iota
+	modeAdd
+	modeReplace
+	modeAppend
+	modePrepend
+	modeCAS
+)
+
+type result int
+
+const (
+	success result = iota
+	notStored
+	exists
+	notFound
+)
+
+// write stores value according to mode. A non-zero cas only stores when it matches the current CAS.
+// Appending and prepending keep the flags and expiry of the current item.
+func (s *Server) write(key string, mode storeMode, value []byte, flags uint32, expiry time.Time, cas uint64) (result, error) {
+	s.stats.cmdSet.Add(1)
+
+	res := success
+	err := s.store.Update(context.Background(), s.bucket, key, func(current *cache.Entry) (*cache.Entry, error) {
+		switch {
+		case current == nil && cas != 0:
+			res = notFound
+		case current == nil && (mode == modeReplace || mode == modeAppend || mode == modePrepend):
+			res = notStored
+		case current != nil && cas != 0 && current.CAS != cas:
+			res = exists
+		case current != nil && mode == modeAdd:
+			res = notStored
+		}
+		if res != success {
+			return nil, nil
+		}
+
+		switch mode {
+		case modeAppend:
+			next := *current
+			next.Value = append(append([]byte(nil), current.Value...), value...)
+			next.CAS = 0
+			return &next, nil
+		case modePrepend:
+			next := *current
+			next.Value = append(append([]byte(nil), value...), current.Value...)
+			next.CAS = 0
+			return &next, nil
+		default:
+			return &cache.Entry{Value: value, Flags: flags, Expiry: expiry}, nil
+		}
+	})
+	return res, err
+}
+
+// storeCommand implements <command> <key> <flags> <exptime> <bytes> [<cas unique>] [noreply].
+func storeCommand(mode storeMode) handler {
+	argc := 4
+	if mode == modeCAS {
+		argc = 5
+	}
+
+	return func(s *Server, c *client, args []string) error {
+		args = c.stripNoreply(args)
+		if len(args) < 4 {
+			return errBadFormat
+		}
+		size, err := parseLength(args[3])
+		if err != nil {
+			return err
+		}
+		if size > maxItemSize {
+			if err := c.discard(size); err != nil {
+				return connError{err}
+			}
+			c.noreply = false
+			c.reply("SERVER_ERROR object too large for cache")
+			return nil
+		}
+
+		data, err := c.readData(size)
+		if err != nil {
+			return connError{err}
+		}
+
+		if len(args) != argc || !validKey(args[0]) {
+			return errBadFormat
+		}
+		flags, err := parseUint32(args[1])
+		if err != nil {
+			return err
+		}
+		expiry, err := parseExpiry(args[2], time.Now())
+		if err != nil {
+			return err
+		}
+		var cas uint64
+		if mode == modeCAS {
+			if cas, err = parseUint64(args[4]); err != nil {
+				return err
+			}
+		}
+
+		res, err := s.write(args[0], mode, data, flags, expiry, cas)
+		if err != nil {
+			return err
+		}
+
+		switch res {
+		case success:
+			c.reply("STORED")
+		case notStored:
+			c.reply("NOT_STORED")
+		case exists:
+			c.reply("EXISTS")
+		case notFound:
+			c.reply("NOT_FOUND")
+		}
+		return nil
+	}
+}
+
+// delete removes key when it exists and, with a non-zero cas, still has that CAS.
+func (s *Server) delete(key string, cas uint64) (result, error) {
+	res := success
+	_, err := s.store.DeleteIf(context.Background(), s.bucket, key, func(current *cache.Entry) bool {
+		switch {
+		case current == nil:
+			res = notFound
+		case cas != 0 && current.CAS != cas:
+			res = exists
+		}
+		return res == success
+	})
+	return res, err
+}
+
+// cmdDelete implements delete <key> [0] [noreply], the legacy time argument must be 0.
+func cmdDelete(s *Server, c *client, args []string) error {
+	args = c.stripNoreply(args)
+	if len(args) == 2 && args[1] == "0" {
+		args = args[:1]
+	}
+	if len(args) != 1 || !validKey(args[0]) {
+		return errBadFormat
+	}
+
+	res, err := s.delete(args[0], 0)
+	if err != nil {
+		return err
+	}
+	if res == notFound {
+		c.reply("NOT_FOUND")
+		return nil
+	}
+	c.reply("DELETED")
+	return nil
+}
+
+// arithmeticCommand implements incr and decr <key> <value> [noreply]. Incrementing wraps around at
+// 64 bits and decrementing stops at 0, as in memcached.
+func arithmeticCommand(incr bool) handler {
+	return func(s *Server, c *client, args []string) error {
+		args = c.stripNoreply(args)
+		if len(args) != 2 || !validKey(args[0]) {
+			return errBadFormat
+		}
+		delta, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return errBadDelta
+		}
+
+		var result uint64
+		var found bool
+		err = s.store.Update(context.Background(), s.bucket, args[0], func(current *cache.Entry) (*cache.Entry, error) {
+			if current == nil {
+				return nil, nil
+			}
+			found = true
+
+			n, err := strconv.ParseUint(string(current.Value), 10, 64)
+			if err != nil {
+				return nil, errNonNumeric
+			}
+			switch {
+			case incr:
+				result = n + delta
+			case delta > n:
+				result = 0
+			default:
+				result = n - delta
+			}
+			return &cache.Entry{Value: strconv.AppendUint(nil, result, 10), Flags: current.Flags, Expiry: current.Expiry}, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			c.reply("NOT_FOUND")
+			return nil
+		}
+		c.reply("%d", result)
+		return nil
+	}
+}
+
+// touch changes the expiry of key and reports whether it exists, the item keeps its CAS.
+func (s *Server) touch(key string, expiry time.Time) (*cache.Entry, error) {
+	s.stats.cmdTouch.Add(1)
+
+	var touched *cache.Entry
+	err := s.store.Update(context.Background(), s.bucket, key, func(current *cache.Entry) (*cache.Entry, error) {
+		if current == nil {
+			return nil, nil
+		}
+		next := *current
+		next.Expiry = expiry
+		touched = &next
+		return touched, nil
+	})
+	return touched, err
+}
+
+func cmdTouch(s *Server, c *client, args []string) error {
+	args = c.stripNoreply(args)
+	if len(args) != 2 || !validKey(args[0]) {
+		return errBadFormat
+	}
+	expiry, err := parseExpiry(args[1], time.Now())
+	if err != nil {
+		return err
+	}
+
+	e, err := s.touch(args[0], expiry)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		c.reply("NOT_FOUND")
+		return nil
+	}
+	c.reply("TOUCHED")
+	return nil
+}
+
+// cmdFlushAll removes every item of the bucket, delayed flushes are not supported.
+func cmdFlushAll(s *Server, c *client, args []string) error {
+	args = c.stripNoreply(args)
+	if len(args) > 1 {
+		return errBadFormat
+	}
+	if len(args) == 1 && args[0] != "0" {
+		return clientError("flush_all delay is not supported")
+	}
+
+	if err := s.store.Flush(context.Background(), s.bucket); err != nil {
+		return err
+	}
+	c.reply("OK")
+	return nil
+}
+
+func cmdStats(s *Server, c *client, args []string) error {
+	if len(args) > 0 {
+		c.reply("ERROR")
+		return nil
+	}
+
+	st := s.store.Stats()
+	now := time.Now()
+	for _, stat := range []struct {
+		name  string
+		value any
+	}{
+		{"pid", os.Getpid()},
+		{"uptime", int64(now.Sub(s.started).Seconds())},
+		{"time", now.Unix()},
+		{"version", version},
+		{"curr_connections", s.currentConnections()},
+		{"total_connections", s.stats.totalConnections.Load()},
+		{"cmd_get", s.stats.cmdGet.Load()},
+		{"cmd_set", s.stats.cmdSet.Load()},
+		{"cmd_touch", s.stats.cmdTouch.Load()},
+		{"get_hits", s.stats.getHits.Load()},
+		{"get_misses", s.stats.getMisses.Load()},
+		{"evictions", st.Evictions},
+		{"expired", st.Expired},
+	} {
+		fmt.Fprintf(c.w, "STAT %s %v\r\n", stat.name, stat.value)
+	}
+	c.reply("END")
+	return nil
+}
+
+const version = "1.6.0"
+
+func cmdVersion(s *Server, c *client, args []string) error {
+	c.reply("VERSION %s", version)
+	return nil
+}
+
+func cmdVerbosity(s *Server, c *client, args []string) error {
+	c.stripNoreply(args)
+	c.reply("OK")
+	return nil
+}
+
+func cmdQuit(s *Server, c *client, args []string) error {
+	c.quit = true
+	return nil
+}
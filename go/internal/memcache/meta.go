@@ -0,0 +1,262 @@
+package memcache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/cache"
+)
+
+// metaFlags are the single character flags of a meta command, each optionally followed by a token.
+type metaFlags struct {
+	flags []string
+	quiet bool
+}
+
+func parseMetaFlags(args []string, allowed string) (*metaFlags, error) {
+	m := &metaFlags{flags: args}
+	for _, f := range args {
+		if !strings.ContainsRune(allowed, rune(f[0])) {
+			return nil, errInvalidFlag
+		}
+		if f[0] == 'q' {
+			m.quiet = true
+		}
+	}
+	return m, nil
+}
+
+// token returns the token of flag f and whether the flag is present.
+func (m *metaFlags) token(f byte) (string, bool) {
+	for _, flag := range m.flags {
+		if flag[0] == f {
+			return flag[1:], true
+		}
+	}
+	return "", false
+}
+
+// echo returns the opaque and key flags, which are returned as they were sent.
+func (m *metaFlags) echo(key string) []string {
+	var ret []string
+	for _, f := range m.flags {
+		switch f[0] {
+		case 'O':
+			ret = append(ret, f)
+		case 'k':
+			ret = append(ret, "k"+key)
+		}
+	}
+	return ret
+}
+
+func (c *client) meta(code string, ret []string) {
+	if len(ret) == 0 {
+		c.reply("%s", code)
+		return
+	}
+	c.reply("%s %s", code, strings.Join(ret, " "))
+}
+
+// cmdMetaGet implements mg <key> <flags>*.
+func cmdMetaGet(s *Server, c *client, args []string) error {
+	if len(args) == 0 || !validKey(args[0]) {
+		return errBadFormat
+	}
+	key := args[0]
+	m, err := parseMetaFlags(args[1:], "vfctskOqT")
+	if err != nil {
+		return err
+	}
+
+	var e *cache.Entry
+	if ttl, ok := m.token('T'); ok {
+		expiry, err := parseExpiry(ttl, time.Now())
+		if err != nil {
+			return err
+		}
+		e, err = s.touch(key, expiry)
+		if err != nil {
+			return err
+		}
+	} else if e, err = s.store.GetEntry(context.Background(), s.bucket, key); err != nil {
+		return err
+	}
+	s.stats.cmdGet.Add(1)
+
+	if e == nil {
+		s.stats.getMisses.Add(1)
+		if !m.quiet {
+			c.meta("EN", nil)
+		}
+		return nil
+	}
+	s.stats.getHits.Add(1)
+
+	var ret []string
+	var withValue bool
+	for _, f := range m.flags {
+		switch f[0] {
+		case 'v':
+			withValue = true
+		case 'f':
+			ret = append(ret, "f"+strconv.FormatUint(uint64(e.Flags), 10))
+		case 'c':
+			ret = append(ret, "c"+strconv.FormatUint(e.CAS, 10))
+		case 't':
+			ret = append(ret, "t"+strconv.FormatInt(remaining(e.Expiry), 10))
+		case 's':
+			ret = append(ret, "s"+strconv.Itoa(len(e.Value)))
+		case 'O':
+			ret = append(ret, f)
+		case 'k':
+			ret = append(ret, "k"+key)
+		}
+	}
+
+	if !withValue {
+		c.meta("HD", ret)
+		return nil
+	}
+	c.meta("VA "+strconv.Itoa(len(e.Value)), ret)
+	c.value(e.Value)
+	return nil
+}
+
+// cmdMetaSet implements ms <key> <datalen> <flags>*.
+func cmdMetaSet(s *Server, c *client, args []string) error {
+	if len(args) < 2 {
+		return errBadFormat
+	}
+	size, err := parseLength(args[1])
+	if err != nil {
+		return err
+	}
+	if size > maxItemSize {
+		if err := c.discard(size); err != nil {
+			return connError{err}
+		}
+		c.reply("SERVER_ERROR object too large for cache")
+		return nil
+	}
+
+	data, err := c.readData(size)
+	if err != nil {
+		return connError{err}
+	}
+
+	key := args[0]
+	if !validKey(key) {
+		return errBadFormat
+	}
+	m, err := parseMetaFlags(args[2:], "FTCMqOk")
+	if err != nil {
+		return err
+	}
+
+	var flags uint32
+	if f, ok := m.token('F'); ok {
+		if flags, err = parseUint32(f); err != nil {
+			return err
+		}
+	}
+	var expiry time.Time
+	if ttl, ok := m.token('T'); ok {
+		if expiry, err = parseExpiry(ttl, time.Now()); err != nil {
+			return err
+		}
+	}
+	var cas uint64
+	if token, ok := m.token('C'); ok {
+		if cas, err = parseUint64(token); err != nil {
+			return err
+		}
+	}
+	mode := modeSet
+	if token, ok := m.token('M'); ok {
+		if mode, err = parseMode(token); err != nil {
+			return err
+		}
+	}
+
+	res, err := s.write(key, mode, data, flags, expiry, cas)
+	if err != nil {
+		return err
+	}
+
+	switch res {
+	case success:
+		if !m.quiet {
+			c.meta("HD", m.echo(key))
+		}
+	case notStored:
+		c.meta("NS", m.echo(key))
+	case exists:
+		c.meta("EX", m.echo(key))
+	case notFound:
+		c.meta("NF", m.echo(key))
+	}
+	return nil
+}
+
+func parseMode(token string) (storeMode, error) {
+	switch strings.ToUpper(token) {
+	case "S":
+		return modeSet, nil
+	case "E":
+		return modeAdd, nil
+	case "R":
+		return modeReplace, nil
+	case "A":
+		return modeAppend, nil
+	case "P":
+		return modePrepend, nil
+	default:
+		return 0, errInvalidFlag
+	}
+}
+
+// cmdMetaDelete implements md <key> <flags>*.
+func cmdMetaDelete(s *Server, c *client, args []string) error {
+	if len(args) == 0 || !validKey(args[0]) {
+		return errBadFormat
+	}
+	key := args[0]
+	m, err := parseMetaFlags(args[1:], "CqOk")
+	if err != nil {
+		return err
+	}
+
+	var cas uint64
+	if token, ok := m.token('C'); ok {
+		if cas, err = parseUint64(token); err != nil {
+			return err
+		}
+	}
+
+	res, err := s.delete(key, cas)
+	if err != nil {
+		return err
+	}
+
+	switch res {
+	case success:
+		if !m.quiet {
+			c.meta("HD", m.echo(key))
+		}
+	case notFound:
+		if !m.quiet {
+			c.meta("NF", m.echo(key))
+		}
+	case exists:
+		c.meta("EX", m.echo(key))
+	}
+	return nil
+}
+
+func cmdMetaNoop(s *Server, c *client, args []string) error {
+	c.meta("MN", nil)
+	return nil
+}
@@ -0,0 +1,157 @@
+package memcache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	maxKeyLen   = 250
+	maxItemSize = 1024 * 1024
+	// relativeExpiryLimit is the largest expiry, in seconds, that is relative to now, larger ones are unix timestamps
+	relativeExpiryLimit = 60 * 60 * 24 * 30
+)
+
+var (
+	errLineTooLong = errors.New("line too long")
+	errBadChunk    = errors.New("bad data chunk")
+)
+
+// clientError is replied to the client as a CLIENT_ERROR without closing the connection.
+type clientError string
+
+func (e clientError) Error() string {
+	return string(e)
+}
+
+const (
+	errBadFormat   = clientError("bad command line format")
+	errInvalidFlag = clientError("invalid flag")
+	errNonNumeric  = clientError("cannot increment or decrement non-numeric value")
+	errBadDelta    = clientError("invalid numeric delta argument")
+)
+
+type client struct {
+	r *bufio.Reader
+	w *bufio.Writer
+	// noreply suppresses the reply of the current command
+	noreply bool
+	quit    bool
+}
+
+func (c *client) readLine() (string, error) {
+	line, err := c.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", errLineTooLong
+	}
+	if err != nil {
+		return "", err
+	}
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return string(line), nil
+}
+
+// readData reads a data block of n bytes followed by \r\n.
+func (c *client) readData(n int) ([]byte, error) {
+	buf := make([]byte, n+2)
+	if _, err := io.ReadFull(c.r, buf); err != nil {
+		return nil, err
+	}
+	if buf[n] != '\r' || buf[n+1] != '\n' {
+		return nil, errBadChunk
+	}
+	return buf[:n], nil
+}
+
+// discard skips a data block that is not stored.
+func (c *client) discard(n int) error {
+	_, err := c.r.Discard(n + 2)
+	return err
+}
+
+func (c *client) reply(format string, args ...any) {
+	if c.noreply {
+		return
+	}
+	fmt.Fprintf(c.w, format, args...)
+	c.w.WriteString("\r\n")
+}
+
+func (c *client) value(data []byte) {
+	c.w.Write(data)
+	c.w.WriteString("\r\n")
+}
+
+func validKey(key string) bool {
+	if len(key) == 0 || len(key) > maxKeyLen {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func parseUint32(s string) (uint32, error) {
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, errBadFormat
+	}
+	return uint32(n), nil
+}
+
+func parseUint64(s string) (uint64, error) {
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, errBadFormat
+	}
+	return n, nil
+}
+
+func parseLength(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, errBadFormat
+	}
+	return n, nil
+}
+
+// parseExpiry converts a memcached expiration time to an absolute expiry, the zero time means no expiry.
+// A negative expiration time, or a unix timestamp in the past, expires the item immediately.
+func parseExpiry(s string, now time.Time) (time.Time, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, errBadFormat
+	}
+
+	switch {
+	case n == 0:
+		return time.Time{}, nil
+	case n < 0:
+		return now, nil
+	case n > relativeExpiryLimit:
+		if t := time.Unix(n, 0); t.After(now) {
+			return t, nil
+		}
+		return now, nil
+	default:
+		return now.Add(time.Duration(n) * time.Second), nil
+	}
+}
+
+// remaining returns the seconds until expiry, or -1 for no expiry.
+func remaining(expiry time.Time) int64 {
+	if expiry.IsZero() {
+		return -1
+	}
+	return int64((max(time.Until(expiry), 0) + time.Second/2) / time.Second)
+}
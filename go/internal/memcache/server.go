@@ -0,0 +1,170 @@
+package memcache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ahmedalhulaibi/loggy"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/cache"
+)
+
+var ErrServerClosed = errors.New("memcache: server closed")
+
+// Server speaks the memcached text and meta protocols on top of a single bucket of a cache store.
+type Server struct {
+	logger  *loggy.Logger
+	store   cache.Store
+	bucket  string
+	started time.Time
+	stats   serverStats
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// serverStats are the counters reported by the stats command that the store does not track.
+type serverStats struct {
+	totalConnections atomic.Uint64
+	cmdGet           atomic.Uint64
+	cmdSet           atomic.Uint64
+	cmdTouch         atomic.Uint64
+	getHits          atomic.Uint64
+	getMisses        atomic.Uint64
+}
+
+func NewServer(logger *loggy.Logger, store cache.Store, bucket string) *Server {
+	return &Server{
+		logger:  logger,
+		store:   store,
+		bucket:  bucket,
+		started: time.Now(),
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts connections on l until Shutdown is called, it always returns a non-nil error.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		// a connection accepted while shutting down would be missed by Shutdown
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		s.stats.totalConnections.Add(1)
+
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Shutdown stops accepting connections, closes open connections and waits for their handlers
+// to finish or ctx to be done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Server) currentConnections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	ctx := context.Background()
+	c := &client{
+		r: bufio.NewReader(conn),
+		w: bufio.NewWriter(conn),
+	}
+
+	for !c.quit {
+		line, err := c.readLine()
+		if err != nil {
+			if errors.Is(err, errLineTooLong) {
+				c.w.WriteString("CLIENT_ERROR line too long\r\n")
+				c.w.Flush()
+			} else if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.logger.Debugw(ctx, "memcache connection error", "remote_addr", conn.RemoteAddr().String(), "err", err)
+			}
+			return
+		}
+
+		if err := s.execute(c, line); err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.logger.Debugw(ctx, "memcache connection error", "remote_addr", conn.RemoteAddr().String(), "err", err)
+			}
+			c.w.Flush()
+			return
+		}
+
+		// replies to pipelined commands are flushed together once the client stops sending
+		if c.r.Buffered() == 0 {
+			if err := c.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+	c.w.Flush()
+}
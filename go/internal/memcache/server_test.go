@@ -0,0 +1,283 @@
+package memcache
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/cache"
+)
+
+func newTestLogger() *loggy.Logger {
+	l := loggy.New(zap.NewNop().Sugar())
+	return &l
+}
+
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func startServer(t *testing.T, store cache.Store) *testClient {
+	t.Helper()
+	srv := NewServer(newTestLogger(), store, "default")
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.Serve(lis)
+	t.Cleanup(func() {
+		require.NoError(t, srv.Shutdown(context.Background()))
+	})
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	require.NoError(t, err)
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+	return &testClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *testClient) send(lines ...string) {
+	c.t.Helper()
+	_, err := c.conn.Write([]byte(strings.Join(lines, "\r\n") + "\r\n"))
+	require.NoError(c.t, err)
+}
+
+// read reads n reply lines and joins them with "|".
+func (c *testClient) read(n int) string {
+	c.t.Helper()
+	lines := make([]string, n)
+	for i := range lines {
+		line, err := c.r.ReadString('\n')
+		require.NoError(c.t, err)
+		lines[i] = strings.TrimSuffix(line, "\r\n")
+	}
+	return strings.Join(lines, "|")
+}
+
+func (c *testClient) do(n int, lines ...string) string {
+	c.t.Helper()
+	c.send(lines...)
+	return c.read(n)
+}
+
+func TestStorageCommands(t *testing.T) {
+	store := cache.NewCache()
+	c := startServer(t, store)
+
+	require.Equal(t, "END", c.do(1, "get k"))
+	require.Equal(t, "STORED", c.do(1, "set k 42 0 5", "hello"))
+	require.Equal(t, "VALUE k 42 5|hello|END", c.do(3, "get k"))
+	require.Equal(t, "VALUE k 42 5|hello|VALUE k 42 5|hello|END", c.do(5, "get k missing k"))
+
+	require.Equal(t, "NOT_STORED", c.do(1, "add k 0 0 1", "x"))
+	require.Equal(t, "NOT_STORED", c.do(1, "replace missing 0 0 1", "x"))
+	require.Equal(t, "STORED", c.do(1, "replace k 7 0 5", "world"))
+	require.Equal(t, "STORED", c.do(1, "append k 0 0 1", "!"))
+	require.Equal(t, "STORED", c.do(1, "prepend k 0 0 1", ">"))
+	require.Equal(t, "VALUE k 7 7|>world!|END", c.do(3, "get k"))
+
+	e, err := store.Lookup(context.Background(), "default", "k")
+	require.NoError(t, err)
+	require.Equal(t, uint32(7), e.Flags)
+
+	require.Equal(t, "DELETED", c.do(1, "delete k"))
+	require.Equal(t, "NOT_FOUND", c.do(1, "delete k"))
+
+	c.send("set quiet 0 0 1 noreply", "q", "get quiet")
+	require.Equal(t, "VALUE quiet 0 1|q|END", c.read(3))
+
+	require.Equal(t, "CLIENT_ERROR bad data chunk", c.do(1, "set k 0 0 1", "toolong"))
+}
+
+func TestCAS(t *testing.T) {
+	store := cache.NewCache()
+	c := startServer(t, store)
+
+	require.Equal(t, "NOT_FOUND", c.do(1, "cas k 0 0 1 1", "x"))
+	require.Equal(t, "STORED", c.do(1, "set k 0 0 1", "a"))
+
+	e, err := store.Lookup(context.Background(), "default", "k")
+	require.NoError(t, err)
+	cas := e.CAS
+	require.Contains(t, c.do(3, "gets k"), "VALUE k 0 1 ")
+
+	require.Equal(t, "EXISTS", c.do(1, "cas k 0 0 1 999", "b"))
+	require.Equal(t, "STORED", c.do(1, "cas k 0 0 1 "+strconv.FormatUint(cas, 10), "b"))
+	require.Equal(t, "EXISTS", c.do(1, "cas k 0 0 1 "+strconv.FormatUint(cas, 10), "c"))
+	require.Equal(t, "VALUE k 0 1|b|END", c.do(3, "get k"))
+}
+
+func TestGetUpdatesStore(t *testing.T) {
+	store := cache.NewCacheWithCapacity(2)
+	c := startServer(t, store)
+
+	require.Equal(t, "STORED", c.do(1, "set a 0 0 1", "a"))
+	require.Equal(t, "STORED", c.do(1, "set b 0 0 1", "b"))
+
+	// reads count as hits and misses of the store and make the keys recently used
+	require.Equal(t, "VALUE a 0 1|a|END", c.do(3, "get a"))
+	require.Equal(t, "VA 1|a", c.do(2, "mg a v"))
+	require.Equal(t, "END", c.do(1, "gets missing"))
+	require.Equal(t, uint64(2), store.Stats().Hits)
+	require.Equal(t, uint64(1), store.Stats().Misses)
+
+	require.Equal(t, "STORED", c.do(1, "set c 0 0 1", "c"))
+	require.Equal(t, "VALUE a 0 1|a|END", c.do(3, "get a"))
+	require.Equal(t, "END", c.do(1, "get b"))
+}
+
+func TestArithmeticAndTouch(t *testing.T) {
+	c := startServer(t, cache.NewCache())
+
+	require.Equal(t, "NOT_FOUND", c.do(1, "incr n 1"))
+	require.Equal(t, "STORED", c.do(1, "set n 3 0 2", "10"))
+	require.Equal(t, "15", c.do(1, "incr n 5"))
+	require.Equal(t, "0", c.do(1, "decr n 100"))
+	require.Equal(t, "STORED", c.do(1, "set n 3 0 20", "18446744073709551615"))
+	require.Equal(t, "0", c.do(1, "incr n 1"))
+	require.Equal(t, "VALUE n 3 1|0|END", c.do(3, "get n"))
+	require.Equal(t, "CLIENT_ERROR invalid numeric delta argument", c.do(1, "incr n -1"))
+
+	require.Equal(t, "STORED", c.do(1, "set s 0 0 3", "abc"))
+	require.Equal(t, "CLIENT_ERROR cannot increment or decrement non-numeric value", c.do(1, "incr s 1"))
+
+	require.Equal(t, "NOT_FOUND", c.do(1, "touch missing 10"))
+	require.Equal(t, "TOUCHED", c.do(1, "touch s -1"))
+	require.Equal(t, "END", c.do(1, "get s"))
+
+	require.Equal(t, "STORED", c.do(1, "set e 0 -1 1", "x"))
+	require.Equal(t, "END", c.do(1, "get e"))
+}
+
+func TestFlushAllAndStats(t *testing.T) {
+	store := cache.NewCache()
+	require.NoError(t, store.Set(context.Background(), "other", "k", []byte("v")))
+	c := startServer(t, store)
+
+	require.Equal(t, "STORED", c.do(1, "set k 0 0 1", "v"))
+	require.Equal(t, "OK", c.do(1, "flush_all"))
+	require.Equal(t, "END", c.do(1, "get k"))
+
+	v, err := store.Get(context.Background(), "other", "k")
+	require.NoError(t, err)
+	require.Equal(t, "v", string(v))
+
+	c.send("stats")
+	stats := map[string]string{}
+	for {
+		line := c.read(1)
+		if line == "END" {
+			break
+		}
+		f := strings.Fields(line)
+		require.Len(t, f, 3)
+		stats[f[1]] = f[2]
+	}
+	require.Equal(t, "1", stats["cmd_get"])
+	require.Equal(t, "1", stats["get_misses"])
+	require.Equal(t, "1", stats["curr_connections"])
+
+	require.Equal(t, "VERSION 1.6.0", c.do(1, "version"))
+	require.Equal(t, "ERROR", c.do(1, "bogus"))
+}
+
+func TestMetaCommands(t *testing.T) {
+	store := cache.NewCache()
+	c := startServer(t, store)
+
+	require.Equal(t, "EN", c.do(1, "mg k v"))
+	require.Equal(t, "HD O1 kk", c.do(1, "ms k 5 F9 T100 O1 k", "hello"))
+	require.Equal(t, "VA 5 f9 t100 s5|hello", c.do(2, "mg k v f t s"))
+	require.Equal(t, "HD kk", c.do(1, "mg k k"))
+
+	e, err := store.Lookup(context.Background(), "default", "k")
+	require.NoError(t, err)
+	require.Equal(t, "HD c"+strconv.FormatUint(e.CAS, 10), c.do(1, "mg k c T0"))
+	require.Equal(t, "HD t-1", c.do(1, "mg k t"))
+
+	require.Equal(t, "NS", c.do(1, "ms k 1 ME", "x"))
+	require.Equal(t, "EX", c.do(1, "ms k 1 C999", "x"))
+	require.Equal(t, "HD", c.do(1, "ms k 1 C"+strconv.FormatUint(e.CAS, 10), "x"))
+	require.Equal(t, "HD", c.do(1, "ms k 1 MA", "y"))
+	require.Equal(t, "VA 2|xy", c.do(2, "mg k v"))
+
+	require.Equal(t, "EX", c.do(1, "md k C999"))
+	require.Equal(t, "HD", c.do(1, "md k"))
+	require.Equal(t, "NF", c.do(1, "md k"))
+	require.Equal(t, "NF", c.do(1, "md k C999"))
+
+	require.Equal(t, "HD", c.do(1, "ms k 1", "x"))
+	e, err = store.Lookup(context.Background(), "default", "k")
+	require.NoError(t, err)
+	require.Equal(t, "HD", c.do(1, "md k C"+strconv.FormatUint(e.CAS, 10)))
+	require.Equal(t, "NF", c.do(1, "md k"))
+
+	// quiet mode suppresses the uninteresting replies, mn marks the end of the pipeline
+	require.Equal(t, "MN", c.do(1, "mg k v q", "md k q", "ms k 1 q", "z", "mn"))
+	require.Equal(t, "CLIENT_ERROR invalid flag", c.do(1, "mg k x"))
+}
+
+func TestReadOnly(t *testing.T) {
+	store := cache.NewCache()
+	require.NoError(t, store.Set(context.Background(), "default", "k", []byte("v")))
+	c := startServer(t, cache.ReadOnly(store))
+
+	require.Equal(t, "VALUE k 0 1|v|END", c.do(3, "get k"))
+	require.Equal(t, "SERVER_ERROR read only replica", c.do(1, "set k 0 0 1 noreply", "x"))
+	require.Equal(t, "SERVER_ERROR read only replica", c.do(1, "flush_all"))
+}
+
+// lateListener hands out connections pushed to conns even once it is closed, as a listener does with
+// a connection accepted just before Close.
+type lateListener struct {
+	conns chan net.Conn
+}
+
+func (l *lateListener) Accept() (net.Conn, error) {
+	conn, ok := <-l.conns
+	if !ok {
+		return nil, net.ErrClosed
+	}
+	return conn, nil
+}
+
+func (l *lateListener) Close() error   { return nil }
+func (l *lateListener) Addr() net.Addr { return &net.TCPAddr{} }
+
+func TestShutdownClosesLateConnections(t *testing.T) {
+	srv := NewServer(newTestLogger(), cache.NewCache(), "default")
+	lis := &lateListener{conns: make(chan net.Conn)}
+	defer close(lis.conns)
+
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(lis) }()
+	require.Eventually(t, func() bool {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		return srv.listener != nil
+	}, 5*time.Second, time.Millisecond)
+
+	require.NoError(t, srv.Shutdown(context.Background()))
+
+	server, client := net.Pipe()
+	lis.conns <- server
+	select {
+	case err := <-served:
+		require.ErrorIs(t, err, ErrServerClosed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return")
+	}
+
+	_, err := client.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+}
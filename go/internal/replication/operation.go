@@ -0,0 +1,82 @@
+package replication
+
+import (
+	"time"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/cache"
+	cacheapiv1 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v1"
+)
+
+const (
+	RolePrimary = "primary"
+	RoleReplica = "replica"
+)
+
+func toProto(op cache.Operation, offset uint64) *cacheapiv1.ReplicatedOperation {
+	rop := &cacheapiv1.ReplicatedOperation{
+		Offset: offset,
+		Type:   toProtoType(op.Type),
+		Bucket: op.Bucket,
+		Key:    op.Key,
+		Value:  op.Value,
+		Flags:  op.Flags,
+
+		ContentType: op.ContentType,
+		Metadata:    op.Metadata,
+	}
+	if !op.Expiry.IsZero() {
+		rop.ExpiryUnixNano = op.Expiry.UnixNano()
+	}
+	return rop
+}
+
+func fromProto(rop *cacheapiv1.ReplicatedOperation) cache.Operation {
+	op := cache.Operation{
+		Type:   fromProtoType(rop.Type),
+		Bucket: rop.Bucket,
+		Key:    rop.Key,
+		Value:  rop.Value,
+		Flags:  rop.Flags,
+
+		ContentType: rop.ContentType,
+		Metadata:    rop.Metadata,
+	}
+	if rop.ExpiryUnixNano != 0 {
+		op.Expiry = time.Unix(0, rop.ExpiryUnixNano)
+	}
+	return op
+}
+
+func toProtoType(t cache.OperationType) cacheapiv1.OperationType {
+	switch t {
+	case cache.OpSet:
+		return cacheapiv1.OperationType_OPERATION_TYPE_SET
+	case cache.OpDelete:
+		return cacheapiv1.OperationType_OPERATION_TYPE_DELETE
+	case cache.OpExpire:
+		return cacheapiv1.OperationType_OPERATION_TYPE_EXPIRE
+	case cache.OpEvict:
+		return cacheapiv1.OperationType_OPERATION_TYPE_EVICT
+	case cache.OpFlush:
+		return cacheapiv1.OperationType_OPERATION_TYPE_FLUSH
+	default:
+		return cacheapiv1.OperationType_OPERATION_TYPE_UNSPECIFIED
+	}
+}
+
+func fromProtoType(t cacheapiv1.OperationType) cache.OperationType {
+	switch t {
+	case cacheapiv1.OperationType_OPERATION_TYPE_SET:
+		return cache.OpSet
+	case cacheapiv1.OperationType_OPERATION_TYPE_DELETE:
+		return cache.OpDelete
+	case cacheapiv1.OperationType_OPERATION_TYPE_EXPIRE:
+		return cache.OpExpire
+	case cacheapiv1.OperationType_OPERATION_TYPE_EVICT:
+		return cache.OpEvict
+	case cacheapiv1.OperationType_OPERATION_TYPE_FLUSH:
+		return cache.OpFlush
+	default:
+		return 0
+	}
+}
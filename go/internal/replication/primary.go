@@ -0,0 +1,208 @@
+package replication
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/auth"
+	"github.com/ahmedalhulaibi/cache-api/internal/cache"
+	cacheapiv1 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v1"
+)
+
+/*
+The primary numbers every operation applied to its store with a monotonically increasing offset
+and keeps the most recent operations in a fixed size backlog.
+
+A replica that reconnects with the primary's replication id and an offset that is still covered
+by the backlog resumes from the backlog (partial resync). Otherwise the replica receives a full
+sync: the primary registers the replica for live operations at offset N, streams a snapshot of
+the store and then the live operations after N. Operations that race with the snapshot may be
+sent twice, which is harmless since applying an operation is idempotent.
+*/
+
+type Primary struct {
+	logger            *loggy.Logger
+	store             cache.Store
+	replicationID     string
+	heartbeatInterval time.Duration
+
+	mu       sync.Mutex
+	offset   uint64
+	backlog  []*cacheapiv1.ReplicatedOperation // ring buffer indexed by offset
+	replicas map[*replicaStream]struct{}
+
+	cacheapiv1.UnimplementedReplicationServiceServer
+}
+
+type replicaStream struct {
+	ops      chan *cacheapiv1.ReplicatedOperation
+	overflow chan struct{}
+}
+
+var _ cacheapiv1.ReplicationServiceServer = (*Primary)(nil)
+
+// MethodPermissions are the permissions required by the RPCs of the replication service, a replica
+// receives every bucket.
+var MethodPermissions = auth.MethodPermissions{
+	cacheapiv1.ReplicationService_Sync_FullMethodName: auth.PermissionAdmin,
+}
+
+// NewPrimary subscribes to store, it must be created before the store is written to.
+func NewPrimary(logger *loggy.Logger, store cache.Store, backlogSize int, heartbeatInterval time.Duration) *Primary {
+	p := &Primary{
+		logger:            logger,
+		store:             store,
+		replicationID:     uuid.NewString(),
+		heartbeatInterval: heartbeatInterval,
+		backlog:           make([]*cacheapiv1.ReplicatedOperation, backlogSize),
+		replicas:          make(map[*replicaStream]struct{}),
+	}
+	store.Subscribe(p.observe)
+	return p
+}
+
+func (p *Primary) observe(op cache.Operation) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.offset++
+	rop := toProto(op, p.offset)
+	p.backlog[p.offset%uint64(len(p.backlog))] = rop
+
+	for r := range p.replicas {
+		select {
+		case r.ops <- rop:
+		default:
+			// the replica is too slow, it will reconnect and resume from the backlog if it can
+			close(r.overflow)
+			delete(p.replicas, r)
+		}
+	}
+}
+
+// canResume must be called with the lock held.
+func (p *Primary) canResume(replicationID string, offset uint64) bool {
+	if replicationID != p.replicationID || offset > p.offset {
+		return false
+	}
+	return p.offset-offset <= uint64(len(p.backlog))
+}
+
+func (p *Primary) Sync(r *cacheapiv1.SyncRequest, stream cacheapiv1.ReplicationService_SyncServer) error {
+	ctx := stream.Context()
+	rs := &replicaStream{
+		ops:      make(chan *cacheapiv1.ReplicatedOperation, len(p.backlog)),
+		overflow: make(chan struct{}),
+	}
+
+	p.mu.Lock()
+	resume := p.canResume(r.ReplicationId, r.Offset)
+	start := p.offset
+	var pending []*cacheapiv1.ReplicatedOperation
+	if resume {
+		for o := r.Offset + 1; o <= p.offset; o++ {
+			pending = append(pending, p.backlog[o%uint64(len(p.backlog))])
+		}
+	}
+	p.replicas[rs] = struct{}{}
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.replicas, rs)
+	}()
+
+	if resume {
+		p.logger.Infow(ctx, "replica partial resync", "replica_id", r.ReplicaId, "offset", r.Offset, "pending", len(pending))
+		if err := p.partialSync(stream, pending); err != nil {
+			return err
+		}
+	} else {
+		p.logger.Infow(ctx, "replica full sync", "replica_id", r.ReplicaId, "offset", start)
+		if err := p.fullSync(stream, start); err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(p.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-rs.overflow:
+			p.logger.Warnw(ctx, "replica disconnected, replication buffer full", "replica_id", r.ReplicaId)
+			return status.Error(codes.ResourceExhausted, "replica is too far behind")
+		case op := <-rs.ops:
+			if err := stream.Send(&cacheapiv1.SyncResponse{Payload: &cacheapiv1.SyncResponse_Operation{Operation: op}}); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if err := stream.Send(p.heartbeat()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (p *Primary) partialSync(stream cacheapiv1.ReplicationService_SyncServer, pending []*cacheapiv1.ReplicatedOperation) error {
+	if err := stream.Send(&cacheapiv1.SyncResponse{
+		Payload: &cacheapiv1.SyncResponse_PartialSync{PartialSync: &cacheapiv1.PartialSync{ReplicationId: p.replicationID}},
+	}); err != nil {
+		return err
+	}
+
+	for _, op := range pending {
+		if err := stream.Send(&cacheapiv1.SyncResponse{Payload: &cacheapiv1.SyncResponse_Operation{Operation: op}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Primary) fullSync(stream cacheapiv1.ReplicationService_SyncServer, offset uint64) error {
+	if err := stream.Send(&cacheapiv1.SyncResponse{
+		Payload: &cacheapiv1.SyncResponse_FullSyncStart{FullSyncStart: &cacheapiv1.FullSyncStart{ReplicationId: p.replicationID, Offset: offset}},
+	}); err != nil {
+		return err
+	}
+
+	if err := p.store.Snapshot(func(op cache.Operation) error {
+		return stream.Send(&cacheapiv1.SyncResponse{Payload: &cacheapiv1.SyncResponse_Operation{Operation: toProto(op, 0)}})
+	}); err != nil {
+		return err
+	}
+
+	return stream.Send(&cacheapiv1.SyncResponse{Payload: &cacheapiv1.SyncResponse_FullSyncEnd{FullSyncEnd: &cacheapiv1.FullSyncEnd{}}})
+}
+
+func (p *Primary) heartbeat() *cacheapiv1.SyncResponse {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return &cacheapiv1.SyncResponse{Payload: &cacheapiv1.SyncResponse_Heartbeat{Heartbeat: &cacheapiv1.Heartbeat{
+		Offset:            p.offset,
+		TimestampUnixNano: time.Now().UnixNano(),
+	}}}
+}
+
+func (p *Primary) Stats() *cacheapiv1.ReplicationStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return &cacheapiv1.ReplicationStats{
+		Role:              RolePrimary,
+		ReplicationId:     p.replicationID,
+		Offset:            p.offset,
+		PrimaryOffset:     p.offset,
+		Connected:         true,
+		ConnectedReplicas: uint32(len(p.replicas)),
+	}
+}
@@ -0,0 +1,229 @@
+package replication
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/cache"
+	cacheapiv1 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v1"
+)
+
+const (
+	minReconnectDelay = 100 * time.Millisecond
+	maxReconnectDelay = 5 * time.Second
+)
+
+// Replica follows a primary and applies its operations to a store.
+// The store should be served read-only so that it only changes through replication.
+type Replica struct {
+	logger      *loggy.Logger
+	store       cache.Store
+	primaryAddr string
+	replicaID   string
+	dialOptions []grpc.DialOption
+
+	mu            sync.Mutex
+	replicationID string
+	offset        uint64
+	primaryOffset uint64
+	lastContact   time.Time
+	connected     bool
+	// fullSync is set from the start of a full sync until it completes, the store is incomplete meanwhile
+	fullSync bool
+}
+
+func NewReplica(logger *loggy.Logger, store cache.Store, primaryAddr, replicaID string, dialOptions ...grpc.DialOption) *Replica {
+	if len(dialOptions) == 0 {
+		dialOptions = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+
+	return &Replica{
+		logger:      logger,
+		store:       store,
+		primaryAddr: primaryAddr,
+		replicaID:   replicaID,
+		dialOptions: dialOptions,
+	}
+}
+
+// Run replicates from the primary until ctx is done, reconnecting with backoff.
+func (r *Replica) Run(ctx context.Context) error {
+	conn, err := grpc.NewClient(r.primaryAddr, r.dialOptions...)
+	if err != nil {
+		return fmt.Errorf("replication client: %w", err)
+	}
+	defer conn.Close()
+
+	client := cacheapiv1.NewReplicationServiceClient(conn)
+	delay := minReconnectDelay
+	for {
+		started := time.Now()
+		err := r.sync(ctx, client)
+		r.setConnected(false)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// back off only while the primary is unreachable
+		if r.contactedSince(started) {
+			delay = minReconnectDelay
+		}
+
+		r.logger.Warnw(ctx, "replication stream ended, reconnecting", "primary", r.primaryAddr, "delay", delay, "err", err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+func (r *Replica) sync(ctx context.Context, client cacheapiv1.ReplicationServiceClient) error {
+	r.mu.Lock()
+	req := &cacheapiv1.SyncRequest{
+		ReplicaId:     r.replicaID,
+		ReplicationId: r.replicationID,
+		Offset:        r.offset,
+	}
+	r.mu.Unlock()
+
+	stream, err := client.Sync(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	// set while a full sync is in progress, the offset only moves once the snapshot is complete
+	var fullSync *cacheapiv1.FullSyncStart
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		r.touch()
+
+		switch p := msg.Payload.(type) {
+		case *cacheapiv1.SyncResponse_FullSyncStart:
+			r.logger.Infow(ctx, "replication full sync started", "primary", r.primaryAddr, "replication_id", p.FullSyncStart.ReplicationId, "offset", p.FullSyncStart.Offset)
+			fullSync = p.FullSyncStart
+			r.mu.Lock()
+			r.fullSync = true
+			r.mu.Unlock()
+			if err := r.store.Apply(cache.Operation{Type: cache.OpFlush}); err != nil {
+				return err
+			}
+		case *cacheapiv1.SyncResponse_FullSyncEnd:
+			if fullSync == nil {
+				return fmt.Errorf("full sync end without start")
+			}
+			r.mu.Lock()
+			r.replicationID = fullSync.ReplicationId
+			r.offset = fullSync.Offset
+			r.connected = true
+			r.fullSync = false
+			r.mu.Unlock()
+			r.observePrimaryOffset(fullSync.Offset)
+			r.logger.Infow(ctx, "replication full sync completed", "primary", r.primaryAddr, "offset", fullSync.Offset)
+			fullSync = nil
+		case *cacheapiv1.SyncResponse_PartialSync:
+			r.logger.Infow(ctx, "replication resumed", "primary", r.primaryAddr, "replication_id", p.PartialSync.ReplicationId, "offset", req.Offset)
+			r.setConnected(true)
+		case *cacheapiv1.SyncResponse_Operation:
+			if err := r.apply(p.Operation, fullSync != nil); err != nil {
+				return err
+			}
+		case *cacheapiv1.SyncResponse_Heartbeat:
+			r.observePrimaryOffset(p.Heartbeat.Offset)
+		}
+	}
+}
+
+func (r *Replica) apply(op *cacheapiv1.ReplicatedOperation, snapshot bool) error {
+	if !snapshot {
+		r.mu.Lock()
+		applied := op.Offset <= r.offset
+		r.mu.Unlock()
+		if applied {
+			return nil
+		}
+	}
+
+	if err := r.store.Apply(fromProto(op)); err != nil {
+		return fmt.Errorf("applying operation at offset %d: %w", op.Offset, err)
+	}
+
+	if !snapshot {
+		r.mu.Lock()
+		r.offset = op.Offset
+		r.mu.Unlock()
+		r.observePrimaryOffset(op.Offset)
+	}
+	return nil
+}
+
+func (r *Replica) observePrimaryOffset(offset uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if offset > r.primaryOffset {
+		r.primaryOffset = offset
+	}
+}
+
+func (r *Replica) touch() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastContact = time.Now()
+}
+
+func (r *Replica) contactedSince(t time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastContact.After(t)
+}
+
+func (r *Replica) setConnected(connected bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.connected = connected
+}
+
+// Ready returns an error until a first sync completes and while a full sync is in progress.
+func (r *Replica) Ready() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case r.fullSync:
+		return fmt.Errorf("full sync from %s in progress", r.primaryAddr)
+	case r.replicationID == "":
+		return fmt.Errorf("not synced with %s yet", r.primaryAddr)
+	}
+	return nil
+}
+
+func (r *Replica) Stats() *cacheapiv1.ReplicationStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := &cacheapiv1.ReplicationStats{
+		Role:          RoleReplica,
+		ReplicationId: r.replicationID,
+		Offset:        r.offset,
+		PrimaryOffset: r.primaryOffset,
+		Connected:     r.connected,
+	}
+	if r.primaryOffset > r.offset {
+		s.Lag = r.primaryOffset - r.offset
+	}
+	if !r.lastContact.IsZero() {
+		s.LagSeconds = time.Since(r.lastContact).Seconds()
+	}
+	return s
+}
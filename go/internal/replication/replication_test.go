@@ -0,0 +1,136 @@
+package replication
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/cache"
+	cacheapiv1 "github.com/ahmedalhulaibi/cache-api/internal/gen/cacheapi/v1"
+)
+
+func newTestLogger() *loggy.Logger {
+	l := loggy.New(zap.NewNop().Sugar())
+	return &l
+}
+
+func startPrimary(t *testing.T, backlogSize int) (cache.Store, *Primary, string) {
+	t.Helper()
+	store := cache.NewCache()
+	primary := NewPrimary(newTestLogger(), store, backlogSize, 10*time.Millisecond)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	cacheapiv1.RegisterReplicationServiceServer(srv, primary)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	return store, primary, lis.Addr().String()
+}
+
+func runReplica(t *testing.T, replica *Replica) context.CancelFunc {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, replica.Run(ctx))
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func requireEventually(t *testing.T, store cache.Store, bucket, key string, want []byte) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		v, err := store.Get(context.Background(), bucket, key)
+		return err == nil && string(v) == string(want)
+	}, 5*time.Second, 10*time.Millisecond, "%s/%s", bucket, key)
+}
+
+func TestReplicationFullSyncAndStream(t *testing.T) {
+	primaryStore, primary, addr := startPrimary(t, 100)
+	require.NoError(t, primaryStore.Set(context.Background(), "bucket1", "before", []byte("value1")))
+
+	replicaStore := cache.NewCache()
+	replica := NewReplica(newTestLogger(), replicaStore, addr, "replica-1")
+	require.ErrorContains(t, replica.Ready(), "not synced")
+	stop := runReplica(t, replica)
+	defer stop()
+
+	requireEventually(t, replicaStore, "bucket1", "before", []byte("value1"))
+	require.Eventually(t, func() bool { return replica.Ready() == nil }, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, primaryStore.Set(context.Background(), "bucket1", "after", []byte("value2"), cache.WithTTL(time.Hour)))
+	require.NoError(t, primaryStore.Delete(context.Background(), "bucket1", "before"))
+	requireEventually(t, replicaStore, "bucket1", "after", []byte("value2"))
+	requireEventually(t, replicaStore, "bucket1", "before", nil)
+
+	require.Eventually(t, func() bool {
+		s := replica.Stats()
+		return s.Connected && s.Lag == 0 && s.Offset == primary.Stats().Offset
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, uint32(1), primary.Stats().ConnectedReplicas)
+}
+
+func TestReplicationPartialResync(t *testing.T) {
+	primaryStore, primary, addr := startPrimary(t, 100)
+
+	replicaStore := cache.NewCache()
+	replica := NewReplica(newTestLogger(), replicaStore, addr, "replica-1")
+	stop := runReplica(t, replica)
+	require.NoError(t, primaryStore.Set(context.Background(), "bucket1", "key1", []byte("value1")))
+	requireEventually(t, replicaStore, "bucket1", "key1", []byte("value1"))
+	stop()
+
+	// a key only present on the replica survives a partial resync, a full sync would remove it
+	require.NoError(t, replicaStore.Set(context.Background(), "bucket1", "local", []byte("local")))
+	require.NoError(t, primaryStore.Set(context.Background(), "bucket1", "key2", []byte("value2")))
+
+	stop = runReplica(t, replica)
+	defer stop()
+	requireEventually(t, replicaStore, "bucket1", "key2", []byte("value2"))
+	requireEventually(t, replicaStore, "bucket1", "local", []byte("local"))
+	require.Equal(t, primary.Stats().Offset, replica.Stats().Offset)
+}
+
+func TestReplicationFullResyncWhenBacklogExceeded(t *testing.T) {
+	primaryStore, _, addr := startPrimary(t, 2)
+
+	replicaStore := cache.NewCache()
+	replica := NewReplica(newTestLogger(), replicaStore, addr, "replica-1")
+	stop := runReplica(t, replica)
+	require.NoError(t, primaryStore.Set(context.Background(), "bucket1", "key1", []byte("value1")))
+	requireEventually(t, replicaStore, "bucket1", "key1", []byte("value1"))
+	stop()
+
+	require.NoError(t, replicaStore.Set(context.Background(), "bucket1", "local", []byte("local")))
+	for _, key := range []string{"key2", "key3", "key4"} {
+		require.NoError(t, primaryStore.Set(context.Background(), "bucket1", key, []byte(key)))
+	}
+
+	stop = runReplica(t, replica)
+	defer stop()
+	requireEventually(t, replicaStore, "bucket1", "key4", []byte("key4"))
+	requireEventually(t, replicaStore, "bucket1", "local", nil)
+}
+
+func TestReadOnlyReplica(t *testing.T) {
+	store := cache.ReadOnly(cache.NewCache())
+	require.ErrorIs(t, store.Set(context.Background(), "bucket1", "key1", []byte("value1")), cache.ErrReadOnly)
+	require.ErrorIs(t, store.Delete(context.Background(), "bucket1", "key1"), cache.ErrReadOnly)
+	require.NoError(t, store.Apply(cache.Operation{Type: cache.OpSet, Bucket: "bucket1", Key: "key1", Value: []byte("value1")}))
+
+	v, err := store.Get(context.Background(), "bucket1", "key1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("value1"), v)
+}
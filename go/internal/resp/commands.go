@@ -0,0 +1,470 @@
+package resp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/cache"
+)
+
+// replyError is an error reply that already starts with a Redis error code.
+type replyError string
+
+func (e replyError) Error() string {
+	return string(e)
+}
+
+const (
+	errSyntax   = replyError("ERR syntax error")
+	errNotInt   = replyError("ERR value is not an integer or out of range")
+	errOverflow = replyError("ERR increment or decrement would overflow")
+	errExpire   = replyError("ERR invalid expire time")
+	errReadOnly = replyError("READONLY You can't write against a read only replica.")
+	errNoProto  = replyError("NOPROTO unsupported protocol version")
+)
+
+func wrongArity(name string) replyError {
+	return replyError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+}
+
+type command struct {
+	// arity is the number of arguments including the command name, negative for a minimum
+	arity   int
+	handler func(s *Server, w *writer, sess *session, args [][]byte) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"PING":    {-1, cmdPing},
+		"ECHO":    {2, cmdEcho},
+		"HELLO":   {-1, cmdHello},
+		"QUIT":    {1, cmdQuit},
+		"SELECT":  {2, cmdSelect},
+		"INFO":    {-1, cmdInfo},
+		"COMMAND": {-1, cmdCommand},
+		"CLIENT":  {-2, cmdClient},
+		"GET":     {2, cmdGet},
+		"SET":     {-3, cmdSet},
+		"DEL":     {-2, cmdDel},
+		"EXISTS":  {-2, cmdExists},
+		"TTL":     {2, cmdTTL},
+		"PTTL":    {2, cmdPTTL},
+		"EXPIRE":  {3, cmdExpire},
+		"INCR":    {2, cmdIncr},
+		"DECR":    {2, cmdDecr},
+		"INCRBY":  {3, cmdIncrBy},
+		"DECRBY":  {3, cmdDecrBy},
+		"MGET":    {-2, cmdMGet},
+		"MSET":    {-3, cmdMSet},
+	}
+}
+
+func (s *Server) execute(w *writer, sess *session, args [][]byte) {
+	name := strings.ToUpper(string(args[0]))
+	cmd, ok := commands[name]
+	if !ok {
+		w.error(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return
+	}
+
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		w.error(wrongArity(name).Error())
+		return
+	}
+
+	if err := cmd.handler(s, w, sess, args); err != nil {
+		var reply replyError
+		switch {
+		case errors.Is(err, cache.ErrReadOnly):
+			w.error(errReadOnly.Error())
+		case errors.As(err, &reply):
+			w.error(reply.Error())
+		default:
+			w.error("ERR " + err.Error())
+		}
+	}
+}
+
+func cmdPing(s *Server, w *writer, sess *session, args [][]byte) error {
+	switch len(args) {
+	case 1:
+		w.simple("PONG")
+	case 2:
+		w.bulk(args[1])
+	default:
+		return wrongArity("ping")
+	}
+	return nil
+}
+
+func cmdEcho(s *Server, w *writer, sess *session, args [][]byte) error {
+	w.bulk(args[1])
+	return nil
+}
+
+func cmdHello(s *Server, w *writer, sess *session, args [][]byte) error {
+	if len(args) > 1 {
+		proto, err := strconv.Atoi(string(args[1]))
+		if err != nil || proto < 2 || proto > 3 {
+			return errNoProto
+		}
+		w.proto = proto
+	}
+
+	w.mapHeader(5)
+	w.bulk([]byte("server"))
+	w.bulk([]byte("cache-api"))
+	w.bulk([]byte("version"))
+	w.bulk([]byte("7.0.0"))
+	w.bulk([]byte("proto"))
+	w.integer(int64(w.proto))
+	w.bulk([]byte("mode"))
+	w.bulk([]byte("standalone"))
+	w.bulk([]byte("modules"))
+	w.array(0)
+	return nil
+}
+
+func cmdQuit(s *Server, w *writer, sess *session, args [][]byte) error {
+	sess.quit = true
+	w.simple("OK")
+	return nil
+}
+
+// cmdSelect selects a bucket, any bucket name is accepted as a database.
+func cmdSelect(s *Server, w *writer, sess *session, args [][]byte) error {
+	if len(args[1]) == 0 {
+		return replyError("ERR invalid bucket name")
+	}
+	sess.bucket = string(args[1])
+	w.simple("OK")
+	return nil
+}
+
+func cmdInfo(s *Server, w *writer, sess *session, args [][]byte) error {
+	st := s.store.Stats()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Server\r\nredis_version:7.0.0\r\nredis_mode:standalone\r\nuptime_in_seconds:%d\r\n\r\n", int64(time.Since(s.started).Seconds()))
+	fmt.Fprintf(&b, "# Stats\r\nkeyspace_hits:%d\r\nkeyspace_misses:%d\r\nevicted_keys:%d\r\nexpired_keys:%d\r\n", st.Hits, st.Misses, st.Evictions, st.Expired)
+	w.bulk([]byte(b.String()))
+	return nil
+}
+
+// cmdCommand and cmdClient exist so that clients that introspect the server on connect work.
+func cmdCommand(s *Server, w *writer, sess *session, args [][]byte) error {
+	w.array(0)
+	return nil
+}
+
+func cmdClient(s *Server, w *writer, sess *session, args [][]byte) error {
+	w.simple("OK")
+	return nil
+}
+
+func cmdGet(s *Server, w *writer, sess *session, args [][]byte) error {
+	v, err := s.store.Get(context.Background(), sess.bucket, string(args[1]))
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		w.null()
+		return nil
+	}
+	w.bulk(v)
+	return nil
+}
+
+// cmdSet implements SET key value [NX | XX] [EX seconds | PX milliseconds | KEEPTTL].
+func cmdSet(s *Server, w *writer, sess *session, args [][]byte) error {
+	var nx, xx, keepTTL bool
+	var ttl time.Duration
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(string(args[i])); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX":
+			if i+1 >= len(args) || ttl != 0 {
+				return errSyntax
+			}
+			i++
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return errNotInt
+			}
+			if n <= 0 {
+				return errExpire
+			}
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			if n > math.MaxInt64/int64(unit) {
+				return errExpire
+			}
+			ttl = time.Duration(n) * unit
+		default:
+			return errSyntax
+		}
+	}
+	if (nx && xx) || (keepTTL && ttl != 0) {
+		return errSyntax
+	}
+
+	value := append([]byte(nil), args[2]...)
+	var written bool
+	err := s.store.Update(context.Background(), sess.bucket, string(args[1]), func(current *cache.Entry) (*cache.Entry, error) {
+		if (nx && current != nil) || (xx && current == nil) {
+			return nil, nil
+		}
+		written = true
+		next := &cache.Entry{Value: value}
+		if ttl > 0 {
+			next.Expiry = time.Now().Add(ttl)
+		} else if keepTTL && current != nil {
+			next.Expiry = current.Expiry
+		}
+		return next, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if !written {
+		w.null()
+		return nil
+	}
+	w.simple("OK")
+	return nil
+}
+
+func cmdDel(s *Server, w *writer, sess *session, args [][]byte) error {
+	var n int64
+	for _, key := range args[1:] {
+		e, err := s.store.Lookup(context.Background(), sess.bucket, string(key))
+		if err != nil {
+			return err
+		}
+		if err := s.store.Delete(context.Background(), sess.bucket, string(key)); err != nil {
+			return err
+		}
+		if e != nil {
+			n++
+		}
+	}
+	w.integer(n)
+	return nil
+}
+
+func cmdExists(s *Server, w *writer, sess *session, args [][]byte) error {
+	var n int64
+	for _, key := range args[1:] {
+		e, err := s.store.Lookup(context.Background(), sess.bucket, string(key))
+		if err != nil {
+			return err
+		}
+		if e != nil {
+			n++
+		}
+	}
+	w.integer(n)
+	return nil
+}
+
+// ttl returns -2 for a missing key, -1 for a key without expiry and the remaining time otherwise.
+func ttl(s *Server, sess *session, key []byte) (time.Duration, error) {
+	e, err := s.store.Lookup(context.Background(), sess.bucket, string(key))
+	if err != nil {
+		return 0, err
+	}
+	if e == nil {
+		return -2, nil
+	}
+	if e.Expiry.IsZero() {
+		return -1, nil
+	}
+	return max(time.Until(e.Expiry), 0), nil
+}
+
+func cmdTTL(s *Server, w *writer, sess *session, args [][]byte) error {
+	d, err := ttl(s, sess, args[1])
+	if err != nil {
+		return err
+	}
+	if d < 0 {
+		w.integer(int64(d))
+		return nil
+	}
+	w.integer(int64((d + time.Second/2) / time.Second))
+	return nil
+}
+
+func cmdPTTL(s *Server, w *writer, sess *session, args [][]byte) error {
+	d, err := ttl(s, sess, args[1])
+	if err != nil {
+		return err
+	}
+	if d < 0 {
+		w.integer(int64(d))
+		return nil
+	}
+	w.integer(d.Milliseconds())
+	return nil
+}
+
+// cmdExpire sets the ttl of an existing key, a ttl that is not positive deletes the key.
+func cmdExpire(s *Server, w *writer, sess *session, args [][]byte) error {
+	seconds, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return errNotInt
+	}
+	if seconds > math.MaxInt64/int64(time.Second) {
+		return errExpire
+	}
+
+	key := string(args[1])
+	if seconds <= 0 {
+		e, err := s.store.Lookup(context.Background(), sess.bucket, key)
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			w.integer(0)
+			return nil
+		}
+		if err := s.store.Delete(context.Background(), sess.bucket, key); err != nil {
+			return err
+		}
+		w.integer(1)
+		return nil
+	}
+
+	var found bool
+	err = s.store.Update(context.Background(), sess.bucket, key, func(current *cache.Entry) (*cache.Entry, error) {
+		if current == nil {
+			return nil, nil
+		}
+		found = true
+		next := *current
+		next.Expiry = time.Now().Add(time.Duration(seconds) * time.Second)
+		return &next, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if found {
+		w.integer(1)
+	} else {
+		w.integer(0)
+	}
+	return nil
+}
+
+func incrBy(s *Server, w *writer, sess *session, key []byte, delta int64) error {
+	var result int64
+	err := s.store.Update(context.Background(), sess.bucket, string(key), func(current *cache.Entry) (*cache.Entry, error) {
+		var n int64
+		next := &cache.Entry{}
+		if current != nil {
+			var err error
+			n, err = strconv.ParseInt(string(current.Value), 10, 64)
+			if err != nil {
+				return nil, errNotInt
+			}
+			next.Expiry = current.Expiry
+		}
+		if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+			return nil, errOverflow
+		}
+		result = n + delta
+		next.Value = strconv.AppendInt(nil, result, 10)
+		return next, nil
+	})
+	if err != nil {
+		return err
+	}
+	w.integer(result)
+	return nil
+}
+
+func parseDelta(b []byte) (int64, error) {
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return 0, errNotInt
+	}
+	return n, nil
+}
+
+func cmdIncr(s *Server, w *writer, sess *session, args [][]byte) error {
+	return incrBy(s, w, sess, args[1], 1)
+}
+
+func cmdDecr(s *Server, w *writer, sess *session, args [][]byte) error {
+	return incrBy(s, w, sess, args[1], -1)
+}
+
+func cmdIncrBy(s *Server, w *writer, sess *session, args [][]byte) error {
+	n, err := parseDelta(args[2])
+	if err != nil {
+		return err
+	}
+	return incrBy(s, w, sess, args[1], n)
+}
+
+func cmdDecrBy(s *Server, w *writer, sess *session, args [][]byte) error {
+	n, err := parseDelta(args[2])
+	if err != nil {
+		return err
+	}
+	if n == math.MinInt64 {
+		return errOverflow
+	}
+	return incrBy(s, w, sess, args[1], -n)
+}
+
+func cmdMGet(s *Server, w *writer, sess *session, args [][]byte) error {
+	values := make([][]byte, len(args)-1)
+	for i, key := range args[1:] {
+		v, err := s.store.Get(context.Background(), sess.bucket, string(key))
+		if err != nil {
+			return err
+		}
+		values[i] = v
+	}
+
+	w.array(len(values))
+	for _, v := range values {
+		if v == nil {
+			w.null()
+			continue
+		}
+		w.bulk(v)
+	}
+	return nil
+}
+
+func cmdMSet(s *Server, w *writer, sess *session, args [][]byte) error {
+	if len(args)%2 != 1 {
+		return wrongArity("mset")
+	}
+
+	for i := 1; i < len(args); i += 2 {
+		if err := s.store.Set(context.Background(), sess.bucket, string(args[i]), append([]byte(nil), args[i+1]...)); err != nil {
+			return err
+		}
+	}
+	w.simple("OK")
+	return nil
+}
@@ -0,0 +1,152 @@
+package resp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ahmedalhulaibi/loggy"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/cache"
+)
+
+var ErrServerClosed = errors.New("resp: server closed")
+
+// Server speaks the Redis serialization protocol (RESP2 and RESP3) on top of a cache store.
+// Each bucket is a Redis database selected with SELECT.
+type Server struct {
+	logger        *loggy.Logger
+	store         cache.Store
+	defaultBucket string
+	started       time.Time
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+func NewServer(logger *loggy.Logger, store cache.Store, defaultBucket string) *Server {
+	return &Server{
+		logger:        logger,
+		store:         store,
+		defaultBucket: defaultBucket,
+		started:       time.Now(),
+		conns:         make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts connections on l until Shutdown is called, it always returns a non-nil error.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		// a connection accepted while shutting down would be missed by Shutdown
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Shutdown stops accepting connections, closes open connections and waits for their handlers
+// to finish or ctx to be done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type session struct {
+	bucket string
+	quit   bool
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	ctx := context.Background()
+	r := bufio.NewReader(conn)
+	w := &writer{Writer: bufio.NewWriter(conn), proto: 2}
+	sess := &session{bucket: s.defaultBucket}
+
+	for !sess.quit {
+		args, err := readCommand(r)
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				w.error("ERR " + err.Error())
+				w.Flush()
+			} else if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.logger.Debugw(ctx, "resp connection error", "remote_addr", conn.RemoteAddr().String(), "err", err)
+			}
+			return
+		}
+
+		if len(args) > 0 {
+			s.execute(w, sess, args)
+		}
+
+		// replies to pipelined commands are flushed together once the client stops sending
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,263 @@
+package resp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmedalhulaibi/loggy"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ahmedalhulaibi/cache-api/internal/cache"
+)
+
+func newTestLogger() *loggy.Logger {
+	l := loggy.New(zap.NewNop().Sugar())
+	return &l
+}
+
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func startServer(t *testing.T, store cache.Store) *client {
+	t.Helper()
+	srv := NewServer(newTestLogger(), store, "default")
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.Serve(lis)
+	t.Cleanup(func() {
+		require.NoError(t, srv.Shutdown(context.Background()))
+	})
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	require.NoError(t, err)
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+	return &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *client) send(args ...string) {
+	c.t.Helper()
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	_, err := c.conn.Write([]byte(b.String()))
+	require.NoError(c.t, err)
+}
+
+// reply reads a single reply and renders it as a compact string, e.g. "+OK", ":1", "$value", "$nil" or "*[$a $nil]".
+func (c *client) reply() string {
+	c.t.Helper()
+	line, err := c.r.ReadString('\n')
+	require.NoError(c.t, err)
+	line = strings.TrimSuffix(line, "\r\n")
+
+	switch line[0] {
+	case '$':
+		if line == "$-1" {
+			return "$nil"
+		}
+		var n int
+		fmt.Sscanf(line[1:], "%d", &n)
+		buf := make([]byte, n+2)
+		_, err := io.ReadFull(c.r, buf)
+		require.NoError(c.t, err)
+		return "$" + string(buf[:n])
+	case '_':
+		return "$nil"
+	case '*', '%':
+		var n int
+		fmt.Sscanf(line[1:], "%d", &n)
+		if line[0] == '%' {
+			n *= 2
+		}
+		items := make([]string, n)
+		for i := range items {
+			items[i] = c.reply()
+		}
+		return string(line[0]) + "[" + strings.Join(items, " ") + "]"
+	}
+	return line
+}
+
+func (c *client) do(args ...string) string {
+	c.t.Helper()
+	c.send(args...)
+	return c.reply()
+}
+
+func TestStringCommands(t *testing.T) {
+	c := startServer(t, cache.NewCache())
+
+	require.Equal(t, "+PONG", c.do("PING"))
+	require.Equal(t, "$nil", c.do("GET", "k"))
+	require.Equal(t, "+OK", c.do("SET", "k", "v"))
+	require.Equal(t, "$v", c.do("GET", "k"))
+	require.Equal(t, ":-1", c.do("TTL", "k"))
+
+	require.Equal(t, "$nil", c.do("SET", "k", "other", "NX"))
+	require.Equal(t, "$nil", c.do("SET", "missing", "v", "XX"))
+	require.Equal(t, "+OK", c.do("SET", "k", "v2", "XX", "EX", "100"))
+	require.Equal(t, ":100", c.do("TTL", "k"))
+	require.Equal(t, "+OK", c.do("SET", "k", "v3", "KEEPTTL"))
+	require.Equal(t, ":100", c.do("TTL", "k"))
+	require.Equal(t, "-ERR syntax error", c.do("SET", "k", "v", "NX", "XX"))
+
+	require.Equal(t, ":2", c.do("EXISTS", "k", "k", "missing"))
+	require.Equal(t, ":1", c.do("DEL", "k", "missing"))
+	require.Equal(t, ":-2", c.do("TTL", "k"))
+
+	require.Equal(t, "+OK", c.do("MSET", "a", "1", "b", "2"))
+	require.Equal(t, "*[$1 $nil $2]", c.do("MGET", "a", "missing", "b"))
+	require.Equal(t, "-ERR wrong number of arguments for 'mset' command", c.do("MSET", "a"))
+	require.Equal(t, "-ERR unknown command 'NOPE'", c.do("NOPE"))
+}
+
+func TestCounters(t *testing.T) {
+	c := startServer(t, cache.NewCache())
+
+	require.Equal(t, ":1", c.do("INCR", "n"))
+	require.Equal(t, ":11", c.do("INCRBY", "n", "10"))
+	require.Equal(t, ":10", c.do("DECR", "n"))
+	require.Equal(t, ":-5", c.do("DECRBY", "n", "15"))
+	require.Equal(t, "$-5", c.do("GET", "n"))
+
+	require.Equal(t, "+OK", c.do("SET", "n", "9223372036854775807"))
+	require.Equal(t, "-ERR increment or decrement would overflow", c.do("INCR", "n"))
+	require.Equal(t, "+OK", c.do("SET", "s", "abc"))
+	require.Equal(t, "-ERR value is not an integer or out of range", c.do("INCR", "s"))
+}
+
+func TestExpire(t *testing.T) {
+	c := startServer(t, cache.NewCache())
+
+	require.Equal(t, ":0", c.do("EXPIRE", "k", "10"))
+	require.Equal(t, "+OK", c.do("SET", "k", "v", "PX", "50"))
+	require.Equal(t, ":1", c.do("EXPIRE", "k", "10"))
+	require.Equal(t, ":10", c.do("TTL", "k"))
+	require.Equal(t, ":1", c.do("EXPIRE", "k", "0"))
+	require.Equal(t, "$nil", c.do("GET", "k"))
+
+	require.Equal(t, "+OK", c.do("SET", "k", "v", "PX", "20"))
+	time.Sleep(40 * time.Millisecond)
+	require.Equal(t, "$nil", c.do("GET", "k"))
+}
+
+func TestSelectBuckets(t *testing.T) {
+	store := cache.NewCache()
+	c := startServer(t, store)
+
+	require.Equal(t, "+OK", c.do("SET", "k", "default"))
+	require.Equal(t, "+OK", c.do("SELECT", "other"))
+	require.Equal(t, "$nil", c.do("GET", "k"))
+	require.Equal(t, "+OK", c.do("SET", "k", "other"))
+
+	v, err := store.Get(context.Background(), "default", "k")
+	require.NoError(t, err)
+	require.Equal(t, "default", string(v))
+	v, err = store.Get(context.Background(), "other", "k")
+	require.NoError(t, err)
+	require.Equal(t, "other", string(v))
+}
+
+func TestPipelineAndInline(t *testing.T) {
+	c := startServer(t, cache.NewCache())
+
+	c.send("SET", "k", "v")
+	c.send("GET", "k")
+	c.send("INCR", "n")
+	require.Equal(t, "+OK", c.reply())
+	require.Equal(t, "$v", c.reply())
+	require.Equal(t, ":1", c.reply())
+
+	_, err := c.conn.Write([]byte("PING\r\nECHO hello\r\n"))
+	require.NoError(t, err)
+	require.Equal(t, "+PONG", c.reply())
+	require.Equal(t, "$hello", c.reply())
+}
+
+func TestHello(t *testing.T) {
+	c := startServer(t, cache.NewCache())
+
+	require.Equal(t, "-NOPROTO unsupported protocol version", c.do("HELLO", "4"))
+	require.Contains(t, c.do("HELLO", "3"), "%[$server $cache-api")
+	require.Equal(t, "+OK", c.do("SET", "k", "v"))
+	require.Equal(t, "$nil", c.do("GET", "missing"))
+	require.Contains(t, c.do("INFO"), "keyspace_misses:1")
+}
+
+func TestReadOnly(t *testing.T) {
+	store := cache.NewCache()
+	require.NoError(t, store.Set(context.Background(), "default", "k", []byte("v")))
+	c := startServer(t, cache.ReadOnly(store))
+
+	require.Equal(t, "$v", c.do("GET", "k"))
+	require.Equal(t, "-READONLY You can't write against a read only replica.", c.do("SET", "k", "v2"))
+	require.Equal(t, "-READONLY You can't write against a read only replica.", c.do("DEL", "k"))
+	require.Equal(t, "-READONLY You can't write against a read only replica.", c.do("INCR", "n"))
+}
+
+func TestQuit(t *testing.T) {
+	c := startServer(t, cache.NewCache())
+
+	require.Equal(t, "+OK", c.do("QUIT"))
+	_, err := c.r.ReadByte()
+	require.Error(t, err)
+}
+
+// lateListener hands out connections pushed to conns even once it is closed, as a listener does with
+// a connection accepted just before Close.
+type lateListener struct {
+	conns chan net.Conn
+}
+
+func (l *lateListener) Accept() (net.Conn, error) {
+	conn, ok := <-l.conns
+	if !ok {
+		return nil, net.ErrClosed
+	}
+	return conn, nil
+}
+
+func (l *lateListener) Close() error   { return nil }
+func (l *lateListener) Addr() net.Addr { return &net.TCPAddr{} }
+
+func TestShutdownClosesLateConnections(t *testing.T) {
+	srv := NewServer(newTestLogger(), cache.NewCache(), "default")
+	lis := &lateListener{conns: make(chan net.Conn)}
+	defer close(lis.conns)
+
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(lis) }()
+	require.Eventually(t, func() bool {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		return srv.listener != nil
+	}, 5*time.Second, time.Millisecond)
+
+	require.NoError(t, srv.Shutdown(context.Background()))
+
+	server, client := net.Pipe()
+	lis.conns <- server
+	select {
+	case err := <-served:
+		require.ErrorIs(t, err, ErrServerClosed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return")
+	}
+
+	_, err := client.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+}
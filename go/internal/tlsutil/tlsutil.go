@@ -0,0 +1,254 @@
+// Package tlsutil loads the certificates of the servers and reloads them when their files change.
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ClientAuth is the verification of client certificates: none, optional or require.
+type ClientAuth string
+
+const (
+	ClientAuthNone ClientAuth = "none"
+	// ClientAuthOptional verifies the certificates clients present, clients may present none.
+	ClientAuthOptional ClientAuth = "optional"
+	ClientAuthRequire  ClientAuth = "require"
+)
+
+func (a ClientAuth) tlsType() (tls.ClientAuthType, error) {
+	switch a {
+	case "", ClientAuthNone:
+		return tls.NoClientCert, nil
+	case ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return 0, fmt.Errorf("unknown client auth %q", a)
+	}
+}
+
+type Config struct {
+	CertPath, KeyPath string
+	// ClientCAPath is a PEM bundle of the CAs that sign client certificates, required unless
+	// ClientAuth is none.
+	ClientCAPath string
+	ClientAuth   ClientAuth
+	// CAPath is a PEM bundle of the CAs that sign the certificates of other instances, the system
+	// roots when empty.
+	CAPath string
+}
+
+// Certificates holds the certificate of the servers and the CA bundles of Config. The TLS
+// configurations it returns always use the files last loaded.
+type Certificates struct {
+	config     Config
+	clientAuth tls.ClientAuthType
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	roots     *x509.CertPool
+	modTimes  map[string]time.Time
+	// own holds every certificate loaded, connections made before a reload keep the previous one
+	own map[string]bool
+}
+
+func Load(config Config) (*Certificates, error) {
+	clientAuth, err := config.ClientAuth.tlsType()
+	if err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+	if clientAuth != tls.NoClientCert && config.ClientCAPath == "" {
+		return nil, errors.New("tls: client certificates cannot be verified without client CAs")
+	}
+
+	c := &Certificates{config: config, clientAuth: clientAuth, own: map[string]bool{}}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload reads the files again, the certificates in use are kept when one is invalid.
+func (c *Certificates) Reload() error {
+	modTimes := map[string]time.Time{}
+	for _, path := range c.paths() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
+		modTimes[path] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.config.CertPath, c.config.KeyPath)
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	clientCAs, err := loadPool(c.config.ClientCAPath)
+	if err != nil {
+		return err
+	}
+	roots, err := loadPool(c.config.CAPath)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.own[string(cert.Certificate[0])] = true
+	c.clientCAs = clientCAs
+	c.roots = roots
+	c.modTimes = modTimes
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Certificates) paths() []string {
+	paths := []string{c.config.CertPath, c.config.KeyPath}
+	for _, path := range []string{c.config.ClientCAPath, c.config.CAPath} {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// loadPool returns nil for an empty path.
+func loadPool(path string) (*x509.CertPool, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("tls: %s: no certificates", path)
+	}
+	return pool, nil
+}
+
+// Modified reports whether a file changed since it was last loaded.
+func (c *Certificates) Modified() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for path, modTime := range c.modTimes {
+		info, err := os.Stat(path)
+		if err == nil && !info.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Certificates) certificate() *tls.Certificate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert
+}
+
+// Own reports whether cert is a certificate this server was loaded with.
+func (c *Certificates) Own(cert *x509.Certificate) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return cert != nil && c.own[string(cert.Raw)]
+}
+
+// ServerConfig returns the configuration of the servers, it offers HTTP/2 and HTTP/1.1.
+func (c *Certificates) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*c.cert},
+				ClientCAs:    c.clientCAs,
+				ClientAuth:   c.clientAuth,
+				NextProtos:   []string{"h2", "http/1.1"},
+			}, nil
+		},
+	}
+}
+
+// PeerConfig returns the configuration of connections to other instances, it verifies their
+// certificates with the CAs of Config and presents the certificate of this server.
+func (c *Certificates) PeerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// the roots are checked in VerifyConnection so that they can be reloaded
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			c.mu.RLock()
+			roots := c.roots
+			c.mu.RUnlock()
+			return verify(cs, roots)
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return c.certificate(), nil
+		},
+	}
+}
+
+func verify(cs tls.ConnectionState, roots *x509.CertPool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("tls: no server certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+// LoopbackConfig returns the configuration of the connection of the gateway to the GRPC server of
+// the same instance, it accepts only the certificates of this server and presents the current one.
+func (c *Certificates) LoopbackConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// the server is verified by its certificate rather than by a CA
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 || !c.Own(cs.PeerCertificates[0]) {
+				return errors.New("tls: loopback peer does not present the server certificate")
+			}
+			return nil
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return c.certificate(), nil
+		},
+	}
+}
+
+// ClientConfig returns the configuration of a client that verifies servers with the CAs of caPath,
+// the system roots when it is empty, and presents the certificate of certPath and keyPath when they are set.
+func ClientConfig(caPath, certPath, keyPath string) (*tls.Config, error) {
+	roots, err := loadPool(caPath)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: roots}
+	if certPath != "" || keyPath != "" {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
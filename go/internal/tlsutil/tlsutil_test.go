@@ -0,0 +1,185 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// issue returns a certificate for name signed by parent, or a self-signed CA when parent is nil.
+func issue(t *testing.T, name string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{name},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) write(t *testing.T, certPath, keyPath string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600))
+	if keyPath != "" {
+		der, err := x509.MarshalECPrivateKey(c.key)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600))
+	}
+}
+
+func (c *testCert) tls() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+// handshake connects client to server and returns the verified client certificate seen by the server.
+func handshake(t *testing.T, server, client *tls.Config) (*x509.Certificate, error) {
+	t.Helper()
+	l, err := tls.Listen("tcp", "127.0.0.1:0", server)
+	require.NoError(t, err)
+	defer l.Close()
+
+	type result struct {
+		cert *x509.Certificate
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			done <- result{nil, err}
+			return
+		}
+		defer conn.Close()
+		tc := conn.(*tls.Conn)
+		err = tc.Handshake()
+		var cert *x509.Certificate
+		if chains := tc.ConnectionState().VerifiedChains; len(chains) > 0 {
+			cert = chains[0][0]
+		}
+		done <- result{cert, err}
+	}()
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), client)
+	if err == nil {
+		// the server verifies the client certificate after the client completes a TLS 1.3 handshake
+		_, _ = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	r := <-done
+	if err == nil {
+		err = r.err
+	}
+	return r.cert, err
+}
+
+func TestCertificates(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	ca := issue(t, "ca", nil)
+	ca.write(t, path("ca.crt"), "")
+	server := issue(t, "cache.local", ca)
+	server.write(t, path("tls.crt"), path("tls.key"))
+
+	certs, err := Load(Config{
+		CertPath:     path("tls.crt"),
+		KeyPath:      path("tls.key"),
+		ClientCAPath: path("ca.crt"),
+		ClientAuth:   ClientAuthRequire,
+		CAPath:       path("ca.crt"),
+	})
+	require.NoError(t, err)
+	require.True(t, certs.Own(server.cert))
+	require.False(t, certs.Modified())
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	client := issue(t, "billing", ca)
+
+	seen, err := handshake(t, certs.ServerConfig(), &tls.Config{RootCAs: roots, ServerName: "cache.local", Certificates: []tls.Certificate{client.tls()}})
+	require.NoError(t, err)
+	require.Equal(t, "billing", seen.Subject.CommonName)
+
+	_, err = handshake(t, certs.ServerConfig(), &tls.Config{RootCAs: roots, ServerName: "cache.local"})
+	require.Error(t, err, "a client certificate is required")
+
+	other := issue(t, "billing", issue(t, "other-ca", nil))
+	_, err = handshake(t, certs.ServerConfig(), &tls.Config{RootCAs: roots, ServerName: "cache.local", Certificates: []tls.Certificate{other.tls()}})
+	require.Error(t, err, "client certificates must be signed by a client CA")
+
+	peer := certs.PeerConfig()
+	peer.ServerName = "cache.local"
+	seen, err = handshake(t, certs.ServerConfig(), peer)
+	require.NoError(t, err)
+	require.True(t, certs.Own(seen))
+
+	_, err = handshake(t, certs.ServerConfig(), certs.LoopbackConfig())
+	require.NoError(t, err)
+
+	// a new certificate is served once reloaded
+	loopback := certs.LoopbackConfig()
+	rotated := issue(t, "cache.local", ca)
+	rotated.write(t, path("tls.crt"), path("tls.key"))
+	future := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(path("tls.crt"), future, future))
+	require.True(t, certs.Modified())
+	require.NoError(t, certs.Reload())
+	require.True(t, certs.Own(rotated.cert))
+	require.True(t, certs.Own(server.cert), "connections made before the reload present the previous certificate")
+	require.False(t, certs.Own(client.cert))
+
+	stale := &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			require.Equal(t, rotated.cert.Raw, cs.PeerCertificates[0].Raw)
+			return nil
+		},
+		Certificates: []tls.Certificate{client.tls()},
+	}
+	_, err = handshake(t, certs.ServerConfig(), stale)
+	require.NoError(t, err)
+	_, err = handshake(t, certs.ServerConfig(), loopback)
+	require.NoError(t, err)
+
+	// an invalid key keeps the certificate in use
+	require.NoError(t, os.WriteFile(path("tls.key"), []byte("invalid"), 0o600))
+	require.Error(t, certs.Reload())
+	require.True(t, certs.Own(rotated.cert))
+}
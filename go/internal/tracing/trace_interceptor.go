@@ -7,43 +7,63 @@ import (
 	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/requestid"
 	"github.com/ahmedalhulaibi/cache-api/internal/grpcutil/interceptors/userid"
 	"github.com/ahmedalhulaibi/loggy"
-	"go.opencensus.io/trace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 )
 
-// NewOpenCensusTraceInterceptor creates a new OpenCensusTraceInterceptor
-func NewOpenCensusTraceInterceptor(logger *loggy.Logger) grpc.UnaryServerInterceptor {
+// TraceUnaryServerInterceptor returns a new unary server interceptor that annotates the span of a call,
+// started by the otelgrpc stats handler, and injects its trace id into the context.
+func TraceUnaryServerInterceptor(logger *loggy.Logger) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		var span *trace.Span
-
-		ctx, span = trace.StartSpan(
-			ctx,
-			info.FullMethod,
-			trace.WithSampler(trace.AlwaysSample()),
-		)
-
-		// Extract request id from metadata
-		if reqid, ok := extractRequestID(ctx); ok {
-			span.AddAttributes(trace.StringAttribute(requestid.ContextKey, reqid))
-		}
-
-		// Extract user id from metadata
-		if userID, ok := extractUserID(ctx); ok {
-			span.AddAttributes(trace.StringAttribute(userid.ContextKey, userID))
-		}
-
-		// Extract instance id from metadata
-		if instanceID, ok := extractInstanceID(ctx); ok {
-			span.AddAttributes(trace.StringAttribute(instanceid.ContextKey, instanceID))
-		}
-
-		ctx, _ = logger.With(ctx, "trace_id", span.SpanContext().TraceID.String())
-		defer span.End()
-		return handler(ctx, req)
+		return handler(annotateSpan(ctx, logger), req)
 	}
 }
 
+// TraceStreamServerInterceptor returns a new stream server interceptor that annotates the span of a
+// stream and injects its trace id into the stream context.
+func TraceStreamServerInterceptor(logger *loggy.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &serverStream{ServerStream: stream, ctx: annotateSpan(stream.Context(), logger)})
+	}
+}
+
+func annotateSpan(ctx context.Context, logger *loggy.Logger) context.Context {
+	span := trace.SpanFromContext(ctx)
+	if !span.SpanContext().HasTraceID() {
+		return ctx
+	}
+
+	// Extract request id from metadata
+	if reqid, ok := extractRequestID(ctx); ok {
+		span.SetAttributes(attribute.String(requestid.ContextKey, reqid))
+	}
+
+	// Extract user id from metadata
+	if userID, ok := extractUserID(ctx); ok {
+		span.SetAttributes(attribute.String(userid.ContextKey, userID))
+	}
+
+	// Extract instance id from metadata
+	if instanceID, ok := extractInstanceID(ctx); ok {
+		span.SetAttributes(attribute.String(instanceid.ContextKey, instanceID))
+	}
+
+	ctx, _ = logger.With(ctx, "trace_id", span.SpanContext().TraceID().String())
+	return ctx
+}
+
+// serverStream overrides the context of a stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
 func extractRequestID(ctx context.Context) (string, bool) {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
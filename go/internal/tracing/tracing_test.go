@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewSampler(t *testing.T) {
+	for _, name := range []string{"", SamplerAlwaysOn, SamplerAlwaysOff, SamplerTraceIDRatio, SamplerParentBasedAlwaysOn, SamplerParentBasedAlwaysOff, SamplerParentBasedTraceIDRatio} {
+		_, err := NewSampler(name, 0.5)
+		require.NoError(t, err, name)
+	}
+
+	_, err := NewSampler("sometimes", 1)
+	require.EqualError(t, err, `unknown sampler "sometimes"`)
+	_, err = NewSampler(SamplerTraceIDRatio, 2)
+	require.EqualError(t, err, "sampler ratio 2 must be between 0 and 1")
+}
+
+func TestFileExporter(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "traces.json")
+
+	tp, err := NewTracerProvider(ctx, Config{ServiceName: "api", InstanceID: "api-0", Exporter: ExporterFile, FilePath: path, Sampler: SamplerAlwaysOn})
+	require.NoError(t, err)
+
+	_, span := tp.Tracer("test").Start(ctx, "Set")
+	span.End()
+	require.NoError(t, tp.Shutdown(ctx))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var exported struct {
+		Name        string
+		SpanContext struct{ TraceID string }
+		Resource    []struct {
+			Key   string
+			Value struct{ Value interface{} }
+		}
+	}
+	require.NoError(t, json.Unmarshal(data, &exported))
+	require.Equal(t, "Set", exported.Name)
+	require.Equal(t, span.SpanContext().TraceID().String(), exported.SpanContext.TraceID)
+
+	resource := map[string]interface{}{}
+	for _, kv := range exported.Resource {
+		resource[kv.Key] = kv.Value.Value
+	}
+	require.Equal(t, "api", resource["service.name"])
+	require.Equal(t, "api-0", resource["service.instance.id"])
+}
+
+func TestPropagator(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	for name, header := range map[string]http.Header{
+		"tracecontext": {"Traceparent": {"00-" + traceID + "-00f067aa0ba902b7-01"}},
+		"b3 multiple":  {"X-B3-Traceid": {traceID}, "X-B3-Spanid": {"00f067aa0ba902b7"}, "X-B3-Sampled": {"1"}},
+		"b3 single":    {"B3": {traceID + "-00f067aa0ba902b7-1"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := Propagator().Extract(context.Background(), propagation.HeaderCarrier(header))
+			sc := trace.SpanContextFromContext(ctx)
+			require.Equal(t, traceID, sc.TraceID().String())
+			require.True(t, sc.IsSampled())
+			require.True(t, sc.IsRemote())
+
+			injected := http.Header{}
+			Propagator().Inject(ctx, propagation.HeaderCarrier(injected))
+			require.Equal(t, "00-"+traceID+"-00f067aa0ba902b7-01", injected.Get("Traceparent"))
+			require.Equal(t, traceID, injected.Get(TraceIDHeader))
+		})
+	}
+}